@@ -1,26 +1,166 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
 	"github.com/markonick/gigs-challenge/config"
+	"github.com/markonick/gigs-challenge/internal/auth"
 	"github.com/markonick/gigs-challenge/internal/controllers"
 	container "github.com/markonick/gigs-challenge/internal/di"
+	"github.com/markonick/gigs-challenge/internal/ingest"
 	"github.com/markonick/gigs-challenge/internal/logger"
+	"github.com/markonick/gigs-challenge/internal/reload"
 	"github.com/markonick/gigs-challenge/internal/router"
+	"github.com/markonick/gigs-challenge/internal/services"
+	"github.com/markonick/gigs-challenge/internal/svix"
+	"github.com/markonick/gigs-challenge/internal/tracing"
+	"github.com/markonick/gigs-challenge/internal/worker"
 )
 
 func main() {
-	// Load configuration
-	config.Load()
+	// Defaults, config file, environment and flags, in that order
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		// One line per problem, the logger is not configured yet
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	c := container.NewContainer(cfg)
+	if err := c.Invoke(logger.Configure); err != nil {
+		logger.Log.Fatal().Err(err).Msg("Failed to configure logging")
+	}
+
+	err = c.Invoke(func(
+		controller *controllers.NotificationController,
+		deadLetterController *controllers.DeadLetterController,
+		healthController *controllers.HealthController,
+		loggingController *controllers.LoggingController,
+		routerOptions router.Options,
+		pushVerifier *auth.Verifier,
+		adminAuth *auth.AdminAuthenticator,
+		pullConsumer *ingest.PullConsumer,
+		taskService services.TaskService,
+		pool *worker.Pool,
+		registry *svix.ProjectRegistry,
+		tracingConfig tracing.Config,
+		reloader *reload.Reloader,
+	) {
+		if cfg.File != "" {
+			logger.Log.Info().Str("file", cfg.File).Msg("Loaded configuration file")
+		}
+
+		shutdownTracing, err := tracing.Setup(context.Background(), tracingConfig)
+		if err != nil {
+			logger.Log.Fatal().Err(err).Msg("Failed to set up tracing")
+		}
+		// Flushed last, so the spans of the drained deliveries are exported too
+		defer func() {
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(flushCtx); err != nil {
+				logger.Log.Error().Err(err).Msg("Failed to flush spans")
+			}
+		}()
+
+		// Cancelled on SIGINT or SIGTERM, which starts the shutdown
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		var background sync.WaitGroup
 
-	c := container.NewContainer()
+		// Set the Svix applications up without holding back the server, /readyz reports when they are
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			registry.Run(ctx)
+		}()
 
-	err := c.Invoke(func(controller *controllers.NotificationController) {
-		r := router.Setup(controller)
+		// Deliver whatever a previous run accepted but did not finish
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			requeued, err := taskService.Recover(ctx)
+			if err != nil {
+				logger.Log.Error().Err(err).Msg("Failed to recover events from outbox")
+				return
+			}
+			logger.Log.Info().Int("requeued", requeued).Msg("Recovered events from outbox")
+		}()
 
-		logger.Log.Info().Msg("Starting server and listening on port 8080")
-		if err := r.Run(":8080"); err != nil {
+		// Reload the configuration on SIGHUP, and on file changes when watching is enabled
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			reloader.Run(ctx)
+		}()
+
+		if pullConsumer != nil {
+			background.Add(1)
+			go func() {
+				defer background.Done()
+				if err := pullConsumer.Run(ctx); err != nil {
+					logger.Log.Error().Err(err).Msg("Pub/Sub pull consumer stopped")
+				}
+			}()
+		}
+
+		handler := router.Setup(
+			controller,
+			deadLetterController,
+			healthController,
+			loggingController,
+			pushVerifier,
+			adminAuth,
+			routerOptions,
+		)
+		server := &http.Server{
+			Addr:    ":" + strconv.Itoa(cfg.Server.Port),
+			Handler: handler,
+		}
+
+		serverErr := make(chan error, 1)
+		go func() {
+			logger.Log.Info().Int("port", cfg.Server.Port).Msg("Starting server")
+			serverErr <- server.ListenAndServe()
+		}()
+
+		select {
+		case err := <-serverErr:
 			logger.Log.Fatal().Err(err).Msg("Failed to start server")
+		case <-ctx.Done():
+		}
+		stop()
+
+		shutdownTimeout := cfg.Server.ShutdownTimeout
+		logger.Log.Info().Dur("timeout", shutdownTimeout).Msg("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		// Stop taking new notifications first, then let the accepted ones finish
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Log.Error().Err(err).Msg("Failed to close HTTP connections in time")
+		}
+		background.Wait()
+
+		if err := pool.Shutdown(shutdownCtx); err != nil {
+			logger.Log.Warn().Err(err).Msg("Worker pool did not drain in time, unfinished events are redelivered on next start")
+			return
 		}
+		logger.Log.Info().Msg("Shutdown complete")
 	})
 
 	if err != nil {
@@ -1,13 +1,411 @@
 package config
 
 import (
-	"github.com/joho/godotenv"
+	"time"
+
+	"github.com/markonick/gigs-challenge/internal/auth"
+	"github.com/markonick/gigs-challenge/internal/health"
+	"github.com/markonick/gigs-challenge/internal/idempotency"
+	"github.com/markonick/gigs-challenge/internal/ingest"
 	"github.com/markonick/gigs-challenge/internal/logger"
+	"github.com/markonick/gigs-challenge/internal/svix"
+	"github.com/markonick/gigs-challenge/internal/tracing"
+	"github.com/markonick/gigs-challenge/internal/worker"
 )
 
-func Load() {
-	err := godotenv.Load()
+// Config is the configuration of the service, see Load for where it is read from.
+// The config tags name the settings in the config file, nested as the structs are.
+// The env tags name the environment variables, prefixed with the env tags of the
+// enclosing structs, and the command line flags are the environment variables in
+// lower case with dashes, so Svix.Retry.Attempts is svix.retry.attempts in the file,
+// SVIX_RETRY_ATTEMPTS in the environment and --svix-retry-attempts on the command line.
+type Config struct {
+	// File is the config file the configuration was read from, empty without one
+	File string `config:"-"`
+	// args are the command line flags it was loaded with, see Reload
+	args []string
+
+	Server      Server      `config:"server"`
+	Log         Log         `config:"log" env:"LOG"`
+	Tracing     Tracing     `config:"tracing"`
+	Worker      Worker      `config:"worker"`
+	Svix        Svix        `config:"svix" env:"SVIX"`
+	Idempotency Idempotency `config:"idempotency" env:"IDEMPOTENCY"`
+	Redis       Redis       `config:"redis" env:"REDIS"`
+	Outbox      Store       `config:"outbox" env:"OUTBOX"`
+	DeadLetter  Store       `config:"deadletter" env:"DEADLETTER"`
+	PubSub      PubSub      `config:"pubsub" env:"PUBSUB"`
+	Health      Health      `config:"health" env:"HEALTH"`
+	Admin       Admin       `config:"admin" env:"ADMIN"`
+	Watch       Watch       `config:"watch" env:"CONFIG_WATCH"`
+}
+
+type Server struct {
+	Port int `config:"port" env:"PORT"`
+	// ShutdownTimeout is how long accepted events may take to finish on SIGTERM
+	ShutdownTimeout time.Duration `config:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+}
+
+type Log struct {
+	Format       string        `config:"format" env:"FORMAT"`
+	Level        string        `config:"level" env:"LEVEL"`
+	Caller       bool          `config:"caller" env:"CALLER"`
+	SampleBurst  int           `config:"sample_burst" env:"SAMPLE_BURST"`
+	SamplePeriod time.Duration `config:"sample_period" env:"SAMPLE_PERIOD"`
+	SampleN      int           `config:"sample_n" env:"SAMPLE_N"`
+	RedactFields []string      `config:"redact_fields" env:"REDACT_FIELDS"`
+}
+
+type Tracing struct {
+	Exporter    string  `config:"exporter" env:"TRACING_EXPORTER"`
+	ServiceName string  `config:"service_name" env:"OTEL_SERVICE_NAME"`
+	SampleRatio float64 `config:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+type Worker struct {
+	MaxWorkers    int           `config:"max_workers" env:"MAX_WORKERS"`
+	QueueCapacity int           `config:"queue_capacity" env:"WORKER_QUEUE_CAPACITY"`
+	TaskTimeout   time.Duration `config:"task_timeout" env:"TASK_TIMEOUT"`
+}
+
+type Svix struct {
+	AuthToken   string        `config:"auth_token" env:"AUTH_TOKEN"`
+	ServerURL   string        `config:"server_url" env:"SERVER_URL"`
+	HTTPTimeout time.Duration `config:"http_timeout" env:"HTTP_TIMEOUT"`
+	Debug       bool          `config:"debug" env:"DEBUG"`
+
+	Projects           []string      `config:"projects" env:"PROJECTS"`
+	ProjectAllowlist   []string      `config:"project_allowlist" env:"PROJECT_ALLOWLIST"`
+	SetupRetryDelay    time.Duration `config:"setup_retry_delay" env:"SETUP_RETRY_DELAY"`
+	SetupMaxRetryDelay time.Duration `config:"setup_max_retry_delay" env:"SETUP_MAX_RETRY_DELAY"`
+
+	Retry     Retry     `config:"retry" env:"RETRY"`
+	RateLimit RateLimit `config:"rate_limit" env:"RATE_LIMIT"`
+	Breaker   Breaker   `config:"breaker" env:"BREAKER"`
+}
+
+// Retry is the default retry policy of the Svix calls and its overrides per operation
+type Retry struct {
+	RetryPolicy `config:",inline"`
+
+	SendMessage       RetryPolicy `config:"send_message" env:"SEND_MESSAGE"`
+	CreateEndpoint    RetryPolicy `config:"create_endpoint" env:"CREATE_ENDPOINT"`
+	CreateApplication RetryPolicy `config:"create_application" env:"CREATE_APPLICATION"`
+	CreateEventType   RetryPolicy `config:"create_event_type" env:"CREATE_EVENT_TYPE"`
+}
+
+// RetryPolicy of the Svix calls, in the overrides per operation zero keeps the default
+type RetryPolicy struct {
+	Attempts  int           `config:"attempts" env:"ATTEMPTS"`
+	BaseDelay time.Duration `config:"base_delay" env:"BASE_DELAY"`
+	MaxDelay  time.Duration `config:"max_delay" env:"MAX_DELAY"`
+	Budget    time.Duration `config:"budget" env:"BUDGET"`
+}
+
+// RateLimit of the Svix calls in calls per second, 0 disables a limit
+type RateLimit struct {
+	Global      float64 `config:"global" env:"GLOBAL"`
+	GlobalBurst int     `config:"global_burst" env:"GLOBAL_BURST"`
+	App         float64 `config:"app" env:"APP"`
+	AppBurst    int     `config:"app_burst" env:"APP_BURST"`
+	// Projects overrides the application limit per project, as project=rate[:burst]
+	Projects []string `config:"projects" env:"PROJECTS"`
+}
+
+type Breaker struct {
+	Threshold   int           `config:"threshold" env:"THRESHOLD"`
+	OpenTimeout time.Duration `config:"open_timeout" env:"OPEN_TIMEOUT"`
+}
+
+type Idempotency struct {
+	// Store is memory, disk or redis
+	Store       string        `config:"store" env:"STORE"`
+	Path        string        `config:"path" env:"PATH"`
+	RedisPrefix string        `config:"redis_prefix" env:"REDIS_PREFIX"`
+	TTL         time.Duration `config:"ttl" env:"TTL"`
+	InFlightTTL time.Duration `config:"inflight_ttl" env:"INFLIGHT_TTL"`
+	Capacity    int           `config:"capacity" env:"CAPACITY"`
+}
+
+type Redis struct {
+	URL string `config:"url" env:"URL"`
+}
+
+// Store selects the backend of the outbox or the dead letters, disk or memory
+type Store struct {
+	Store string `config:"store" env:"STORE"`
+	Path  string `config:"path" env:"PATH"`
+}
+
+type PubSub struct {
+	Endpoint     string `config:"endpoint" env:"ENDPOINT"`
+	EmulatorHost string `config:"emulator_host" env:"EMULATOR_HOST"`
+
+	Auth PubSubAuth `config:"auth" env:"AUTH"`
+	Pull PubSubPull `config:"pull" env:"PULL"`
+}
+
+type PubSubAuth struct {
+	Enabled   bool          `config:"enabled" env:"ENABLED"`
+	Audience  string        `config:"audience" env:"AUDIENCE"`
+	Email     string        `config:"email" env:"EMAIL"`
+	JWKS      string        `config:"jwks" env:"JWKS"`
+	Issuers   []string      `config:"issuers" env:"ISSUERS"`
+	ClockSkew time.Duration `config:"clock_skew" env:"CLOCK_SKEW"`
+}
+
+// PubSubPull configures pull ingestion, which is off without a subscription
+type PubSubPull struct {
+	Subscription   string        `config:"subscription" env:"SUBSCRIPTION"`
+	MaxOutstanding int           `config:"max_outstanding" env:"MAX_OUTSTANDING"`
+	Streams        int           `config:"streams" env:"STREAMS"`
+	AckDeadline    time.Duration `config:"ack_deadline" env:"ACK_DEADLINE"`
+}
+
+type Health struct {
+	CheckTimeout     time.Duration `config:"check_timeout" env:"CHECK_TIMEOUT"`
+	SvixPingInterval time.Duration `config:"svix_ping_interval" env:"SVIX_PING_INTERVAL"`
+}
+
+type Admin struct {
+	// Token is the bearer token of the admin endpoints, they are off without one
+	Token            string        `config:"token" env:"TOKEN"`
+	DebugDuration    time.Duration `config:"debug_duration" env:"DEBUG_DURATION"`
+	DebugMaxDuration time.Duration `config:"debug_max_duration" env:"DEBUG_MAX_DURATION"`
+	PprofEnabled     bool          `config:"pprof_enabled" env:"PPROF_ENABLED"`
+}
+
+// Watch configures reloading the config file when it changes, it is always reloaded on SIGHUP
+type Watch struct {
+	// Interval is how often the config file is checked for changes, 0 disables the check
+	Interval time.Duration `config:"interval" env:"INTERVAL"`
+}
+
+// Default returns the configuration used for every setting that is not set
+func Default() Config {
+	return Config{
+		Server: Server{
+			Port:            8080,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Log: Log{
+			Format:       logger.DefaultConfig.Format,
+			Level:        logger.DefaultConfig.Level,
+			Caller:       logger.DefaultConfig.Caller,
+			SamplePeriod: time.Second,
+			RedactFields: logger.DefaultRedactFields,
+		},
+		Tracing: Tracing{
+			Exporter:    tracing.DefaultConfig.Exporter,
+			ServiceName: tracing.DefaultConfig.ServiceName,
+			SampleRatio: tracing.DefaultConfig.SampleRatio,
+		},
+		Worker: Worker{
+			MaxWorkers:    10,
+			QueueCapacity: 1000,
+			TaskTimeout:   time.Minute,
+		},
+		Svix: Svix{
+			HTTPTimeout:        svix.DefaultTimeout,
+			Projects:           svix.DefaultRegistryConfig.Projects,
+			SetupRetryDelay:    svix.DefaultRegistryConfig.RetryDelay,
+			SetupMaxRetryDelay: svix.DefaultRegistryConfig.MaxRetryDelay,
+			Retry: Retry{
+				RetryPolicy: RetryPolicy(svix.DefaultRetryPolicy),
+			},
+			RateLimit: RateLimit{
+				GlobalBurst: 1,
+				AppBurst:    1,
+			},
+			Breaker: Breaker{
+				Threshold:   svix.DefaultBreakerConfig.FailureThreshold,
+				OpenTimeout: svix.DefaultBreakerConfig.OpenTimeout,
+			},
+		},
+		Idempotency: Idempotency{
+			Store:       "memory",
+			Path:        "data/idempotency.db",
+			RedisPrefix: idempotency.DefaultRedisPrefix,
+			TTL:         idempotency.DefaultOptions.TTL,
+			InFlightTTL: idempotency.DefaultOptions.InFlightTTL,
+			Capacity:    idempotency.DefaultOptions.Capacity,
+		},
+		Redis: Redis{
+			URL: "redis://localhost:6379/0",
+		},
+		Outbox: Store{
+			Store: "disk",
+			Path:  "data/outbox.db",
+		},
+		DeadLetter: Store{
+			Store: "disk",
+			Path:  "data/deadletter.db",
+		},
+		PubSub: PubSub{
+			Endpoint: ingest.DefaultPubSubEndpoint,
+			Auth: PubSubAuth{
+				Enabled:   true,
+				JWKS:      auth.GoogleJWKSURL,
+				Issuers:   auth.GoogleIssuers,
+				ClockSkew: time.Minute,
+			},
+			Pull: PubSubPull{
+				MaxOutstanding: ingest.DefaultPullConfig.MaxOutstandingMessages,
+				Streams:        ingest.DefaultPullConfig.Streams,
+				AckDeadline:    ingest.DefaultPullConfig.AckDeadline,
+			},
+		},
+		Health: Health{
+			CheckTimeout:     health.DefaultTimeout,
+			SvixPingInterval: 10 * time.Second,
+		},
+		Admin: Admin{
+			DebugDuration:    logger.DefaultDebugConfig.DefaultDuration,
+			DebugMaxDuration: logger.DefaultDebugConfig.MaxDuration,
+		},
+	}
+}
+
+// LoggerConfig returns the configuration of the logger
+func (c Log) LoggerConfig() logger.Config {
+	return logger.Config{
+		Format: c.Format,
+		Level:  c.Level,
+		Caller: c.Caller,
+		Sampling: logger.Sampling{
+			Burst:  uint32(c.SampleBurst),
+			Period: c.SamplePeriod,
+			N:      uint32(c.SampleN),
+		},
+		RedactFields: c.RedactFields,
+	}
+}
+
+// TracingConfig returns the configuration of the tracer provider
+func (c Tracing) TracingConfig() tracing.Config {
+	return tracing.Config{
+		Exporter:    c.Exporter,
+		ServiceName: c.ServiceName,
+		SampleRatio: c.SampleRatio,
+	}
+}
+
+// PoolConfig returns the configuration of the worker pool
+func (c Worker) PoolConfig() worker.Config {
+	return worker.Config{
+		MaxWorkers:    c.MaxWorkers,
+		QueueCapacity: c.QueueCapacity,
+		TaskTimeout:   c.TaskTimeout,
+	}
+}
+
+// ClientConfig returns the configuration of the Svix client
+func (c Svix) ClientConfig() (svix.Config, error) {
+	rateLimit, err := c.RateLimit.RateLimitConfig()
 	if err != nil {
-		logger.Log.Fatal().Msg("Error loading .env file")
+		return svix.Config{}, err
+	}
+	return svix.Config{
+		ServerURL: c.ServerURL,
+		Timeout:   c.HTTPTimeout,
+		Debug:     c.Debug,
+		Retry:     c.Retry.Policies(),
+		RateLimit: rateLimit,
+	}, nil
+}
+
+// BreakerConfig returns the configuration of the Svix circuit breakers
+func (c Svix) BreakerConfig() svix.BreakerConfig {
+	return svix.BreakerConfig{
+		FailureThreshold: c.Breaker.Threshold,
+		OpenTimeout:      c.Breaker.OpenTimeout,
+	}
+}
+
+// RegistryConfig returns the configuration of the Svix project registry
+func (c Svix) RegistryConfig() svix.RegistryConfig {
+	return svix.RegistryConfig{
+		Projects:      c.Projects,
+		Allowlist:     c.ProjectAllowlist,
+		RetryDelay:    c.SetupRetryDelay,
+		MaxRetryDelay: c.SetupMaxRetryDelay,
+	}
+}
+
+// Policies returns the retry policy of every operation, falling back to the default one
+func (c Retry) Policies() svix.RetryPolicies {
+	fallback := svix.RetryPolicy(c.RetryPolicy)
+	return svix.RetryPolicies{
+		"default":                       fallback,
+		svix.OperationSendMessage:       c.SendMessage.or(fallback),
+		svix.OperationCreateEndpoint:    c.CreateEndpoint.or(fallback),
+		svix.OperationCreateApplication: c.CreateApplication.or(fallback),
+		svix.OperationCreateEventType:   c.CreateEventType.or(fallback),
+	}
+}
+
+// or returns the policy with its unset values taken from fallback
+func (p RetryPolicy) or(fallback svix.RetryPolicy) svix.RetryPolicy {
+	if p.Attempts != 0 {
+		fallback.Attempts = p.Attempts
+	}
+	if p.BaseDelay != 0 {
+		fallback.BaseDelay = p.BaseDelay
+	}
+	if p.MaxDelay != 0 {
+		fallback.MaxDelay = p.MaxDelay
+	}
+	if p.Budget != 0 {
+		fallback.Budget = p.Budget
+	}
+	return fallback
+}
+
+// RateLimitConfig returns the Svix rate limits
+func (c RateLimit) RateLimitConfig() (svix.RateLimitConfig, error) {
+	projects, err := svix.ParseRateLimits(c.Projects)
+	if err != nil {
+		return svix.RateLimitConfig{}, err
+	}
+	return svix.RateLimitConfig{
+		Global:   svix.RateLimit{Rate: c.Global, Burst: c.GlobalBurst},
+		App:      svix.RateLimit{Rate: c.App, Burst: c.AppBurst},
+		Projects: projects,
+	}, nil
+}
+
+// Options returns the options of the idempotency store
+func (c Idempotency) Options() idempotency.Options {
+	return idempotency.Options{
+		TTL:         c.TTL,
+		InFlightTTL: c.InFlightTTL,
+		Capacity:    c.Capacity,
+	}
+}
+
+// DebugConfig returns the limits of the scoped debug logging
+func (c Admin) DebugConfig() logger.DebugConfig {
+	return logger.DebugConfig{
+		DefaultDuration: c.DebugDuration,
+		MaxDuration:     c.DebugMaxDuration,
+	}
+}
+
+// AuthConfig returns the configuration of the Pub/Sub push token verifier
+func (c PubSubAuth) AuthConfig() auth.Config {
+	return auth.Config{
+		Audience:            c.Audience,
+		ServiceAccountEmail: c.Email,
+		Issuers:             c.Issuers,
+		ClockSkew:           c.ClockSkew,
+	}
+}
+
+// PullConfig returns the flow control of the Pub/Sub pull consumer
+func (c PubSubPull) PullConfig() ingest.PullConfig {
+	return ingest.PullConfig{
+		MaxOutstandingMessages: c.MaxOutstanding,
+		Streams:                c.Streams,
+		AckDeadline:            c.AckDeadline,
 	}
 }
@@ -0,0 +1,302 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv is the environment variable naming the config file when --config is not given
+const FileEnv = "CONFIG_FILE"
+
+// Load reads the configuration from the defaults, the config file, the environment and the
+// command line flags in args, each overriding the one before, and validates it.
+// A .env file in the working directory is read into the environment first when there is one.
+func Load(args []string) (Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Config{}, fmt.Errorf("read .env: %w", err)
+	}
+
+	cfg := Default()
+	settings := cfg.settings()
+
+	flags, path, err := parseFlags(settings, args)
+	if err != nil {
+		return Config{}, err
+	}
+	if path == "" {
+		path = os.Getenv(FileEnv)
+	}
+
+	var errs []error
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		for _, s := range settings {
+			if value, ok := values[s.key]; ok {
+				delete(values, s.key)
+				if err := s.set(value); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %s: %q %w", path, s.key, value, err))
+				}
+			}
+		}
+		unknown := make([]string, 0, len(values))
+		for key := range values {
+			unknown = append(unknown, key)
+		}
+		sort.Strings(unknown)
+		for _, key := range unknown {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %s", path, key))
+		}
+	}
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok && value != "" {
+			if err := s.set(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s=%s %w", s.env, value, err))
+			}
+		}
+	}
+	for _, s := range settings {
+		if value, ok := flags[s.flag()]; ok {
+			if err := s.set(value); err != nil {
+				errs = append(errs, fmt.Errorf("--%s=%s %w", s.flag(), value, err))
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	cfg.File = path
+	cfg.args = args
+	return cfg, cfg.Validate()
+}
+
+// Reload loads the configuration again from the same sources, with the same flags
+func (c Config) Reload() (Config, error) {
+	return Load(c.args)
+}
+
+// Changes returns the config file keys of the settings whose value differs in next
+func (c Config) Changes(next Config) []string {
+	current, updated := c.settings(), next.settings()
+	var changed []string
+	for i, s := range current {
+		a, b := s.value, updated[i].value
+		if a.Kind() == reflect.Slice && a.Len() == 0 && b.Len() == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			changed = append(changed, s.key)
+		}
+	}
+	return changed
+}
+
+// setting is a single value of Config with the names it is read under
+type setting struct {
+	// key is the dotted path in the config file
+	key string
+	env string
+	// value is the field of Config, settable
+	value reflect.Value
+}
+
+// flag is the name of the command line flag, the environment variable in lower case with dashes
+func (s setting) flag() string {
+	return strings.ToLower(strings.ReplaceAll(s.env, "_", "-"))
+}
+
+// name describes the setting in errors
+func (s setting) name() string {
+	return s.key + " (" + s.env + ")"
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses value into the setting, lists are comma separated
+func (s setting) set(value string) error {
+	if s.value.Type() == durationType {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.New("is not a valid duration, such as 30s or 5m")
+		}
+		s.value.SetInt(int64(parsed))
+		return nil
+	}
+
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("is not a valid bool")
+		}
+		s.value.SetBool(parsed)
+	case reflect.Int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("is not a valid integer")
+		}
+		s.value.SetInt(int64(parsed))
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.New("is not a valid number")
+		}
+		s.value.SetFloat(parsed)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		s.value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("has unsupported type %s", s.value.Type())
+	}
+	return nil
+}
+
+// settings lists every value of the configuration, in the order of the fields
+func (c *Config) settings() []setting {
+	var settings []setting
+	collect(reflect.ValueOf(c).Elem(), "", "", &settings)
+	return settings
+}
+
+func collect(v reflect.Value, key, env string, settings *[]setting) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name, option, _ := strings.Cut(field.Tag.Get("config"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+
+		fieldKey := key
+		if option != "inline" {
+			fieldKey = join(key, name, ".")
+		}
+		fieldEnv := join(env, field.Tag.Get("env"), "_")
+
+		if field.Type.Kind() == reflect.Struct {
+			collect(v.Field(i), fieldKey, fieldEnv, settings)
+			continue
+		}
+		*settings = append(*settings, setting{key: fieldKey, env: fieldEnv, value: v.Field(i)})
+	}
+}
+
+func join(prefix, name, separator string) string {
+	if prefix == "" {
+		return name
+	}
+	if name == "" {
+		return prefix
+	}
+	return prefix + separator + name
+}
+
+// flagValue records the value of a command line flag, the settings parse it afterwards
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	return f.value
+}
+
+func (f *flagValue) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// parseFlags returns the flags set in args by name and the config file path
+func parseFlags(settings []setting, args []string) (map[string]string, string, error) {
+	flags := flag.NewFlagSet("hookbro", flag.ContinueOnError)
+	path := flags.String("config", "", "YAML (.yaml, .yml) or TOML (.toml) config file, also "+FileEnv)
+	for _, s := range settings {
+		flags.Var(&flagValue{isBool: s.value.Kind() == reflect.Bool}, s.flag(), s.key+" in the config file, also "+s.env)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, "", err
+	}
+	if flags.NArg() > 0 {
+		return nil, "", fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	values := make(map[string]string)
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name != "config" {
+			values[f.Name] = f.Value.String()
+		}
+	})
+	return values, *path, nil
+}
+
+// readFile reads a YAML or TOML config file into its settings by dotted key
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+
+	var tree map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format %q, use .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	flatten("", tree, values)
+	return values, nil
+}
+
+// flatten stores the leaves of tree by dotted key, lists are joined with commas
+func flatten(prefix string, tree map[string]interface{}, values map[string]string) {
+	for name, value := range tree {
+		key := join(prefix, name, ".")
+		switch value := value.(type) {
+		case map[string]interface{}:
+			flatten(key, value, values)
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+}
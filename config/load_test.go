@@ -0,0 +1,166 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/svix"
+)
+
+// writeFile writes a config file to a temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("defaults apply without a file", func(t *testing.T) {
+		t.Setenv("SVIX_AUTH_TOKEN", "testsk_token")
+		t.Setenv("PUBSUB_AUTH_AUDIENCE", "https://hookbro.example.com/notifications")
+
+		cfg, err := Load(nil)
+		require.NoError(t, err)
+
+		want := Default()
+		want.Svix.AuthToken = "testsk_token"
+		want.PubSub.Auth.Audience = "https://hookbro.example.com/notifications"
+		assert.Equal(t, want, cfg)
+	})
+
+	t.Run("file, environment and flags override each other in that order", func(t *testing.T) {
+		path := writeFile(t, "hookbro.yaml", `
+server:
+  port: 9000
+  shutdown_timeout: 10s
+worker:
+  max_workers: 4
+  queue_capacity: 50
+svix:
+  auth_token: from_file
+  projects: [dev, prod]
+  retry:
+    attempts: 3
+    send_message:
+      attempts: 8
+pubsub:
+  auth:
+    audience: https://hookbro.example.com/notifications
+`)
+		t.Setenv("SVIX_AUTH_TOKEN", "from_env")
+		t.Setenv("MAX_WORKERS", "6")
+		t.Setenv("PORT", "9001")
+
+		cfg, err := Load([]string{"--config", path, "--port=9002", "--svix-debug"})
+		require.NoError(t, err)
+
+		assert.Equal(t, path, cfg.File)
+		assert.Equal(t, 9002, cfg.Server.Port)
+		assert.Equal(t, 10*time.Second, cfg.Server.ShutdownTimeout)
+		assert.Equal(t, 6, cfg.Worker.MaxWorkers)
+		assert.Equal(t, 50, cfg.Worker.QueueCapacity)
+		assert.Equal(t, "from_env", cfg.Svix.AuthToken)
+		assert.True(t, cfg.Svix.Debug)
+		assert.Equal(t, []string{"dev", "prod"}, cfg.Svix.Projects)
+		assert.Equal(t, 3, cfg.Svix.Retry.Attempts)
+		assert.Equal(t, 8, cfg.Svix.Retry.SendMessage.Attempts)
+	})
+
+	t.Run("reads TOML files named by CONFIG_FILE", func(t *testing.T) {
+		path := writeFile(t, "hookbro.toml", `
+[svix]
+auth_token = "from_file"
+
+[svix.rate_limit]
+app = 2.5
+projects = ["prod=40:80"]
+
+[pubsub.auth]
+enabled = false
+`)
+		t.Setenv(FileEnv, path)
+
+		cfg, err := Load(nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, "from_file", cfg.Svix.AuthToken)
+		assert.Equal(t, 2.5, cfg.Svix.RateLimit.App)
+		assert.Equal(t, []string{"prod=40:80"}, cfg.Svix.RateLimit.Projects)
+		assert.False(t, cfg.PubSub.Auth.Enabled)
+	})
+
+	t.Run("keeps the environment variable names", func(t *testing.T) {
+		t.Setenv("SVIX_AUTH_TOKEN", "testsk_token")
+		t.Setenv("PUBSUB_AUTH_AUDIENCE", "https://hookbro.example.com/notifications")
+		t.Setenv("SVIX_RETRY_CREATE_ENDPOINT_BUDGET", "20s")
+		t.Setenv("SVIX_RATE_LIMIT_GLOBAL_BURST", "50")
+		t.Setenv("PUBSUB_PULL_ACK_DEADLINE", "30s")
+		t.Setenv("OTEL_SERVICE_NAME", "hookbro-staging")
+		t.Setenv("LOG_REDACT_FIELDS", "email, iccid")
+
+		cfg, err := Load(nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, 20*time.Second, cfg.Svix.Retry.CreateEndpoint.Budget)
+		assert.Equal(t, 50, cfg.Svix.RateLimit.GlobalBurst)
+		assert.Equal(t, 30*time.Second, cfg.PubSub.Pull.AckDeadline)
+		assert.Equal(t, "hookbro-staging", cfg.Tracing.ServiceName)
+		assert.Equal(t, []string{"email", "iccid"}, cfg.Log.RedactFields)
+	})
+
+	t.Run("reports every invalid value with its source", func(t *testing.T) {
+		path := writeFile(t, "hookbro.yaml", `
+server:
+  port: eighty
+svix:
+  retyr:
+    attempts: 3
+`)
+		t.Setenv("TASK_TIMEOUT", "60")
+
+		_, err := Load([]string{"--config", path, "--svix-debug=maybe"})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, path+`: server.port: "eighty" is not a valid integer`)
+		assert.ErrorContains(t, err, path+": unknown setting svix.retyr.attempts")
+		assert.ErrorContains(t, err, "TASK_TIMEOUT=60 is not a valid duration")
+		assert.ErrorContains(t, err, "--svix-debug=maybe is not a valid bool")
+	})
+
+	t.Run("rejects unknown file formats and flags", func(t *testing.T) {
+		_, err := Load([]string{"--config", writeFile(t, "hookbro.json", "{}")})
+		assert.ErrorContains(t, err, `unsupported format ".json"`)
+
+		_, err = Load([]string{"--no-such-flag"})
+		assert.ErrorContains(t, err, "no-such-flag")
+	})
+
+	t.Run("validates the result", func(t *testing.T) {
+		_, err := Load(nil)
+		assert.ErrorContains(t, err, "svix.auth_token (SVIX_AUTH_TOKEN) is required")
+	})
+}
+
+func TestRetry_Policies(t *testing.T) {
+	retry := Default().Svix.Retry
+	retry.Attempts = 3
+	retry.SendMessage = RetryPolicy{Attempts: 8, Budget: time.Minute}
+
+	policies := retry.Policies()
+
+	fallback := svix.DefaultRetryPolicy
+	fallback.Attempts = 3
+	assert.Equal(t, fallback, policies["default"])
+	assert.Equal(t, fallback, policies[svix.OperationCreateEndpoint])
+	assert.Equal(t, svix.RetryPolicy{
+		Attempts:  8,
+		BaseDelay: fallback.BaseDelay,
+		MaxDelay:  fallback.MaxDelay,
+		Budget:    time.Minute,
+	}, policies[svix.OperationSendMessage])
+}
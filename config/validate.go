@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/markonick/gigs-challenge/internal/ingest"
+	"github.com/markonick/gigs-challenge/internal/logger"
+	"github.com/markonick/gigs-challenge/internal/svix"
+	"github.com/markonick/gigs-challenge/internal/tracing"
+	"github.com/rs/zerolog"
+)
+
+// Validate reports every invalid setting at once, each named by its config file key
+// and environment variable
+func (c Config) Validate() error {
+	v := validator{settings: c.settings()}
+
+	v.check(c.Server.Port > 0 && c.Server.Port <= 65535, &c.Server.Port, "must be a port between 1 and 65535")
+	v.positive(&c.Server.ShutdownTimeout)
+
+	v.oneOf(&c.Log.Format, logger.FormatJSON, logger.FormatConsole)
+	level, err := zerolog.ParseLevel(strings.ToLower(c.Log.Level))
+	v.check(err == nil && level != zerolog.NoLevel, &c.Log.Level, "must be trace, debug, info, warn or error")
+	v.notNegative(&c.Log.SampleBurst)
+	v.notNegative(&c.Log.SampleN)
+	v.positive(&c.Log.SamplePeriod)
+
+	v.oneOf(&c.Tracing.Exporter, tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP)
+	v.check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, &c.Tracing.SampleRatio, "must be between 0 and 1")
+
+	v.positive(&c.Worker.MaxWorkers)
+	v.notNegative(&c.Worker.QueueCapacity)
+	v.notNegative(&c.Worker.TaskTimeout)
+
+	v.check(c.Svix.AuthToken != "", &c.Svix.AuthToken, "is required")
+	if c.Svix.ServerURL != "" {
+		parsed, err := url.Parse(c.Svix.ServerURL)
+		v.check(err == nil && parsed.Scheme != "" && parsed.Host != "", &c.Svix.ServerURL, "must be an absolute URL")
+	}
+	v.positive(&c.Svix.HTTPTimeout)
+	v.positive(&c.Svix.SetupRetryDelay)
+	v.check(c.Svix.SetupMaxRetryDelay >= c.Svix.SetupRetryDelay, &c.Svix.SetupMaxRetryDelay, "must not be below %s", v.name(&c.Svix.SetupRetryDelay))
+
+	retry := &c.Svix.Retry
+	v.positive(&retry.Attempts)
+	v.positive(&retry.BaseDelay)
+	v.check(retry.MaxDelay >= retry.BaseDelay, &retry.MaxDelay, "must not be below %s", v.name(&retry.BaseDelay))
+	v.notNegative(&retry.Budget)
+	for _, override := range []*RetryPolicy{&retry.SendMessage, &retry.CreateEndpoint, &retry.CreateApplication, &retry.CreateEventType} {
+		v.notNegative(&override.Attempts)
+		v.notNegative(&override.BaseDelay)
+		v.notNegative(&override.MaxDelay)
+		v.notNegative(&override.Budget)
+	}
+
+	v.notNegative(&c.Svix.RateLimit.Global)
+	v.positive(&c.Svix.RateLimit.GlobalBurst)
+	v.notNegative(&c.Svix.RateLimit.App)
+	v.positive(&c.Svix.RateLimit.AppBurst)
+	_, err = svix.ParseRateLimits(c.Svix.RateLimit.Projects)
+	v.check(err == nil, &c.Svix.RateLimit.Projects, "%v", err)
+
+	v.notNegative(&c.Svix.Breaker.Threshold)
+	v.positive(&c.Svix.Breaker.OpenTimeout)
+
+	v.oneOf(&c.Idempotency.Store, "memory", "disk", "redis")
+	v.check(c.Idempotency.Store != "disk" || c.Idempotency.Path != "", &c.Idempotency.Path, "is required for the disk store")
+	v.check(c.Idempotency.Store != "redis" || c.Redis.URL != "", &c.Redis.URL, "is required for the redis store")
+	v.positive(&c.Idempotency.TTL)
+	v.positive(&c.Idempotency.InFlightTTL)
+	v.notNegative(&c.Idempotency.Capacity)
+
+	for _, store := range []*Store{&c.Outbox, &c.DeadLetter} {
+		v.oneOf(&store.Store, "disk", "memory")
+		v.check(store.Store != "disk" || store.Path != "", &store.Path, "is required for the disk store")
+	}
+
+	v.check(!c.PubSub.Auth.Enabled || c.PubSub.Auth.Audience != "", &c.PubSub.Auth.Audience, "is required when auth is enabled")
+	v.notNegative(&c.PubSub.Auth.ClockSkew)
+	if c.PubSub.Pull.Subscription != "" {
+		_, _, err := ingest.ParseSubscription(c.PubSub.Pull.Subscription)
+		v.check(err == nil, &c.PubSub.Pull.Subscription, "must be projects/{project}/subscriptions/{name}")
+		v.positive(&c.PubSub.Pull.MaxOutstanding)
+		v.positive(&c.PubSub.Pull.Streams)
+		deadline := c.PubSub.Pull.AckDeadline
+		v.check(deadline >= 10*time.Second && deadline <= 600*time.Second, &c.PubSub.Pull.AckDeadline, "must be between 10s and 600s")
+	}
+
+	v.positive(&c.Health.CheckTimeout)
+	v.notNegative(&c.Health.SvixPingInterval)
+
+	v.positive(&c.Admin.DebugDuration)
+	v.check(c.Admin.DebugMaxDuration >= c.Admin.DebugDuration, &c.Admin.DebugMaxDuration, "must not be below %s", v.name(&c.Admin.DebugDuration))
+
+	v.notNegative(&c.Watch.Interval)
+
+	if err := errors.Join(v.errs...); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return nil
+}
+
+// validator collects the errors of Validate, settings are passed as pointers into the
+// validated Config so that errors can name them
+type validator struct {
+	settings []setting
+	errs     []error
+}
+
+func (v *validator) check(ok bool, field interface{}, format string, args ...interface{}) {
+	if !ok {
+		v.errs = append(v.errs, fmt.Errorf("%s %s", v.name(field), fmt.Sprintf(format, args...)))
+	}
+}
+
+func (v *validator) positive(field interface{}) {
+	v.check(reflect.ValueOf(field).Elem().Convert(floatType).Float() > 0, field, "must be greater than 0")
+}
+
+func (v *validator) notNegative(field interface{}) {
+	v.check(reflect.ValueOf(field).Elem().Convert(floatType).Float() >= 0, field, "must not be negative")
+}
+
+func (v *validator) oneOf(field *string, values ...string) {
+	for _, value := range values {
+		if *field == value {
+			return
+		}
+	}
+	v.check(false, field, "must be one of %s", strings.Join(values, ", "))
+}
+
+var floatType = reflect.TypeOf(float64(0))
+
+// name returns the names of the setting field points to
+func (v *validator) name(field interface{}) string {
+	pointer := reflect.ValueOf(field)
+	for _, s := range v.settings {
+		if s.value.Addr().Pointer() == pointer.Pointer() && s.value.Type() == pointer.Elem().Type() {
+			return s.name()
+		}
+	}
+	panic(fmt.Sprintf("config: no setting at %v", field))
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	valid := func() Config {
+		cfg := Default()
+		cfg.Svix.AuthToken = "testsk_token"
+		cfg.PubSub.Auth.Audience = "https://hookbro.example.com/notifications"
+		return cfg
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		errs   []string
+	}{
+		{
+			name:   "defaults with a token",
+			modify: func(*Config) {},
+		},
+		{
+			name: "port out of range",
+			modify: func(c *Config) {
+				c.Server.Port = 70000
+			},
+			errs: []string{"server.port (PORT) must be a port between 1 and 65535"},
+		},
+		{
+			name: "no workers",
+			modify: func(c *Config) {
+				c.Worker.MaxWorkers = 0
+			},
+			errs: []string{"worker.max_workers (MAX_WORKERS) must be greater than 0"},
+		},
+		{
+			name: "retry delays",
+			modify: func(c *Config) {
+				c.Svix.Retry.MaxDelay = time.Millisecond
+				c.Svix.Retry.SendMessage.Budget = -time.Second
+			},
+			errs: []string{
+				"svix.retry.max_delay (SVIX_RETRY_MAX_DELAY) must not be below svix.retry.base_delay (SVIX_RETRY_BASE_DELAY)",
+				"svix.retry.send_message.budget (SVIX_RETRY_SEND_MESSAGE_BUDGET) must not be negative",
+			},
+		},
+		{
+			name: "project rate limits",
+			modify: func(c *Config) {
+				c.Svix.RateLimit.Projects = []string{"prod"}
+			},
+			errs: []string{"svix.rate_limit.projects (SVIX_RATE_LIMIT_PROJECTS)"},
+		},
+		{
+			name: "unknown backends and log settings",
+			modify: func(c *Config) {
+				c.Idempotency.Store = "postgres"
+				c.DeadLetter.Store = "s3"
+				c.Log.Level = "verbose"
+				c.Tracing.Exporter = "jaeger"
+			},
+			errs: []string{
+				"idempotency.store (IDEMPOTENCY_STORE) must be one of memory, disk, redis",
+				"deadletter.store (DEADLETTER_STORE) must be one of disk, memory",
+				"log.level (LOG_LEVEL) must be trace, debug, info, warn or error",
+				"tracing.exporter (TRACING_EXPORTER) must be one of none, stdout, otlp",
+			},
+		},
+		{
+			name: "relative Svix URL",
+			modify: func(c *Config) {
+				c.Svix.ServerURL = "svix.internal"
+			},
+			errs: []string{"svix.server_url (SVIX_SERVER_URL) must be an absolute URL"},
+		},
+		{
+			name: "push auth without an audience",
+			modify: func(c *Config) {
+				c.PubSub.Auth.Audience = ""
+			},
+			errs: []string{"pubsub.auth.audience (PUBSUB_AUTH_AUDIENCE) is required when auth is enabled"},
+		},
+		{
+			name: "no audience with push auth disabled",
+			modify: func(c *Config) {
+				c.PubSub.Auth.Enabled = false
+				c.PubSub.Auth.Audience = ""
+			},
+		},
+		{
+			name: "pull settings only matter with a subscription",
+			modify: func(c *Config) {
+				c.PubSub.Pull.Streams = 0
+			},
+		},
+		{
+			name: "pull streams",
+			modify: func(c *Config) {
+				c.PubSub.Pull.Subscription = "projects/p/subscriptions/s"
+				c.PubSub.Pull.Streams = 0
+			},
+			errs: []string{"pubsub.pull.streams (PUBSUB_PULL_STREAMS) must be greater than 0"},
+		},
+		{
+			name: "pull subscription and ack deadline",
+			modify: func(c *Config) {
+				c.PubSub.Pull.Subscription = "hookbro"
+				c.PubSub.Pull.AckDeadline = 5 * time.Second
+			},
+			errs: []string{
+				"pubsub.pull.subscription (PUBSUB_PULL_SUBSCRIPTION) must be projects/{project}/subscriptions/{name}",
+				"pubsub.pull.ack_deadline (PUBSUB_PULL_ACK_DEADLINE) must be between 10s and 600s",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.modify(&cfg)
+
+			err := cfg.Validate()
+			if len(tt.errs) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			for _, want := range tt.errs {
+				assert.ErrorContains(t, err, want)
+			}
+		})
+	}
+}
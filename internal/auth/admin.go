@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markonick/gigs-challenge/internal/utils"
+)
+
+// AdminAuthenticator guards the operator endpoints with a shared bearer token
+type AdminAuthenticator struct {
+	token []byte
+}
+
+// NewAdminAuthenticator returns nil when no token is configured, which
+// leaves the admin endpoints unregistered rather than open
+func NewAdminAuthenticator(token string) *AdminAuthenticator {
+	if token == "" {
+		return nil
+	}
+	return &AdminAuthenticator{token: []byte(token)}
+}
+
+// RequireAdmin rejects requests that do not carry the admin token
+func RequireAdmin(authenticator *AdminAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheme, token, found := strings.Cut(c.GetHeader("Authorization"), " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			utils.RespondWithError(c, utils.NewAuthError("Missing bearer token"))
+			c.Abort()
+			return
+		}
+
+		if authenticator == nil || subtle.ConstantTimeCompare([]byte(token), authenticator.token) != 1 {
+			utils.RespondWithError(c, utils.NewForbiddenError("Invalid admin token"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GoogleJWKSURL is where Google publishes the keys used to sign Pub/Sub push tokens
+const GoogleJWKSURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+// KeySource resolves the public key a token was signed with
+type KeySource interface {
+	PublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error)
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+const (
+	// jwksTTL is how long a loaded key set is trusted before it is loaded again
+	jwksTTL = time.Hour
+	// jwksMinRefreshInterval is the least time between two loads, however many unknown key IDs arrive
+	jwksMinRefreshInterval = 30 * time.Second
+	// unknownKidTTL is how long a key ID missing from a fresh key set is not looked up again
+	unknownKidTTL = 5 * time.Minute
+	// maxUnknownKids bounds the negative cache, the refresh interval still applies beyond it
+	maxUnknownKids = 1024
+)
+
+// jwksKeySource caches a JSON Web Key Set loaded from a URL or a local file.
+// The set is reloaded when it expires or when an unknown key ID is requested, at most once
+// per refresh interval. Key IDs missing from a freshly loaded set are remembered for a while
+// so that tokens with made up key IDs cannot make every request load the set.
+// Concurrent requests share a single load, which runs without holding the lock.
+type jwksKeySource struct {
+	load        func(ctx context.Context) ([]byte, error)
+	ttl         time.Duration
+	minInterval time.Duration
+	unknownTTL  time.Duration
+	now         func() time.Time
+
+	mu       sync.Mutex
+	keys     map[string]*rsa.PublicKey
+	loadedAt time.Time
+	// attemptedAt and loadErr describe the last load, successful or not
+	attemptedAt time.Time
+	loadErr     error
+	// unknown holds when a key ID was found missing from the current set
+	unknown map[string]time.Time
+	// refreshing is closed once the load in progress finishes, nil when none runs
+	refreshing chan struct{}
+}
+
+// NewKeySource creates a KeySource from a JWKS location.
+// The location is either an http(s) URL or a local file path, optionally prefixed with file://
+func NewKeySource(location string, client *http.Client) KeySource {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	source := &jwksKeySource{
+		ttl:         jwksTTL,
+		minInterval: jwksMinRefreshInterval,
+		unknownTTL:  unknownKidTTL,
+		now:         time.Now,
+		unknown:     make(map[string]time.Time),
+	}
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		source.load = func(ctx context.Context) ([]byte, error) {
+			return fetchJWKS(ctx, client, location)
+		}
+	} else {
+		path := strings.TrimPrefix(location, "file://")
+		source.load = func(_ context.Context) ([]byte, error) {
+			return os.ReadFile(path)
+		}
+	}
+	return source
+}
+
+func (s *jwksKeySource) PublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	s.mu.Lock()
+	now := s.now()
+	fresh := !s.loadedAt.IsZero() && now.Sub(s.loadedAt) < s.ttl
+	if key, ok := s.keys[kid]; ok && fresh {
+		s.mu.Unlock()
+		return key, nil
+	}
+	if missedAt, ok := s.unknown[kid]; ok && fresh && now.Sub(missedAt) < s.unknownTTL {
+		s.mu.Unlock()
+		return nil, unknownKidError(kid)
+	}
+	if !s.attemptedAt.IsZero() && now.Sub(s.attemptedAt) < s.minInterval {
+		defer s.mu.Unlock()
+		return s.lookupLocked(kid, now)
+	}
+
+	done := s.refreshing
+	if done == nil {
+		done = make(chan struct{})
+		s.refreshing = done
+		s.mu.Unlock()
+		s.refresh(ctx, done)
+	} else {
+		s.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lookupLocked(kid, s.now())
+}
+
+// lookupLocked returns the key from the current set, remembering key IDs it does not hold.
+// A key that outlived the TTL is still used while loading the set again fails.
+func (s *jwksKeySource) lookupLocked(kid string, now time.Time) (*rsa.PublicKey, error) {
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+	if s.loadErr != nil {
+		return nil, s.loadErr
+	}
+
+	if len(s.unknown) >= maxUnknownKids {
+		for id, missedAt := range s.unknown {
+			if now.Sub(missedAt) >= s.unknownTTL {
+				delete(s.unknown, id)
+			}
+		}
+	}
+	if len(s.unknown) < maxUnknownKids {
+		s.unknown[kid] = now
+	}
+	return nil, unknownKidError(kid)
+}
+
+// refresh loads the key set and closes done, the caller must have set refreshing to done.
+// The load is shared with other requests, so it is not cut short when ctx is cancelled.
+func (s *jwksKeySource) refresh(ctx context.Context, done chan struct{}) {
+	keys, err := s.fetch(context.WithoutCancel(ctx))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.attemptedAt = now
+	s.loadErr = err
+	if err == nil {
+		s.keys = keys
+		s.loadedAt = now
+		s.unknown = make(map[string]time.Time)
+	}
+	s.refreshing = nil
+	close(done)
+}
+
+func (s *jwksKeySource) fetch(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	raw, err := s.load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWKS: %w", err)
+	}
+
+	var set jwkSet
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		key, err := k.rsaPublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q in JWKS: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func unknownKidError(kid string) error {
+	return fmt.Errorf("no signing key found for kid %q", kid)
+}
+
+func (k jwk) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+func fetchJWKS(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	return io.ReadAll(resp.Body)
+}
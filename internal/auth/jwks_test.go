@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingKeySource loads the key set from a file, counting the loads, with a clock the test moves
+func countingKeySource(t *testing.T, release chan struct{}) (*jwksKeySource, *int32, *time.Time) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	raw, err := os.ReadFile(writeJWKS(t, &key.PublicKey))
+	require.NoError(t, err)
+
+	var loads int32
+	now := time.Now()
+	source := NewKeySource("jwks.json", nil).(*jwksKeySource)
+	source.now = func() time.Time { return now }
+	source.load = func(context.Context) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		if release != nil {
+			<-release
+		}
+		return raw, nil
+	}
+	return source, &loads, &now
+}
+
+func TestKeySource_PublicKey(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("unknown key IDs do not load the set on every request", func(t *testing.T) {
+		source, loads, now := countingKeySource(t, nil)
+
+		_, err := source.PublicKey(ctx, testKid)
+		require.NoError(t, err)
+		for i := 0; i < 10; i++ {
+			_, err := source.PublicKey(ctx, "made-up")
+			assert.Error(t, err)
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(loads), "within the refresh interval")
+
+		*now = now.Add(jwksMinRefreshInterval)
+		_, err = source.PublicKey(ctx, "made-up")
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(loads), "a missing key ID is remembered")
+
+		_, err = source.PublicKey(ctx, "other-made-up")
+		assert.Error(t, err)
+		assert.Equal(t, int32(2), atomic.LoadInt32(loads), "a new key ID loads once the interval passed")
+
+		*now = now.Add(jwksTTL)
+		_, err = source.PublicKey(ctx, testKid)
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(loads), "an expired set is loaded again")
+	})
+
+	t.Run("concurrent requests share one load", func(t *testing.T) {
+		release := make(chan struct{})
+		source, loads, _ := countingKeySource(t, release)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := source.PublicKey(ctx, testKid)
+				assert.NoError(t, err)
+			}()
+		}
+		require.Eventually(t, func() bool { return atomic.LoadInt32(loads) == 1 }, time.Second, time.Millisecond)
+		close(release)
+		wg.Wait()
+		assert.Equal(t, int32(1), atomic.LoadInt32(loads))
+	})
+
+	t.Run("keeps using the expired set while loading fails", func(t *testing.T) {
+		source, _, now := countingKeySource(t, nil)
+		_, err := source.PublicKey(ctx, testKid)
+		require.NoError(t, err)
+
+		source.load = func(context.Context) ([]byte, error) { return nil, errors.New("connection refused") }
+		*now = now.Add(jwksTTL)
+		key, err := source.PublicKey(ctx, testKid)
+		require.NoError(t, err)
+		assert.NotNil(t, key)
+
+		_, err = source.PublicKey(ctx, "made-up")
+		assert.ErrorContains(t, err, "connection refused")
+	})
+}
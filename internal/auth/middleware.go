@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markonick/gigs-challenge/internal/logger"
+	"github.com/markonick/gigs-challenge/internal/utils"
+)
+
+// RequirePubSubToken rejects requests without a valid Pub/Sub push token.
+// A nil verifier disables authentication.
+func RequirePubSubToken(verifier *Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if verifier == nil {
+			c.Next()
+			return
+		}
+
+		authorization := c.GetHeader("Authorization")
+		scheme, token, found := strings.Cut(authorization, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			utils.RespondWithError(c, utils.NewAuthError("Missing bearer token"))
+			c.Abort()
+			return
+		}
+
+		claims, err := verifier.Verify(c.Request.Context(), token)
+		if err != nil {
+			utils.RespondWithError(c, err)
+			c.Abort()
+			return
+		}
+
+		logger.Log.Debug().
+			Str("email", claims.Email).
+			Str("subject", claims.Subject).
+			Msg("Authenticated Pub/Sub push request")
+		c.Next()
+	}
+}
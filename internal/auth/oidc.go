@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/markonick/gigs-challenge/internal/logger"
+	"github.com/markonick/gigs-challenge/internal/utils"
+)
+
+// GoogleIssuers are the issuers Google uses for Pub/Sub push tokens
+var GoogleIssuers = []string{"accounts.google.com", "https://accounts.google.com"}
+
+// Config describes which Pub/Sub push tokens are accepted
+type Config struct {
+	// Audience is the audience configured on the push subscription
+	Audience string
+	// ServiceAccountEmail is the service account the subscription pushes as
+	ServiceAccountEmail string
+	// Issuers that are trusted, defaults to GoogleIssuers
+	Issuers []string
+	// ClockSkew tolerated when checking exp, iat and nbf
+	ClockSkew time.Duration
+}
+
+// Claims are the OIDC token claims relevant for Pub/Sub push authentication
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Audience      audience `json:"aud"`
+	Subject       string   `json:"sub"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	ExpiresAt     int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	NotBefore     int64    `json:"nbf,omitempty"`
+}
+
+// audience accepts both the single string and the array form of the aud claim
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+func (a audience) contains(value string) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verifier validates the OIDC tokens Pub/Sub attaches to push requests
+type Verifier struct {
+	config Config
+	keys   KeySource
+	now    func() time.Time
+}
+
+func NewVerifier(config Config, keys KeySource) (*Verifier, error) {
+	if config.Audience == "" {
+		return nil, fmt.Errorf("pub/sub push audience is required")
+	}
+	if len(config.Issuers) == 0 {
+		config.Issuers = GoogleIssuers
+	}
+	return &Verifier{
+		config: config,
+		keys:   keys,
+		now:    time.Now,
+	}, nil
+}
+
+// Verify checks the token signature and claims.
+// Malformed, expired or badly signed tokens result in an AuthError,
+// valid tokens issued for someone else result in a ForbiddenError.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, utils.NewAuthError("Malformed bearer token")
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, utils.NewAuthError("Malformed token header")
+	}
+	if h.Alg != "RS256" {
+		return nil, utils.NewAuthError(fmt.Sprintf("Unsupported token algorithm %q", h.Alg))
+	}
+
+	key, err := v.keys.PublicKey(ctx, h.Kid)
+	if err != nil {
+		logger.Ctx(ctx).Warn().
+			Err(err).
+			Str("kid", h.Kid).
+			Msg("Unable to resolve token signing key")
+		return nil, utils.NewAuthError("Unable to resolve token signing key")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, utils.NewAuthError("Malformed token signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, utils.NewAuthError("Invalid token signature")
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, utils.NewAuthError("Malformed token claims")
+	}
+
+	if err := v.validateClaims(&claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+func (v *Verifier) validateClaims(claims *Claims) error {
+	now := v.now()
+	skew := v.config.ClockSkew
+
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(skew)) {
+		return utils.NewAuthError("Token has expired")
+	}
+	if claims.IssuedAt != 0 && now.Add(skew).Before(time.Unix(claims.IssuedAt, 0)) {
+		return utils.NewAuthError("Token used before issued")
+	}
+	if claims.NotBefore != 0 && now.Add(skew).Before(time.Unix(claims.NotBefore, 0)) {
+		return utils.NewAuthError("Token is not valid yet")
+	}
+
+	issuerTrusted := false
+	for _, issuer := range v.config.Issuers {
+		if claims.Issuer == issuer {
+			issuerTrusted = true
+			break
+		}
+	}
+	if !issuerTrusted {
+		return utils.NewAuthError(fmt.Sprintf("Untrusted token issuer %q", claims.Issuer))
+	}
+
+	if !claims.Audience.contains(v.config.Audience) {
+		return utils.NewForbiddenError("Token audience does not match")
+	}
+
+	if v.config.ServiceAccountEmail != "" {
+		if claims.Email != v.config.ServiceAccountEmail || !claims.EmailVerified {
+			return utils.NewForbiddenError("Token was not issued to the expected service account")
+		}
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
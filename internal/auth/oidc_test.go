@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/utils"
+)
+
+const (
+	testKid      = "test-key"
+	testAudience = "https://hookbro.example.com/notifications"
+	testEmail    = "pubsub-push@gigs.iam.gserviceaccount.com"
+)
+
+func writeJWKS(t *testing.T, key *rsa.PublicKey) string {
+	t.Helper()
+	set := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": testKid,
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+	raw, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, raw, 0o600))
+	return path
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		raw, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+
+	signingInput := encode(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":            "https://accounts.google.com",
+		"aud":            testAudience,
+		"sub":            "1234567890",
+		"email":          testEmail,
+		"email_verified": true,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	verifier, err := NewVerifier(Config{
+		Audience:            testAudience,
+		ServiceAccountEmail: testEmail,
+	}, NewKeySource("file://"+writeJWKS(t, &key.PublicKey), nil))
+	require.NoError(t, err)
+
+	with := func(field string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		claims[field] = value
+		return claims
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{
+			name:       "valid token",
+			token:      signToken(t, key, testKid, validClaims()),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "audience as array",
+			token:      signToken(t, key, testKid, with("aud", []string{"other", testAudience})),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "malformed token",
+			token:      "not-a-jwt",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "signed with unknown key",
+			token:      signToken(t, otherKey, testKid, validClaims()),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unknown key ID",
+			token:      signToken(t, key, "rotated-away", validClaims()),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "expired token",
+			token:      signToken(t, key, testKid, with("exp", time.Now().Add(-time.Hour).Unix())),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "untrusted issuer",
+			token:      signToken(t, key, testKid, with("iss", "https://evil.example.com")),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong audience",
+			token:      signToken(t, key, testKid, with("aud", "https://other.example.com")),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "wrong service account",
+			token:      signToken(t, key, testKid, with("email", "someone@example.com")),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "unverified email",
+			token:      signToken(t, key, testKid, with("email_verified", false)),
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.POST("/notifications", RequirePubSubToken(verifier), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/notifications", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestRequirePubSubToken_MissingHeader(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	verifier, err := NewVerifier(Config{Audience: testAudience},
+		NewKeySource(writeJWKS(t, &key.PublicKey), nil))
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/notifications", RequirePubSubToken(verifier), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/notifications", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestNewVerifier_RequiresAudience(t *testing.T) {
+	_, err := NewVerifier(Config{}, NewKeySource("jwks.json", nil))
+	assert.Error(t, err)
+
+	// The key source is only consulted on verification
+	_, err = NewKeySource("missing.json", nil).PublicKey(context.Background(), testKid)
+	assert.Error(t, err)
+}
+
+func TestVerifier_Verify_HidesKeyErrors(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	verifier, err := NewVerifier(Config{Audience: testAudience}, NewKeySource("file://"+writeJWKS(t, &key.PublicKey), nil))
+	require.NoError(t, err)
+
+	_, err = verifier.Verify(context.Background(), signToken(t, key, "rotated-away", validClaims()))
+	var authErr *utils.AuthError
+	require.ErrorAs(t, err, &authErr)
+	assert.Equal(t, "Unable to resolve token signing key", authErr.Detail)
+}
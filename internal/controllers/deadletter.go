@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markonick/gigs-challenge/internal/services"
+	"github.com/markonick/gigs-challenge/internal/utils"
+)
+
+type ReplayRequest struct {
+	IDs        []string `json:"ids"`
+	ErrorClass string   `json:"error_class"`
+	Project    string   `json:"project"`
+	// All must be set to replay every dead letter without a filter
+	All bool `json:"all"`
+}
+
+type ReplayResponse struct {
+	Results []services.ReplayResult `json:"results"`
+}
+
+type PurgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+// DeadLetterController exposes the dead letter store to operators
+type DeadLetterController struct {
+	deadLetters services.DeadLetterService
+}
+
+func NewDeadLetterController(deadLetters services.DeadLetterService) *DeadLetterController {
+	return &DeadLetterController{
+		deadLetters: deadLetters,
+	}
+}
+
+func (c *DeadLetterController) List(ctx *gin.Context) {
+	filter, err := queryFilter(ctx)
+	if err != nil {
+		utils.RespondWithError(ctx, err)
+		return
+	}
+
+	entries, err := c.deadLetters.List(ctx.Request.Context(), filter)
+	if err != nil {
+		utils.RespondWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, entries)
+}
+
+func (c *DeadLetterController) Get(ctx *gin.Context) {
+	entry, err := c.deadLetters.Get(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		utils.RespondWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, entry)
+}
+
+func (c *DeadLetterController) ReplayOne(ctx *gin.Context) {
+	c.replay(ctx, services.DeadLetterFilter{EventIDs: []string{ctx.Param("id")}})
+}
+
+func (c *DeadLetterController) Replay(ctx *gin.Context) {
+	var request ReplayRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		utils.RespondWithError(ctx, utils.NewValidationError("body", "Invalid replay request"))
+		return
+	}
+	if len(request.IDs) == 0 && request.ErrorClass == "" && request.Project == "" && !request.All {
+		utils.RespondWithError(ctx, utils.NewValidationError("ids", "Provide ids, error_class or project, or set all to replay everything"))
+		return
+	}
+
+	c.replay(ctx, services.DeadLetterFilter{
+		EventIDs:   request.IDs,
+		ErrorClass: request.ErrorClass,
+		Project:    request.Project,
+	})
+}
+
+func (c *DeadLetterController) replay(ctx *gin.Context, filter services.DeadLetterFilter) {
+	results, err := c.deadLetters.Replay(ctx.Request.Context(), filter)
+	if err != nil {
+		utils.RespondWithError(ctx, err)
+		return
+	}
+
+	// A single unknown ID is a plain 404, batches report per entry
+	if len(results) == 1 && len(filter.EventIDs) == 1 && results[0].Status == services.ReplayNotFound {
+		utils.RespondWithError(ctx, utils.NewNotFoundError("No dead letter for event "+filter.EventIDs[0]))
+		return
+	}
+	ctx.JSON(http.StatusOK, ReplayResponse{Results: results})
+}
+
+func (c *DeadLetterController) Delete(ctx *gin.Context) {
+	purged, err := c.deadLetters.Purge(ctx.Request.Context(), services.DeadLetterFilter{EventIDs: []string{ctx.Param("id")}})
+	if err != nil {
+		utils.RespondWithError(ctx, err)
+		return
+	}
+	if purged == 0 {
+		utils.RespondWithError(ctx, utils.NewNotFoundError("No dead letter for event "+ctx.Param("id")))
+		return
+	}
+	ctx.JSON(http.StatusOK, PurgeResponse{Purged: purged})
+}
+
+// Purge deletes the dead letters matching the query, all of them only with all=true
+func (c *DeadLetterController) Purge(ctx *gin.Context) {
+	filter, err := queryFilter(ctx)
+	if err != nil {
+		utils.RespondWithError(ctx, err)
+		return
+	}
+	if filter.ErrorClass == "" && filter.Project == "" && ctx.Query("all") != "true" {
+		utils.RespondWithError(ctx, utils.NewValidationError("all", "Provide error_class or project, or set all=true to purge everything"))
+		return
+	}
+
+	purged, err := c.deadLetters.Purge(ctx.Request.Context(), filter)
+	if err != nil {
+		utils.RespondWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, PurgeResponse{Purged: purged})
+}
+
+func queryFilter(ctx *gin.Context) (services.DeadLetterFilter, error) {
+	filter := services.DeadLetterFilter{
+		ErrorClass: ctx.Query("error_class"),
+		Project:    ctx.Query("project"),
+	}
+	if raw := ctx.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			return filter, utils.NewValidationError("limit", "limit must be a positive number")
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/services"
+)
+
+type MockDeadLetterService struct {
+	mock.Mock
+}
+
+func (m *MockDeadLetterService) List(_ context.Context, filter services.DeadLetterFilter) ([]models.DeadLetter, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]models.DeadLetter), args.Error(1)
+}
+
+func (m *MockDeadLetterService) Get(_ context.Context, eventID string) (models.DeadLetter, error) {
+	args := m.Called(eventID)
+	return args.Get(0).(models.DeadLetter), args.Error(1)
+}
+
+func (m *MockDeadLetterService) Replay(_ context.Context, filter services.DeadLetterFilter) ([]services.ReplayResult, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]services.ReplayResult), args.Error(1)
+}
+
+func (m *MockDeadLetterService) Purge(_ context.Context, filter services.DeadLetterFilter) (int, error) {
+	args := m.Called(filter)
+	return args.Int(0), args.Error(1)
+}
+
+func TestDeadLetterController_Purge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		path       string
+		filter     *services.DeadLetterFilter
+		wantStatus int
+	}{
+		{
+			name:       "by error class",
+			path:       "/admin/deadletters?error_class=retries_exhausted",
+			filter:     &services.DeadLetterFilter{ErrorClass: "retries_exhausted"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "by project",
+			path:       "/admin/deadletters?project=dev",
+			filter:     &services.DeadLetterFilter{Project: "dev"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "everything",
+			path:       "/admin/deadletters?all=true",
+			filter:     &services.DeadLetterFilter{},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "without a filter",
+			path:       "/admin/deadletters",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "with only a limit",
+			path:       "/admin/deadletters?limit=10",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deadLetters := new(MockDeadLetterService)
+			if tt.filter != nil {
+				deadLetters.On("Purge", *tt.filter).Return(2, nil)
+			}
+			router := gin.New()
+			router.DELETE("/admin/deadletters", NewDeadLetterController(deadLetters).Purge)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, tt.path, nil))
+
+			assert.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			deadLetters.AssertExpectations(t)
+			if tt.filter == nil {
+				deadLetters.AssertNotCalled(t, "Purge", mock.Anything)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markonick/gigs-challenge/internal/health"
+)
+
+// HealthController serves the liveness, readiness and health endpoints from the registered checks
+type HealthController struct {
+	checker *health.Checker
+}
+
+func NewHealthController(checker *health.Checker) *HealthController {
+	return &HealthController{
+		checker: checker,
+	}
+}
+
+// Live answers as long as the process can serve requests, it runs no checks
+func (c *HealthController) Live(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, health.Report{Status: health.StatusUp})
+}
+
+// Ready answers 503 while a readiness check is down, so no traffic is routed here
+func (c *HealthController) Ready(ctx *gin.Context) {
+	c.respond(ctx, c.checker.Ready(ctx.Request.Context()))
+}
+
+// Health reports every check with its details. It answers 503 while a readiness check
+// is down, a degraded report is still answered with 200.
+func (c *HealthController) Health(ctx *gin.Context) {
+	c.respond(ctx, c.checker.Health(ctx.Request.Context()))
+}
+
+func (c *HealthController) respond(ctx *gin.Context, report health.Report) {
+	status := http.StatusOK
+	if report.Status == health.StatusDown {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.JSON(status, report)
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/health"
+)
+
+func TestHealthController(t *testing.T) {
+	failing := func(_ context.Context) health.Result { return health.Down(errors.New("unreachable"), nil) }
+	passing := func(_ context.Context) health.Result { return health.Up(map[string]int{"active": 1}) }
+
+	tests := []struct {
+		name       string
+		register   func(checker *health.Checker)
+		path       string
+		wantStatus int
+		wantReport health.Status
+	}{
+		{
+			name:       "liveness ignores failing checks",
+			register:   func(c *health.Checker) { c.RegisterReadiness("svix", failing) },
+			path:       "/healthz",
+			wantStatus: http.StatusOK,
+			wantReport: health.StatusUp,
+		},
+		{
+			name:       "not ready while a readiness check fails",
+			register:   func(c *health.Checker) { c.RegisterReadiness("svix", failing) },
+			path:       "/readyz",
+			wantStatus: http.StatusServiceUnavailable,
+			wantReport: health.StatusDown,
+		},
+		{
+			name:       "ready",
+			register:   func(c *health.Checker) { c.RegisterReadiness("worker_pool", passing) },
+			path:       "/readyz",
+			wantStatus: http.StatusOK,
+			wantReport: health.StatusUp,
+		},
+		{
+			name: "degraded health is still served",
+			register: func(c *health.Checker) {
+				c.RegisterReadiness("worker_pool", passing)
+				c.Register("cache", failing)
+			},
+			path:       "/health",
+			wantStatus: http.StatusOK,
+			wantReport: health.StatusDegraded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			checker := health.NewChecker(0)
+			tt.register(checker)
+			controller := NewHealthController(checker)
+
+			router := gin.New()
+			router.GET("/healthz", controller.Live)
+			router.GET("/readyz", controller.Ready)
+			router.GET("/health", controller.Health)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			var report health.Report
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+			assert.Equal(t, tt.wantReport, report.Status)
+		})
+	}
+}
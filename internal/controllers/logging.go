@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markonick/gigs-challenge/internal/logger"
+	"github.com/markonick/gigs-challenge/internal/utils"
+	"github.com/rs/zerolog"
+)
+
+type LevelRequest struct {
+	Level string `json:"level"`
+}
+
+type DebugRequest struct {
+	Project   string `json:"project"`
+	EventType string `json:"event_type"`
+	// Duration is how long debug logging stays on, e.g. "15m"
+	Duration string `json:"duration"`
+}
+
+type LoggingResponse struct {
+	Level       string                    `json:"level"`
+	DebugScopes []logger.ActiveDebugScope `json:"debug_scopes"`
+}
+
+// LoggingController lets operators change what is logged without a redeploy
+type LoggingController struct {
+	config logger.DebugConfig
+}
+
+func NewLoggingController(config logger.DebugConfig) *LoggingController {
+	return &LoggingController{
+		config: config,
+	}
+}
+
+// Get returns the level and the scopes with debug logging enabled
+func (c *LoggingController) Get(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, loggingResponse())
+}
+
+// SetLevel changes the level of every logger
+func (c *LoggingController) SetLevel(ctx *gin.Context) {
+	var request LevelRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		utils.RespondWithError(ctx, utils.NewValidationError("body", "Invalid level request"))
+		return
+	}
+	level, err := zerolog.ParseLevel(strings.ToLower(request.Level))
+	if err != nil || level == zerolog.NoLevel || level > zerolog.ErrorLevel {
+		utils.RespondWithError(ctx, utils.NewValidationError("level", "level must be trace, debug, info, warn or error"))
+		return
+	}
+
+	previous := logger.Level()
+	logger.SetLevel(level)
+	logger.Log.Warn().
+		Stringer("level", level).
+		Stringer("previous", previous).
+		Msg("Log level changed")
+	ctx.JSON(http.StatusOK, loggingResponse())
+}
+
+// EnableDebug writes debug lines for the events of a project or type for a limited time
+func (c *LoggingController) EnableDebug(ctx *gin.Context) {
+	var request DebugRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		utils.RespondWithError(ctx, utils.NewValidationError("body", "Invalid debug request"))
+		return
+	}
+	if request.Project == "" && request.EventType == "" {
+		utils.RespondWithError(ctx, utils.NewValidationError("project", "Provide project or event_type, or change the level to debug everything"))
+		return
+	}
+
+	duration := c.config.DefaultDuration
+	if request.Duration != "" {
+		parsed, err := time.ParseDuration(request.Duration)
+		if err != nil || parsed <= 0 || parsed > c.config.MaxDuration {
+			utils.RespondWithError(ctx, utils.NewValidationError("duration",
+				"duration must be a positive duration of at most "+c.config.MaxDuration.String()))
+			return
+		}
+		duration = parsed
+	}
+
+	scope := logger.DebugScope{Project: request.Project, EventType: request.EventType}
+	until := time.Now().Add(duration)
+	logger.EnableDebug(scope, until)
+	logger.Log.Warn().
+		Str("project", scope.Project).
+		Str("event_type", scope.EventType).
+		Time("until", until).
+		Msg("Debug logging enabled")
+	ctx.JSON(http.StatusOK, loggingResponse())
+}
+
+// DisableDebug ends debug logging for the scope in the query
+func (c *LoggingController) DisableDebug(ctx *gin.Context) {
+	scope := logger.DebugScope{Project: ctx.Query("project"), EventType: ctx.Query("event_type")}
+	if !logger.DisableDebug(scope) {
+		utils.RespondWithError(ctx, utils.NewNotFoundError("Debug logging is not enabled for this scope"))
+		return
+	}
+	logger.Log.Warn().
+		Str("project", scope.Project).
+		Str("event_type", scope.EventType).
+		Msg("Debug logging disabled")
+	ctx.JSON(http.StatusOK, loggingResponse())
+}
+
+func loggingResponse() LoggingResponse {
+	return LoggingResponse{
+		Level:       logger.Level().String(),
+		DebugScopes: logger.DebugScopes(),
+	}
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/logger"
+)
+
+func TestLoggingController(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	previous := logger.Level()
+	t.Cleanup(func() {
+		logger.SetLevel(previous)
+		for _, scope := range logger.DebugScopes() {
+			logger.DisableDebug(scope.DebugScope)
+		}
+	})
+
+	controller := NewLoggingController(logger.DefaultDebugConfig)
+	router := gin.New()
+	router.GET("/admin/logging", controller.Get)
+	router.PUT("/admin/logging/level", controller.SetLevel)
+	router.POST("/admin/logging/debug", controller.EnableDebug)
+	router.DELETE("/admin/logging/debug", controller.DisableDebug)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantLevel  string
+		wantScopes int
+	}{
+		{
+			name:       "change the level",
+			method:     http.MethodPut,
+			path:       "/admin/logging/level",
+			body:       `{"level": "WARN"}`,
+			wantStatus: http.StatusOK,
+			wantLevel:  "warn",
+		},
+		{
+			name:       "unknown level",
+			method:     http.MethodPut,
+			path:       "/admin/logging/level",
+			body:       `{"level": "panic"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "debug a project",
+			method:     http.MethodPost,
+			path:       "/admin/logging/debug",
+			body:       `{"project": "dev", "duration": "10m"}`,
+			wantStatus: http.StatusOK,
+			wantLevel:  "warn",
+			wantScopes: 1,
+		},
+		{
+			name:       "debug an event type for the default duration",
+			method:     http.MethodPost,
+			path:       "/admin/logging/debug",
+			body:       `{"event_type": "subscription.activated"}`,
+			wantStatus: http.StatusOK,
+			wantLevel:  "warn",
+			wantScopes: 2,
+		},
+		{
+			name:       "debug without a scope",
+			method:     http.MethodPost,
+			path:       "/admin/logging/debug",
+			body:       `{"duration": "10m"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "debug for too long",
+			method:     http.MethodPost,
+			path:       "/admin/logging/debug",
+			body:       `{"project": "dev", "duration": "24h"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "stop debugging a project",
+			method:     http.MethodDelete,
+			path:       "/admin/logging/debug?project=dev",
+			wantStatus: http.StatusOK,
+			wantLevel:  "warn",
+			wantScopes: 1,
+		},
+		{
+			name:       "stop debugging a scope that is not enabled",
+			method:     http.MethodDelete,
+			path:       "/admin/logging/debug?project=prod",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "current settings",
+			method:     http.MethodGet,
+			path:       "/admin/logging",
+			wantStatus: http.StatusOK,
+			wantLevel:  "warn",
+			wantScopes: 1,
+		},
+	}
+
+	// The cases build on each other
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response LoggingResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.wantLevel, response.Level)
+			assert.Len(t, response.DebugScopes, tt.wantScopes)
+		})
+	}
+	assert.Equal(t, zerolog.WarnLevel, logger.Level())
+}
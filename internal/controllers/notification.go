@@ -4,8 +4,11 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/markonick/gigs-challenge/internal/services"
+	"github.com/markonick/gigs-challenge/internal/ingest"
+	"github.com/markonick/gigs-challenge/internal/metrics"
+	"github.com/markonick/gigs-challenge/internal/tracing"
 	"github.com/markonick/gigs-challenge/internal/utils"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type NotificationResponse struct {
@@ -15,26 +18,52 @@ type NotificationResponse struct {
 	Error   string      `json:"error,omitempty"`
 	Details interface{} `json:"details,omitempty"`
 }
+
+// NotificationController is the HTTP push ingestion source
 type NotificationController struct {
-	taskService services.TaskService
+	dispatcher *ingest.Dispatcher
 }
 
-func NewNotificationController(taskService services.TaskService) *NotificationController {
+func NewNotificationController(dispatcher *ingest.Dispatcher) *NotificationController {
 	return &NotificationController{
-		taskService: taskService,
+		dispatcher: dispatcher,
 	}
 }
 
 func (c *NotificationController) Create(ctx *gin.Context) {
+	metrics.NotificationsReceived.WithLabelValues(pushSource).Inc()
+
 	gigsEvent, err := ParsePubSubMessage(ctx)
+
+	// The publisher's trace context in the Pub/Sub attributes wins over the one of the push request
+	spanCtx := tracing.FromHeader(ctx.Request.Context(), ctx.Request.Header)
+	if gigsEvent.PubSub != nil {
+		spanCtx = tracing.FromAttributes(spanCtx, gigsEvent.PubSub.Attributes)
+	}
+	spanCtx, span := tracing.Start(spanCtx, "POST /notifications",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(tracing.EventAttributes(gigsEvent)...))
+	defer func() { tracing.End(span, err) }()
+
 	if err != nil {
-		utils.RespondWithError(ctx, err)
+		reject(ctx, err)
 		return
 	}
 
-	err = c.taskService.ProcessEvent(gigsEvent)
+	result, err := c.dispatcher.Dispatch(spanCtx, gigsEvent)
 	if err != nil {
-		utils.RespondWithError(ctx, err)
+		reject(ctx, err)
+		return
+	}
+
+	// Already delivered, answer with the original result so Pub/Sub stops redelivering
+	if result.Duplicate {
+		ctx.JSON(http.StatusOK, NotificationResponse{
+			TaskID:  gigsEvent.ID,
+			EventID: gigsEvent.ID,
+			Status:  result.Record.Status,
+			Details: result.Record,
+		})
 		return
 	}
 
@@ -45,3 +74,12 @@ func (c *NotificationController) Create(ctx *gin.Context) {
 		Status:  "accepted",
 	})
 }
+
+// pushSource labels the metrics of notifications pushed over HTTP
+const pushSource = "push"
+
+// reject counts the notification as rejected and answers the error
+func reject(ctx *gin.Context, err error) {
+	metrics.NotificationsRejected.WithLabelValues(pushSource, utils.ErrorClass(err)).Inc()
+	utils.RespondWithError(ctx, err)
+}
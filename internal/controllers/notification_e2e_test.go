@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/markonick/gigs-challenge/internal/deadletter"
+	"github.com/markonick/gigs-challenge/internal/idempotency"
+	"github.com/markonick/gigs-challenge/internal/ingest"
+	"github.com/markonick/gigs-challenge/internal/metrics"
+	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/outbox"
+	"github.com/markonick/gigs-challenge/internal/services"
+	"github.com/markonick/gigs-challenge/internal/svix"
+	"github.com/markonick/gigs-challenge/internal/svix/svixtest"
+	"github.com/markonick/gigs-challenge/internal/tasks"
+	"github.com/markonick/gigs-challenge/internal/tracing"
+	"github.com/markonick/gigs-challenge/internal/utils"
+	"github.com/markonick/gigs-challenge/internal/worker"
+)
+
+// deliveryPipeline wires the notification controller to a fake Svix server
+// through the real dispatcher, task service, worker pool and webhook task
+type deliveryPipeline struct {
+	router      *gin.Engine
+	svix        *svixtest.Server
+	appID       string
+	registry    *svix.ProjectRegistry
+	deadLetters *deadletter.MemoryStore
+}
+
+func newDeliveryPipeline(t *testing.T) *deliveryPipeline {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	server := svixtest.NewServer()
+	t.Cleanup(server.Close)
+	appID := server.AddApplication("gigs-webhook-service-test", "")
+
+	policy := svix.RetryPolicy{Attempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	client, err := svix.NewClient("testsk_token", svix.Config{
+		ServerURL: server.URL,
+		Retry:     svix.RetryPolicies{"default": policy},
+	})
+	require.NoError(t, err)
+
+	pool := worker.NewPool(worker.Config{MaxWorkers: 2, QueueCapacity: 10})
+	t.Cleanup(pool.Close)
+	registry := svix.NewProjectRegistry(client, svix.RegistryConfig{
+		Projects:   []string{"test"},
+		RetryDelay: 10 * time.Millisecond,
+	})
+	createTask := func(event models.BaseEvent) worker.Task {
+		return tasks.NewWebhookTask(event, client, registry)
+	}
+
+	deadLetters := deadletter.NewMemoryStore()
+	taskService := services.NewTaskService(
+		pool,
+		createTask,
+		idempotency.NewMemoryStore(idempotency.Options{}),
+		outbox.NewMemoryOutbox(),
+		deadLetters,
+	)
+
+	router := gin.New()
+	admit := func(event models.BaseEvent) error { return registry.Admit(event.Project) }
+	router.POST("/notifications", NewNotificationController(ingest.NewDispatcher(taskService, admit)).Create)
+	return &deliveryPipeline{router: router, svix: server, appID: appID, registry: registry, deadLetters: deadLetters}
+}
+
+// start sets the Svix applications up in the background and waits until they are
+func (p *deliveryPipeline) start(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go p.registry.Run(ctx)
+	require.Eventually(t, p.registry.Ready, 2*time.Second, 10*time.Millisecond)
+}
+
+func (p *deliveryPipeline) post(body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/notifications", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	p.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestNotificationController_DeliversToSvix(t *testing.T) {
+	p := newDeliveryPipeline(t)
+	p.start(t)
+
+	assert.Equal(t, http.StatusAccepted, p.post(pushRequestBody).Code)
+	require.Eventually(t, func() bool { return len(p.svix.Messages(p.appID)) == 1 }, 2*time.Second, 10*time.Millisecond)
+
+	message := p.svix.Messages(p.appID)[0]
+	assert.Equal(t, "evt_123", *message.EventId.Get())
+	assert.Equal(t, "test.event", message.EventType)
+	assert.Equal(t, "123", message.Payload["id"])
+
+	// Pub/Sub redelivers the same event, it is answered from the idempotency store
+	require.Eventually(t, func() bool { return p.post(pushRequestBody).Code == http.StatusOK }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, p.svix.Requests(svixtest.CreateMessage))
+}
+
+func TestNotificationController_RecordsMetrics(t *testing.T) {
+	p := newDeliveryPipeline(t)
+	p.start(t)
+
+	succeeded := metrics.Tasks.WithLabelValues("succeeded", "", "test", "test.event")
+	tasks := testutil.ToFloat64(succeeded)
+	latency := sampleCount(t, metrics.DeliveryLatency.WithLabelValues("test", "test.event"))
+	rejected := testutil.ToFloat64(metrics.NotificationsRejected.WithLabelValues("push", "validation_failed"))
+
+	body := `{"id": "evt_123", "type": "test.event", "project": "test", "data": {"id": "123"}, "time": "` +
+		time.Now().Add(-time.Second).UTC().Format(time.RFC3339) + `"}`
+	assert.Equal(t, http.StatusAccepted, p.post(body).Code)
+	require.Eventually(t, func() bool { return testutil.ToFloat64(succeeded) == tasks+1 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, latency+1, sampleCount(t, metrics.DeliveryLatency.WithLabelValues("test", "test.event")))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, p.post(`{"id": "evt_124"}`).Code)
+	assert.Equal(t, rejected+1, testutil.ToFloat64(metrics.NotificationsRejected.WithLabelValues("push", "validation_failed")))
+}
+
+func TestNotificationController_TracesDelivery(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	otel.SetTracerProvider(provider)
+	_, err := tracing.Setup(context.Background(), tracing.DefaultConfig)
+	require.NoError(t, err)
+
+	p := newDeliveryPipeline(t)
+	p.start(t)
+
+	body := `{"message": {"data": "` + base64.StdEncoding.EncodeToString([]byte(baseRequestBody)) + `",
+		"attributes": {"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}, "messageId": "msg_1"}}`
+	assert.Equal(t, http.StatusAccepted, p.post(body).Code)
+	require.Eventually(t, func() bool { return len(p.svix.Messages(p.appID)) == 1 }, 2*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return spanNamed(recorder, "task.execute") != nil }, 2*time.Second, 10*time.Millisecond)
+
+	for _, name := range []string{"POST /notifications", "task.enqueue", "task.execute", "svix.send_message"} {
+		span := spanNamed(recorder, name)
+		require.NotNil(t, span, name)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String(), name)
+	}
+	assert.Equal(t, "00f067aa0ba902b7", spanNamed(recorder, "POST /notifications").Parent().SpanID().String())
+}
+
+// spanNamed returns the first ended span with the name
+func spanNamed(recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	return nil
+}
+
+// sampleCount returns the number of observations of a histogram
+func sampleCount(t *testing.T, observer prometheus.Observer) uint64 {
+	t.Helper()
+	var metric dto.Metric
+	require.NoError(t, observer.(prometheus.Metric).Write(&metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestNotificationController_DeadLettersRejectedEvents(t *testing.T) {
+	p := newDeliveryPipeline(t)
+	p.start(t)
+	p.svix.Fail(svixtest.CreateMessage, svixtest.Fault{Status: http.StatusRequestEntityTooLarge})
+
+	assert.Equal(t, http.StatusAccepted, p.post(baseRequestBody).Code)
+
+	var entry models.DeadLetter
+	require.Eventually(t, func() bool {
+		var found bool
+		entry, found, _ = p.deadLetters.Get(context.Background(), "evt_123")
+		return found
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "payload_too_large", entry.ErrorClass)
+	assert.Empty(t, p.svix.Messages(p.appID))
+}
+
+func TestNotificationController_WaitsForProjectSetup(t *testing.T) {
+	p := newDeliveryPipeline(t)
+	// Svix is down for the first setup rounds
+	p.svix.Fail(svixtest.GetApplication, svixtest.Fault{Status: http.StatusUnauthorized, Times: 2})
+
+	w := p.post(baseRequestBody)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), utils.ProjectInitializingCode)
+
+	p.start(t)
+	assert.GreaterOrEqual(t, p.svix.Requests(svixtest.GetApplication), 3)
+	assert.Equal(t, http.StatusAccepted, p.post(baseRequestBody).Code)
+	require.Eventually(t, func() bool { return len(p.svix.Messages(p.appID)) == 1 }, 2*time.Second, 10*time.Millisecond)
+}
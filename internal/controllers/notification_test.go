@@ -1,15 +1,20 @@
 package controllers
 
 import (
+	"context"
+	"encoding/base64"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
+	"github.com/markonick/gigs-challenge/internal/ingest"
 	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/services"
 	"github.com/markonick/gigs-challenge/internal/utils"
 )
 
@@ -20,20 +25,36 @@ const baseRequestBody = `{
     "data": {"id": "123"}
 }`
 
+var pushRequestBody = `{
+    "message": {
+        "data": "` + base64.StdEncoding.EncodeToString([]byte(baseRequestBody)) + `",
+        "attributes": {"origin": "gigs"},
+        "messageId": "msg_1",
+        "publishTime": "2023-03-24T15:50:41Z"
+    },
+    "subscription": "projects/gigs/subscriptions/hookbro"
+}`
+
 type MockTaskService struct {
 	mock.Mock
 }
 
 // Simplified interface - no more channels
-func (m *MockTaskService) ProcessEvent(event models.BaseEvent) error {
+func (m *MockTaskService) ProcessEvent(_ context.Context, event models.BaseEvent) (services.ProcessResult, error) {
 	args := m.Called(event)
-	return args.Error(0)
+	return args.Get(0).(services.ProcessResult), args.Error(1)
+}
+
+func (m *MockTaskService) Recover(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
 }
 
 var tests = []struct {
 	name        string
 	requestBody string
 	setupMock   func(*MockTaskService)
+	wantStatus  int
 }{
 	{
 		name:        "successful event processing",
@@ -41,17 +62,85 @@ var tests = []struct {
 		setupMock: func(m *MockTaskService) {
 			m.On("ProcessEvent", mock.MatchedBy(func(event models.BaseEvent) bool {
 				return event.Type == "test.event" && event.Project == "test"
-			})).Return(nil)
+			})).Return(services.ProcessResult{}, nil)
+		},
+		wantStatus: http.StatusAccepted,
+	},
+	{
+		name:        "pub/sub push envelope",
+		requestBody: pushRequestBody,
+		setupMock: func(m *MockTaskService) {
+			m.On("ProcessEvent", mock.MatchedBy(func(event models.BaseEvent) bool {
+				return event.ID == "evt_123" &&
+					event.PubSub != nil &&
+					event.PubSub.MessageID == "msg_1" &&
+					event.PubSub.Subscription == "projects/gigs/subscriptions/hookbro" &&
+					event.PubSub.Attributes["origin"] == "gigs" &&
+					!event.PubSub.PublishTime.IsZero()
+			})).Return(services.ProcessResult{}, nil)
 		},
+		wantStatus: http.StatusAccepted,
+	},
+	{
+		name:        "pub/sub envelope with invalid base64 data",
+		requestBody: `{"message": {"data": "not base64!", "messageId": "msg_1"}}`,
+		setupMock:   func(_ *MockTaskService) {},
+		wantStatus:  http.StatusUnprocessableEntity,
+	},
+	{
+		name: "pub/sub envelope with invalid event",
+		requestBody: `{"message": {"data": "` +
+			base64.StdEncoding.EncodeToString([]byte(`{"id": "evt_123"}`)) + `"}}`,
+		setupMock:  func(_ *MockTaskService) {},
+		wantStatus: http.StatusUnprocessableEntity,
 	},
 	{
 		name:        "rate limit exceeded",
 		requestBody: baseRequestBody,
 		setupMock: func(m *MockTaskService) {
 			m.On("ProcessEvent", mock.Anything).Return(
+				services.ProcessResult{},
 				utils.NewRateLimitError("Rate limit exceeded"),
 			)
 		},
+		wantStatus: http.StatusTooManyRequests,
+	},
+	{
+		name:        "worker queue full",
+		requestBody: baseRequestBody,
+		setupMock: func(m *MockTaskService) {
+			m.On("ProcessEvent", mock.Anything).Return(
+				services.ProcessResult{},
+				utils.NewServiceUnavailableError("Worker queue is full"),
+			)
+		},
+		wantStatus: http.StatusServiceUnavailable,
+	},
+	{
+		name:        "already delivered event",
+		requestBody: baseRequestBody,
+		setupMock: func(m *MockTaskService) {
+			m.On("ProcessEvent", mock.Anything).Return(services.ProcessResult{
+				Duplicate: true,
+				Record: models.IdempotencyRecord{
+					EventID: "evt_123",
+					State:   models.IdempotencyDone,
+					Status:  services.DeliveredStatus,
+				},
+			}, nil)
+		},
+		wantStatus: http.StatusOK,
+	},
+	{
+		name:        "event already in progress",
+		requestBody: baseRequestBody,
+		setupMock: func(m *MockTaskService) {
+			m.On("ProcessEvent", mock.Anything).Return(
+				services.ProcessResult{},
+				&utils.ConflictError{Code: services.EventInProgressCode, Detail: "in progress"},
+			)
+		},
+		wantStatus: http.StatusConflict,
 	},
 	// ... other error cases remain similar, just remove channel handling
 	{
@@ -60,6 +149,7 @@ var tests = []struct {
 		setupMock: func(_ *MockTaskService) {
 			// No mock expectations - should fail before service call
 		},
+		wantStatus: http.StatusUnprocessableEntity,
 	},
 }
 
@@ -70,7 +160,7 @@ func TestNotificationController_Create(t *testing.T) {
 			mockTaskService := new(MockTaskService)
 			test.setupMock(mockTaskService)
 
-			controller := NewNotificationController(mockTaskService)
+			controller := NewNotificationController(ingest.NewDispatcher(mockTaskService, nil))
 			w := httptest.NewRecorder()
 			ctx, _ := gin.CreateTestContext(w)
 
@@ -83,7 +173,28 @@ func TestNotificationController_Create(t *testing.T) {
 
 			controller.Create(ctx)
 
+			assert.Equal(t, test.wantStatus, w.Code)
 			mockTaskService.AssertExpectations(t)
 		})
 	}
 }
+
+func TestNotificationController_Create_CircuitOpen(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockTaskService := new(MockTaskService)
+	admit := func(_ models.BaseEvent) error {
+		return &utils.ServiceUnavailableError{Code: utils.CircuitOpenCode, Detail: "Svix circuit breaker global is open"}
+	}
+
+	controller := NewNotificationController(ingest.NewDispatcher(mockTaskService, admit))
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/notifications", strings.NewReader(baseRequestBody))
+	ctx.Request.Header.Set("Content-Type", "application/json")
+
+	controller.Create(ctx)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), utils.CircuitOpenCode)
+	mockTaskService.AssertNotCalled(t, "ProcessEvent", mock.Anything)
+}
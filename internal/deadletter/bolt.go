@@ -0,0 +1,115 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+var entriesBucket = []byte("deadletters")
+
+// BoltStore keeps dead letters in an embedded bbolt database so they survive restarts
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create dead letter directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead letter store: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(entriesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise dead letter store: %w", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Put(_ context.Context, entry models.DeadLetter) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(entriesBucket).Put([]byte(entry.EventID), raw)
+	})
+}
+
+func (s *BoltStore) Get(_ context.Context, eventID string) (models.DeadLetter, bool, error) {
+	var (
+		entry models.DeadLetter
+		found bool
+	)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(entriesBucket).Get([]byte(eventID))
+		if raw == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(raw, &entry)
+	})
+	return entry, found, err
+}
+
+// List returns all dead letters, most recent failure first
+func (s *BoltStore) List(_ context.Context) ([]models.DeadLetter, error) {
+	var entries []models.DeadLetter
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(entriesBucket).ForEach(func(k, v []byte) error {
+			var entry models.DeadLetter
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("corrupt dead letter %s: %w", k, err)
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	sortByLastFailure(entries)
+	return entries, err
+}
+
+func (s *BoltStore) Delete(_ context.Context, eventIDs ...string) (int, error) {
+	deleted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(entriesBucket)
+		for _, id := range eventIDs {
+			if bucket.Get([]byte(id)) == nil {
+				continue
+			}
+			if err := bucket.Delete([]byte(id)); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// Close closes the database
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func sortByLastFailure(entries []models.DeadLetter) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastFailedAt.After(entries[j].LastFailedAt)
+	})
+}
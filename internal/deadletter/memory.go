@@ -0,0 +1,59 @@
+package deadletter
+
+import (
+	"context"
+	"sync"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+)
+
+// MemoryStore keeps dead letters in process, meant for tests and local development
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]models.DeadLetter
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]models.DeadLetter)}
+}
+
+func (s *MemoryStore) Put(_ context.Context, entry models.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[entry.EventID] = entry
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, eventID string) (models.DeadLetter, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[eventID]
+	return entry, ok, nil
+}
+
+// List returns all dead letters, most recent failure first
+func (s *MemoryStore) List(_ context.Context) ([]models.DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]models.DeadLetter, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	sortByLastFailure(entries)
+	return entries, nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, eventIDs ...string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for _, id := range eventIDs {
+		if _, ok := s.entries[id]; ok {
+			delete(s.entries, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
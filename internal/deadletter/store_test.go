@@ -0,0 +1,54 @@
+package deadletter
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+)
+
+func TestBoltStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "deadletter.db")
+
+	s, err := NewBoltStore(path)
+	require.NoError(t, err)
+
+	start := time.Now()
+	for i, id := range []string{"evt_a", "evt_b", "evt_c"} {
+		require.NoError(t, s.Put(ctx, models.DeadLetter{
+			EventID:      id,
+			Event:        models.BaseEvent{ID: id, Project: "dev"},
+			ErrorClass:   "internal",
+			LastFailedAt: start.Add(time.Duration(i) * time.Second),
+		}))
+	}
+	require.NoError(t, s.Close())
+
+	s, err = NewBoltStore(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	entries, err := s.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "evt_c", entries[0].EventID, "most recent failure comes first")
+
+	entry, found, err := s.Get(ctx, "evt_b")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "dev", entry.Event.Project)
+
+	deleted, err := s.Delete(ctx, "evt_a", "evt_b", "evt_missing")
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	_, found, err = s.Get(ctx, "evt_a")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
@@ -2,58 +2,219 @@ package container
 
 import (
 	"context"
-	"os"
-	"strconv"
+	"fmt"
 
+	"github.com/markonick/gigs-challenge/config"
+	"github.com/markonick/gigs-challenge/internal/auth"
 	"github.com/markonick/gigs-challenge/internal/controllers"
+	"github.com/markonick/gigs-challenge/internal/deadletter"
+	"github.com/markonick/gigs-challenge/internal/health"
+	"github.com/markonick/gigs-challenge/internal/idempotency"
+	"github.com/markonick/gigs-challenge/internal/ingest"
 	"github.com/markonick/gigs-challenge/internal/logger"
 	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/outbox"
+	"github.com/markonick/gigs-challenge/internal/reload"
+	"github.com/markonick/gigs-challenge/internal/router"
 	"github.com/markonick/gigs-challenge/internal/services"
 	"github.com/markonick/gigs-challenge/internal/svix"
 	task "github.com/markonick/gigs-challenge/internal/tasks"
+	"github.com/markonick/gigs-challenge/internal/tracing"
 	"github.com/markonick/gigs-challenge/internal/worker"
 	"go.uber.org/dig"
 )
 
-func NewContainer() *dig.Container {
+// NewContainer provides the services configured by cfg
+func NewContainer(cfg config.Config) *dig.Container {
 	container := dig.New()
 
-	// Register environment-based providers
-	must(container.Provide(func() (string, error) {
-		token := os.Getenv("SVIX_AUTH_TOKEN")
-		if token == "" {
-			logger.Log.Fatal().Msg("SVIX_AUTH_TOKEN is not set")
-		}
-		return token, nil
+	must(container.Provide(func() config.Config {
+		return cfg
+	}))
+	must(container.Provide(func(cfg config.Config) logger.Config {
+		return cfg.Log.LoggerConfig()
+	}))
+	must(container.Provide(func(cfg config.Config) tracing.Config {
+		return cfg.Tracing.TracingConfig()
+	}))
+	must(container.Provide(func(cfg config.Config) worker.Config {
+		return cfg.Worker.PoolConfig()
+	}))
+	// Svix retry policies per operation and rate limits
+	must(container.Provide(func(cfg config.Config) (svix.Config, error) {
+		return cfg.Svix.ClientConfig()
 	}))
 
-	must(container.Provide(func() (int, error) {
-		workers, err := strconv.Atoi(os.Getenv("MAX_WORKERS"))
+	// Register core services, the Svix client records its latency and is wrapped in circuit breakers
+	must(container.Provide(func(cfg config.Config, svixConfig svix.Config) (*svix.StatsClient, error) {
+		client, err := svix.NewClient(cfg.Svix.AuthToken, svixConfig)
 		if err != nil {
-			logger.Log.Fatal().Err(err).Msg("MAX_WORKERS is not set up correctly")
+			return nil, err
 		}
-		return workers, nil
+		return svix.NewStatsClient(client), nil
 	}))
-
-	// Register core services
-	must(container.Provide(func(token string) svix.Client {
-		return svix.NewClient(token)
+	must(container.Provide(func(cfg config.Config, client *svix.StatsClient) *svix.BreakerClient {
+		return svix.NewBreakerClient(client, cfg.Svix.BreakerConfig())
+	}))
+	must(container.Provide(func(client *svix.BreakerClient) svix.Client {
+		return client
 	}))
 
-	must(container.Provide(func(client svix.Client) (map[string]string, error) {
-		projects := []string{"dev"}
-		return svix.InitializeApplications(context.Background(), client, projects)
+	// Svix applications per project, the configured projects are set up in the background at
+	// startup and any other project the first time it is seen, unless the allowlist leaves it out
+	must(container.Provide(func(cfg config.Config, client svix.Client) *svix.ProjectRegistry {
+		return svix.NewProjectRegistry(client, cfg.Svix.RegistryConfig())
 	}))
 
 	// Register task creation function
-	must(container.Provide(func(svixClient svix.Client, projectAppIDs map[string]string) func(models.BaseEvent) worker.Task {
+	must(container.Provide(func(svixClient svix.Client, registry *svix.ProjectRegistry) func(models.BaseEvent) worker.Task {
 		return func(event models.BaseEvent) worker.Task {
-			return task.NewWebhookTask(event, svixClient, projectAppIDs)
+			return task.NewWebhookTask(event, svixClient, registry)
+		}
+	}))
+
+	// Pub/Sub push authentication, disabled only when explicitly turned off
+	must(container.Provide(func(cfg config.Config) (*auth.Verifier, error) {
+		if !cfg.PubSub.Auth.Enabled {
+			logger.Log.Warn().Msg("Pub/Sub push authentication is disabled")
+			return nil, nil
+		}
+		keys := auth.NewKeySource(cfg.PubSub.Auth.JWKS, nil)
+		return auth.NewVerifier(cfg.PubSub.Auth.AuthConfig(), keys)
+	}))
+
+	must(container.Provide(func(cfg worker.Config) *worker.Pool {
+		logger.Log.Info().
+			Int("num_workers", cfg.MaxWorkers).
+			Int("queue_capacity", cfg.QueueCapacity).
+			Dur("task_timeout", cfg.TaskTimeout).
+			Msg("Initializing worker pool")
+		return worker.NewPool(cfg)
+	}))
+
+	// Idempotency store, "memory" is per process, "disk" survives restarts
+	// and "redis" is shared between replicas
+	must(container.Provide(func(cfg config.Config) (services.IdempotencyStore, error) {
+		options := cfg.Idempotency.Options()
+		switch backend := cfg.Idempotency.Store; backend {
+		case "memory":
+			return idempotency.NewMemoryStore(options), nil
+		case "disk":
+			return idempotency.NewBoltStore(cfg.Idempotency.Path, options)
+		case "redis":
+			return idempotency.NewRedisStoreFromURL(cfg.Redis.URL, cfg.Idempotency.RedisPrefix, options)
+		default:
+			return nil, fmt.Errorf("unknown IDEMPOTENCY_STORE %q", backend)
+		}
+	}))
+
+	// Write-ahead outbox for accepted events, "disk" survives crashes
+	must(container.Provide(func(cfg config.Config) (services.Outbox, error) {
+		switch backend := cfg.Outbox.Store; backend {
+		case "disk":
+			return outbox.NewBoltOutbox(cfg.Outbox.Path)
+		case "memory":
+			logger.Log.Warn().Msg("Using in-memory outbox, accepted events are lost on crash")
+			return outbox.NewMemoryOutbox(), nil
+		default:
+			return nil, fmt.Errorf("unknown OUTBOX_STORE %q", backend)
+		}
+	}))
+
+	// Dead letter store for events whose delivery failed, "disk" keeps them across restarts
+	must(container.Provide(func(cfg config.Config) (services.DeadLetterStore, error) {
+		switch backend := cfg.DeadLetter.Store; backend {
+		case "disk":
+			return deadletter.NewBoltStore(cfg.DeadLetter.Path)
+		case "memory":
+			return deadletter.NewMemoryStore(), nil
+		default:
+			return nil, fmt.Errorf("unknown DEADLETTER_STORE %q", backend)
 		}
 	}))
 
 	must(container.Provide(services.NewTaskService))
+	must(container.Provide(services.NewDeadLetterService))
+	// Events of projects left out of the allowlist are rejected. Events of projects whose
+	// application is not set up yet or whose breaker is open are answered with 503 so Pub/Sub
+	// redelivers them
+	must(container.Provide(func(client *svix.BreakerClient, registry *svix.ProjectRegistry) ingest.AdmitFunc {
+		return func(event models.BaseEvent) error {
+			if err := registry.Admit(event.Project); err != nil {
+				return err
+			}
+			appID, _ := registry.Lookup(event.Project)
+			return client.Allow(appID)
+		}
+	}))
+	must(container.Provide(ingest.NewDispatcher))
 	must(container.Provide(controllers.NewNotificationController))
+	must(container.Provide(controllers.NewDeadLetterController))
+	// Health checks, every subsystem registers its own. Readiness checks gate /readyz.
+	must(container.Provide(func(
+		cfg config.Config,
+		stats *svix.StatsClient,
+		breakers *svix.BreakerClient,
+		registry *svix.ProjectRegistry,
+		pool *worker.Pool,
+		idempotencyStore services.IdempotencyStore,
+	) *health.Checker {
+		checker := health.NewChecker(cfg.Health.CheckTimeout)
+		checker.RegisterReadiness("svix", health.Cached(stats.HealthCheck, cfg.Health.SvixPingInterval))
+		checker.RegisterReadiness("svix_breakers", breakers.HealthCheck)
+		checker.RegisterReadiness("projects", registry.HealthCheck)
+		checker.RegisterReadiness("worker_pool", pool.HealthCheck)
+		if pinger, ok := idempotencyStore.(interface{ Ping(context.Context) error }); ok {
+			checker.RegisterReadiness("idempotency_store", func(ctx context.Context) health.Result {
+				if err := pinger.Ping(ctx); err != nil {
+					return health.Down(err, nil)
+				}
+				return health.Up(nil)
+			})
+		}
+		return checker
+	}))
+	must(container.Provide(controllers.NewHealthController))
+
+	// Admin endpoints are disabled unless an admin token is set
+	must(container.Provide(func(cfg config.Config) *auth.AdminAuthenticator {
+		return auth.NewAdminAuthenticator(cfg.Admin.Token)
+	}))
+	must(container.Provide(func(cfg config.Config) logger.DebugConfig {
+		return cfg.Admin.DebugConfig()
+	}))
+	must(container.Provide(controllers.NewLoggingController))
+	must(container.Provide(func(cfg config.Config) router.Options {
+		return router.Options{Pprof: cfg.Admin.PprofEnabled}
+	}))
+
+	// Applies the live settings of a reloaded configuration on SIGHUP or when the config file changes
+	must(container.Provide(func(
+		cfg config.Config,
+		registry *svix.ProjectRegistry,
+		client *svix.BreakerClient,
+		pool *worker.Pool,
+	) *reload.Reloader {
+		return reload.NewReloader(cfg, registry, client, pool)
+	}))
+
+	// Pull subscription ingestion, only enabled when a subscription is configured
+	must(container.Provide(func(cfg config.Config, dispatcher *ingest.Dispatcher) (*ingest.PullConsumer, error) {
+		if cfg.PubSub.Pull.Subscription == "" {
+			return nil, nil
+		}
+
+		subscription, err := ingest.NewSubscription(
+			context.Background(),
+			cfg.PubSub.Pull.Subscription,
+			cfg.PubSub.Endpoint,
+			cfg.PubSub.EmulatorHost,
+		)
+		if err != nil {
+			return nil, err
+		}
+		return ingest.NewPullConsumer(subscription, dispatcher, cfg.PubSub.Pull.PullConfig()), nil
+	}))
 
 	return container
 }
@@ -0,0 +1,172 @@
+// Package health runs the checks behind the liveness, readiness and health endpoints.
+// Subsystems register their own checks, readiness checks also decide whether the
+// service should receive traffic.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusUp Status = "up"
+	// StatusDegraded is reported when only checks that do not affect readiness are down
+	StatusDegraded Status = "degraded"
+	StatusDown     Status = "down"
+)
+
+// DefaultTimeout bounds a single check
+const DefaultTimeout = 2 * time.Second
+
+// Result is the outcome of a check, Details are included in the health report
+type Result struct {
+	Status  Status      `json:"status"`
+	Error   string      `json:"error,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Up returns a passing result
+func Up(details interface{}) Result {
+	return Result{Status: StatusUp, Details: details}
+}
+
+// Down returns a failing result
+func Down(err error, details interface{}) Result {
+	return Result{Status: StatusDown, Error: err.Error(), Details: details}
+}
+
+// CheckFunc reports the state of a subsystem, it should return once ctx is done
+type CheckFunc func(ctx context.Context) Result
+
+// Report is the outcome of a set of checks
+type Report struct {
+	Status Status            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+type check struct {
+	name      string
+	fn        CheckFunc
+	readiness bool
+}
+
+// Checker holds the registered checks, it is safe for concurrent use
+type Checker struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks []check
+}
+
+// NewChecker creates a checker that gives each check up to timeout, DefaultTimeout when zero
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{timeout: timeout}
+}
+
+// Register adds a check that is only reported by Health, it never makes the service unready
+func (c *Checker) Register(name string, fn CheckFunc) {
+	c.register(check{name: name, fn: fn})
+}
+
+// RegisterReadiness adds a check the service must pass to be ready
+func (c *Checker) RegisterReadiness(name string, fn CheckFunc) {
+	c.register(check{name: name, fn: fn, readiness: true})
+}
+
+func (c *Checker) register(added check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, added)
+}
+
+// Ready runs the readiness checks, the report is down when any of them is
+func (c *Checker) Ready(ctx context.Context) Report {
+	return c.run(ctx, true)
+}
+
+// Health runs every check. The report is down when a readiness check is and
+// degraded when only other checks are.
+func (c *Checker) Health(ctx context.Context) Report {
+	return c.run(ctx, false)
+}
+
+// run executes the checks concurrently, each one bounded by the checker timeout
+func (c *Checker) run(ctx context.Context, readinessOnly bool) Report {
+	c.mu.RLock()
+	checks := make([]check, 0, len(c.checks))
+	for _, registered := range c.checks {
+		if registered.readiness || !readinessOnly {
+			checks = append(checks, registered)
+		}
+	}
+	c.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, registered := range checks {
+		wg.Add(1)
+		go func(i int, registered check) {
+			defer wg.Done()
+			results[i] = c.runCheck(ctx, registered)
+		}(i, registered)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]Result, len(checks))}
+	for i, registered := range checks {
+		report.Checks[registered.name] = results[i]
+		if results[i].Status != StatusDown {
+			continue
+		}
+		if registered.readiness {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+func (c *Checker) runCheck(ctx context.Context, registered check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	done := make(chan Result, 1)
+	go func() {
+		done <- registered.fn(ctx)
+	}()
+
+	select {
+	case result := <-done:
+		return result
+	case <-ctx.Done():
+		return Down(fmt.Errorf("check %s did not finish: %w", registered.name, ctx.Err()), nil)
+	}
+}
+
+// Cached reuses the result of fn for ttl, for checks that call out to other services
+// and should not do so on every probe
+func Cached(fn CheckFunc, ttl time.Duration) CheckFunc {
+	var (
+		mu      sync.Mutex
+		result  Result
+		checked time.Time
+	)
+	return func(ctx context.Context) Result {
+		mu.Lock()
+		defer mu.Unlock()
+		if !checked.IsZero() && time.Since(checked) < ttl {
+			return result
+		}
+		result = fn(ctx)
+		checked = time.Now()
+		return result
+	}
+}
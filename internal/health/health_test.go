@@ -0,0 +1,98 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func up(_ context.Context) Result   { return Up(nil) }
+func down(_ context.Context) Result { return Down(errors.New("broken"), nil) }
+
+func TestChecker(t *testing.T) {
+	tests := []struct {
+		name       string
+		readiness  map[string]CheckFunc
+		other      map[string]CheckFunc
+		wantReady  Status
+		wantHealth Status
+	}{
+		{
+			name:       "all checks pass",
+			readiness:  map[string]CheckFunc{"svix": up},
+			other:      map[string]CheckFunc{"cache": up},
+			wantReady:  StatusUp,
+			wantHealth: StatusUp,
+		},
+		{
+			name:       "readiness check down",
+			readiness:  map[string]CheckFunc{"svix": down, "pool": up},
+			other:      map[string]CheckFunc{"cache": up},
+			wantReady:  StatusDown,
+			wantHealth: StatusDown,
+		},
+		{
+			name:       "only other checks down",
+			readiness:  map[string]CheckFunc{"svix": up},
+			other:      map[string]CheckFunc{"cache": down},
+			wantReady:  StatusUp,
+			wantHealth: StatusDegraded,
+		},
+		{
+			name:       "no checks",
+			wantReady:  StatusUp,
+			wantHealth: StatusUp,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(time.Second)
+			for name, fn := range tt.readiness {
+				checker.RegisterReadiness(name, fn)
+			}
+			for name, fn := range tt.other {
+				checker.Register(name, fn)
+			}
+
+			ready := checker.Ready(context.Background())
+			assert.Equal(t, tt.wantReady, ready.Status)
+			assert.Len(t, ready.Checks, len(tt.readiness))
+
+			report := checker.Health(context.Background())
+			assert.Equal(t, tt.wantHealth, report.Status)
+			assert.Len(t, report.Checks, len(tt.readiness)+len(tt.other))
+		})
+	}
+}
+
+func TestChecker_Timeout(t *testing.T) {
+	checker := NewChecker(20 * time.Millisecond)
+	checker.RegisterReadiness("slow", func(ctx context.Context) Result {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond) // ignores the deadline on purpose
+		return Up(nil)
+	})
+
+	start := time.Now()
+	report := checker.Ready(context.Background())
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Contains(t, report.Checks["slow"].Error, "did not finish")
+}
+
+func TestCached(t *testing.T) {
+	calls := 0
+	check := Cached(func(_ context.Context) Result {
+		calls++
+		return Up(calls)
+	}, 50*time.Millisecond)
+
+	assert.Equal(t, 1, check(context.Background()).Details)
+	assert.Equal(t, 1, check(context.Background()).Details)
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, 2, check(context.Background()).Details)
+}
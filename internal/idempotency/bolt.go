@@ -0,0 +1,186 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/markonick/gigs-challenge/internal/logger"
+	"github.com/markonick/gigs-challenge/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+var recordsBucket = []byte("idempotency")
+
+// BoltStore keeps records in an embedded bbolt database so they survive restarts.
+// Expired records are removed by a background sweep.
+type BoltStore struct {
+	options Options
+	db      *bolt.DB
+	now     func() time.Time
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func NewBoltStore(path string, options Options) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create idempotency store directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open idempotency store: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(recordsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise idempotency store: %w", err)
+	}
+
+	s := &BoltStore{
+		options: options.withDefaults(),
+		db:      db,
+		now:     time.Now,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.sweepLoop(time.Minute)
+	return s, nil
+}
+
+func (s *BoltStore) Claim(_ context.Context, eventID string) (models.IdempotencyRecord, bool, error) {
+	var (
+		record  models.IdempotencyRecord
+		claimed bool
+	)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(recordsBucket)
+		now := s.now()
+
+		if existing, ok, err := getRecord(bucket, eventID); err != nil {
+			return err
+		} else if ok && s.options.live(existing, now) {
+			record = existing
+			return nil
+		}
+
+		record = newClaim(eventID, now)
+		claimed = true
+		return putRecord(bucket, record)
+	})
+	return record, claimed, err
+}
+
+func (s *BoltStore) Complete(_ context.Context, eventID string, status string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(recordsBucket)
+		now := s.now()
+
+		record, ok, err := getRecord(bucket, eventID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			record = models.IdempotencyRecord{EventID: eventID, ClaimedAt: now}
+		}
+		record.State = models.IdempotencyDone
+		record.Status = status
+		record.CompletedAt = now
+		return putRecord(bucket, record)
+	})
+}
+
+func (s *BoltStore) Release(_ context.Context, eventID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(recordsBucket)
+		record, ok, err := getRecord(bucket, eventID)
+		if err != nil || !ok || record.State != models.IdempotencyInFlight {
+			return err
+		}
+		return bucket.Delete([]byte(eventID))
+	})
+}
+
+// Sweep deletes records that no longer block a claim
+func (s *BoltStore) Sweep() (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(recordsBucket)
+		now := s.now()
+
+		var expired [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var record models.IdempotencyRecord
+			if err := json.Unmarshal(v, &record); err != nil || !s.options.live(record, now) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(expired)
+		return nil
+	})
+	return removed, err
+}
+
+// Close stops the background sweep and closes the database
+func (s *BoltStore) Close() error {
+	close(s.stop)
+	<-s.done
+	return s.db.Close()
+}
+
+func (s *BoltStore) sweepLoop(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			removed, err := s.Sweep()
+			if err != nil {
+				logger.Log.Error().Err(err).Msg("Failed to sweep idempotency store")
+			} else if removed > 0 {
+				logger.Log.Debug().Int("removed", removed).Msg("Swept expired idempotency records")
+			}
+		}
+	}
+}
+
+func getRecord(bucket *bolt.Bucket, eventID string) (models.IdempotencyRecord, bool, error) {
+	var record models.IdempotencyRecord
+	raw := bucket.Get([]byte(eventID))
+	if raw == nil {
+		return record, false, nil
+	}
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return record, false, fmt.Errorf("corrupt idempotency record for %s: %w", eventID, err)
+	}
+	return record, true, nil
+}
+
+func putRecord(bucket *bolt.Bucket, record models.IdempotencyRecord) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(record.EventID), raw)
+}
@@ -0,0 +1,98 @@
+package idempotency
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+)
+
+// MemoryStore keeps records in process, bounded by a TTL and an LRU capacity.
+// It does not survive restarts and is not shared between replicas.
+type MemoryStore struct {
+	options Options
+	now     func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List
+	records map[string]*list.Element
+}
+
+func NewMemoryStore(options Options) *MemoryStore {
+	return &MemoryStore{
+		options: options.withDefaults(),
+		now:     time.Now,
+		order:   list.New(),
+		records: make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryStore) Claim(_ context.Context, eventID string) (models.IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if elem, ok := s.records[eventID]; ok {
+		record := elem.Value.(models.IdempotencyRecord)
+		if s.options.live(record, now) {
+			s.order.MoveToFront(elem)
+			return record, false, nil
+		}
+	}
+
+	record := newClaim(eventID, now)
+	s.put(record)
+	return record, true, nil
+}
+
+func (s *MemoryStore) Complete(_ context.Context, eventID string, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := models.IdempotencyRecord{EventID: eventID, ClaimedAt: s.now()}
+	if elem, ok := s.records[eventID]; ok {
+		record = elem.Value.(models.IdempotencyRecord)
+	}
+	record.State = models.IdempotencyDone
+	record.Status = status
+	record.CompletedAt = s.now()
+	s.put(record)
+	return nil
+}
+
+func (s *MemoryStore) Release(_ context.Context, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.records[eventID]; ok {
+		if elem.Value.(models.IdempotencyRecord).State == models.IdempotencyInFlight {
+			s.order.Remove(elem)
+			delete(s.records, eventID)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of records held, including expired ones not yet evicted
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.records)
+}
+
+func (s *MemoryStore) put(record models.IdempotencyRecord) {
+	if elem, ok := s.records[record.EventID]; ok {
+		elem.Value = record
+		s.order.MoveToFront(elem)
+		return
+	}
+
+	s.records[record.EventID] = s.order.PushFront(record)
+	for len(s.records) > s.options.Capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.records, oldest.Value.(models.IdempotencyRecord).EventID)
+	}
+}
@@ -0,0 +1,135 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisPrefix namespaces the idempotency keys in a shared Redis
+const DefaultRedisPrefix = "hookbro:idempotency:"
+
+// releaseScript deletes the key only while it still holds our own claim,
+// so a replica never drops a claim another replica took over
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisStore shares records between replicas through Redis.
+// Claims use SET NX with the in-flight TTL, so two replicas receiving the same
+// event at once cannot both claim it, and delivered records expire with the TTL.
+type RedisStore struct {
+	client  redis.UniversalClient
+	prefix  string
+	options Options
+
+	// claims holds the value of every claim taken by this process, used for safe release
+	claims sync.Map
+}
+
+func NewRedisStore(client redis.UniversalClient, prefix string, options Options) *RedisStore {
+	if prefix == "" {
+		prefix = DefaultRedisPrefix
+	}
+	return &RedisStore{
+		client:  client,
+		prefix:  prefix,
+		options: options.withDefaults(),
+	}
+}
+
+// NewRedisStoreFromURL connects to the redis:// or rediss:// URL
+func NewRedisStoreFromURL(url, prefix string, options Options) (*RedisStore, error) {
+	redisOptions, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	return NewRedisStore(redis.NewClient(redisOptions), prefix, options), nil
+}
+
+func (s *RedisStore) Claim(ctx context.Context, eventID string) (models.IdempotencyRecord, bool, error) {
+	key := s.prefix + eventID
+
+	// The existing record can expire between SET NX and GET, try again when it does
+	for attempt := 0; attempt < 3; attempt++ {
+		record := newClaim(eventID, time.Now())
+		raw, err := json.Marshal(record)
+		if err != nil {
+			return record, false, err
+		}
+
+		claimed, err := s.client.SetNX(ctx, key, raw, s.options.InFlightTTL).Result()
+		if err != nil {
+			return record, false, fmt.Errorf("failed to claim event %s: %w", eventID, err)
+		}
+		if claimed {
+			s.claims.Store(eventID, string(raw))
+			return record, true, nil
+		}
+
+		existing, err := s.client.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return record, false, fmt.Errorf("failed to read event %s: %w", eventID, err)
+		}
+
+		if err := json.Unmarshal(existing, &record); err != nil {
+			return record, false, fmt.Errorf("corrupt idempotency record for %s: %w", eventID, err)
+		}
+		return record, false, nil
+	}
+
+	return models.IdempotencyRecord{}, false, fmt.Errorf("failed to claim event %s: record kept expiring", eventID)
+}
+
+func (s *RedisStore) Complete(ctx context.Context, eventID string, status string) error {
+	now := time.Now()
+	record := models.IdempotencyRecord{EventID: eventID, ClaimedAt: now}
+	if claim, ok := s.claims.LoadAndDelete(eventID); ok {
+		_ = json.Unmarshal([]byte(claim.(string)), &record)
+	}
+	record.State = models.IdempotencyDone
+	record.Status = status
+	record.CompletedAt = now
+
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := s.client.Set(ctx, s.prefix+eventID, raw, s.options.TTL).Err(); err != nil {
+		return fmt.Errorf("failed to complete event %s: %w", eventID, err)
+	}
+	return nil
+}
+
+func (s *RedisStore) Release(ctx context.Context, eventID string) error {
+	claim, ok := s.claims.LoadAndDelete(eventID)
+	if !ok {
+		return nil
+	}
+	if err := releaseScript.Run(ctx, s.client, []string{s.prefix + eventID}, claim).Err(); err != nil {
+		return fmt.Errorf("failed to release event %s: %w", eventID, err)
+	}
+	return nil
+}
+
+// Ping checks the connection to Redis
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+// Close closes the Redis connection
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,114 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+)
+
+func newRedisReplica(t *testing.T, server *miniredis.Miniredis, options Options) *RedisStore {
+	t.Helper()
+	s := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "", options)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestRedisStore_ClaimCompleteRelease(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	s := newRedisReplica(t, server, Options{TTL: time.Hour, InFlightTTL: time.Minute})
+
+	record, claimed, err := s.Claim(ctx, "evt_1")
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Equal(t, models.IdempotencyInFlight, record.State)
+
+	_, claimed, err = s.Claim(ctx, "evt_1")
+	require.NoError(t, err)
+	assert.False(t, claimed)
+
+	require.NoError(t, s.Release(ctx, "evt_1"))
+	_, claimed, err = s.Claim(ctx, "evt_1")
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	require.NoError(t, s.Complete(ctx, "evt_1", "delivered"))
+	record, claimed, err = s.Claim(ctx, "evt_1")
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, models.IdempotencyDone, record.State)
+	assert.Equal(t, "delivered", record.Status)
+
+	server.FastForward(2 * time.Hour)
+	_, claimed, err = s.Claim(ctx, "evt_1")
+	require.NoError(t, err)
+	assert.True(t, claimed, "delivered record must expire after the TTL")
+}
+
+func TestRedisStore_ReleaseDoesNotDropTakenOverClaim(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	options := Options{TTL: time.Hour, InFlightTTL: time.Minute}
+	replicaA := newRedisReplica(t, server, options)
+	replicaB := newRedisReplica(t, server, options)
+
+	_, claimed, err := replicaA.Claim(ctx, "evt_1")
+	require.NoError(t, err)
+	require.True(t, claimed)
+
+	// Replica A stalls past the in-flight TTL and replica B takes over
+	server.FastForward(2 * time.Minute)
+	_, claimed, err = replicaB.Claim(ctx, "evt_1")
+	require.NoError(t, err)
+	require.True(t, claimed)
+
+	require.NoError(t, replicaA.Release(ctx, "evt_1"))
+	record, claimed, err := replicaA.Claim(ctx, "evt_1")
+	require.NoError(t, err)
+	assert.False(t, claimed, "replica B's claim must survive replica A's release")
+	assert.Equal(t, models.IdempotencyInFlight, record.State)
+}
+
+func TestRedisStore_ConcurrentReplicasClaimOnce(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+
+	var replicas []*RedisStore
+	for i := 0; i < 4; i++ {
+		replicas = append(replicas, newRedisReplica(t, server, Options{}))
+	}
+
+	var (
+		wg      sync.WaitGroup
+		claims  int32
+		start   = make(chan struct{})
+		eventID = "evt_concurrent"
+	)
+	for _, replica := range replicas {
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(s *RedisStore) {
+				defer wg.Done()
+				<-start
+				_, claimed, err := s.Claim(ctx, eventID)
+				assert.NoError(t, err)
+				if claimed {
+					atomic.AddInt32(&claims, 1)
+				}
+			}(replica)
+		}
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), claims)
+}
@@ -0,0 +1,58 @@
+package idempotency
+
+import (
+	"time"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+)
+
+// Options control how long records are remembered
+type Options struct {
+	// TTL is how long a delivered event is remembered
+	TTL time.Duration
+	// InFlightTTL is how long a claim is honoured before another delivery may take over,
+	// it protects against claims left behind by a crashed worker
+	InFlightTTL time.Duration
+	// Capacity bounds the number of records kept by the in-memory store
+	Capacity int
+}
+
+// DefaultOptions is used for any zero valued Options field
+var DefaultOptions = Options{
+	TTL:         24 * time.Hour,
+	InFlightTTL: 5 * time.Minute,
+	Capacity:    100000,
+}
+
+func (o Options) withDefaults() Options {
+	if o.TTL <= 0 {
+		o.TTL = DefaultOptions.TTL
+	}
+	if o.InFlightTTL <= 0 {
+		o.InFlightTTL = DefaultOptions.InFlightTTL
+	}
+	if o.Capacity <= 0 {
+		o.Capacity = DefaultOptions.Capacity
+	}
+	return o
+}
+
+// live reports whether an existing record still blocks a new claim
+func (o Options) live(record models.IdempotencyRecord, now time.Time) bool {
+	switch record.State {
+	case models.IdempotencyDone:
+		return now.Sub(record.CompletedAt) < o.TTL
+	case models.IdempotencyInFlight:
+		return now.Sub(record.ClaimedAt) < o.InFlightTTL
+	default:
+		return false
+	}
+}
+
+func newClaim(eventID string, now time.Time) models.IdempotencyRecord {
+	return models.IdempotencyRecord{
+		EventID:   eventID,
+		State:     models.IdempotencyInFlight,
+		ClaimedAt: now,
+	}
+}
@@ -0,0 +1,163 @@
+package idempotency
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+)
+
+type store interface {
+	Claim(ctx context.Context, eventID string) (models.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, eventID string, status string) error
+	Release(ctx context.Context, eventID string) error
+}
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func TestStores(t *testing.T) {
+	options := Options{TTL: time.Hour, InFlightTTL: time.Minute}
+
+	stores := map[string]func(t *testing.T, c *clock) store{
+		"memory": func(_ *testing.T, c *clock) store {
+			s := NewMemoryStore(options)
+			s.now = c.Now
+			return s
+		},
+		"bolt": func(t *testing.T, c *clock) store {
+			s, err := NewBoltStore(filepath.Join(t.TempDir(), "idempotency.db"), options)
+			require.NoError(t, err)
+			t.Cleanup(func() { s.Close() })
+			s.now = c.Now
+			return s
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			t.Run("claim, complete and expire", func(t *testing.T) {
+				c := &clock{now: time.Now()}
+				s := newStore(t, c)
+
+				record, claimed, err := s.Claim(ctx, "evt_1")
+				require.NoError(t, err)
+				assert.True(t, claimed)
+				assert.Equal(t, models.IdempotencyInFlight, record.State)
+
+				record, claimed, err = s.Claim(ctx, "evt_1")
+				require.NoError(t, err)
+				assert.False(t, claimed)
+				assert.Equal(t, models.IdempotencyInFlight, record.State)
+
+				require.NoError(t, s.Complete(ctx, "evt_1", "delivered"))
+				record, claimed, err = s.Claim(ctx, "evt_1")
+				require.NoError(t, err)
+				assert.False(t, claimed)
+				assert.Equal(t, models.IdempotencyDone, record.State)
+				assert.Equal(t, "delivered", record.Status)
+
+				c.now = c.now.Add(2 * time.Hour)
+				_, claimed, err = s.Claim(ctx, "evt_1")
+				require.NoError(t, err)
+				assert.True(t, claimed, "delivered record must expire after the TTL")
+			})
+
+			t.Run("release allows a retry", func(t *testing.T) {
+				s := newStore(t, &clock{now: time.Now()})
+
+				_, _, err := s.Claim(ctx, "evt_2")
+				require.NoError(t, err)
+				require.NoError(t, s.Release(ctx, "evt_2"))
+
+				_, claimed, err := s.Claim(ctx, "evt_2")
+				require.NoError(t, err)
+				assert.True(t, claimed)
+			})
+
+			t.Run("release keeps delivered records", func(t *testing.T) {
+				s := newStore(t, &clock{now: time.Now()})
+
+				require.NoError(t, s.Complete(ctx, "evt_3", "delivered"))
+				require.NoError(t, s.Release(ctx, "evt_3"))
+
+				_, claimed, err := s.Claim(ctx, "evt_3")
+				require.NoError(t, err)
+				assert.False(t, claimed)
+			})
+
+			t.Run("stale claims can be taken over", func(t *testing.T) {
+				c := &clock{now: time.Now()}
+				s := newStore(t, c)
+
+				_, _, err := s.Claim(ctx, "evt_4")
+				require.NoError(t, err)
+
+				c.now = c.now.Add(2 * time.Minute)
+				_, claimed, err := s.Claim(ctx, "evt_4")
+				require.NoError(t, err)
+				assert.True(t, claimed)
+			})
+		})
+	}
+}
+
+func TestMemoryStore_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(Options{Capacity: 2})
+
+	require.NoError(t, s.Complete(ctx, "evt_1", "delivered"))
+	require.NoError(t, s.Complete(ctx, "evt_2", "delivered"))
+	_, _, _ = s.Claim(ctx, "evt_1") // touch evt_1 so evt_2 becomes the oldest
+	require.NoError(t, s.Complete(ctx, "evt_3", "delivered"))
+
+	assert.Equal(t, 2, s.Len())
+	_, claimed, _ := s.Claim(ctx, "evt_1")
+	assert.False(t, claimed)
+	_, claimed, _ = s.Claim(ctx, "evt_2")
+	assert.True(t, claimed, "evt_2 should have been evicted")
+}
+
+func TestBoltStore_SurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "idempotency.db")
+
+	s, err := NewBoltStore(path, Options{})
+	require.NoError(t, err)
+	require.NoError(t, s.Complete(ctx, "evt_1", "delivered"))
+	require.NoError(t, s.Close())
+
+	s, err = NewBoltStore(path, Options{})
+	require.NoError(t, err)
+	defer s.Close()
+
+	record, claimed, err := s.Claim(ctx, "evt_1")
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, "delivered", record.Status)
+}
+
+func TestBoltStore_Sweep(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{now: time.Now()}
+	s, err := NewBoltStore(filepath.Join(t.TempDir(), "idempotency.db"), Options{TTL: time.Hour})
+	require.NoError(t, err)
+	defer s.Close()
+	s.now = c.Now
+
+	require.NoError(t, s.Complete(ctx, "evt_old", "delivered"))
+	c.now = c.now.Add(90 * time.Minute)
+	require.NoError(t, s.Complete(ctx, "evt_new", "delivered"))
+
+	removed, err := s.Sweep()
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+}
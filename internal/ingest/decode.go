@@ -0,0 +1,89 @@
+package ingest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/utils"
+)
+
+// ParseEvent decodes and validates a raw body into a Gigs event.
+// The body is either a Pub/Sub push envelope or a bare Gigs event.
+func ParseEvent(body []byte) (models.BaseEvent, error) {
+	var shape struct {
+		Message json.RawMessage `json:"message"`
+	}
+	if err := json.Unmarshal(body, &shape); err != nil {
+		return models.BaseEvent{}, invalidBodyError()
+	}
+
+	if len(shape.Message) == 0 {
+		return decodeEvent(body)
+	}
+
+	var envelope models.PubSubMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return models.BaseEvent{}, invalidBodyError()
+	}
+
+	return DecodePubSubMessage(envelope)
+}
+
+// DecodePubSubMessage extracts the Gigs event from a Pub/Sub message and attaches its metadata
+func DecodePubSubMessage(envelope models.PubSubMessage) (models.BaseEvent, error) {
+	if envelope.Message.Data == "" {
+		return models.BaseEvent{}, &utils.ValidationError{
+			Code:   "message.data",
+			Detail: utils.GetValidationMessage("required"),
+		}
+	}
+
+	data, err := base64.StdEncoding.DecodeString(envelope.Message.Data)
+	if err != nil {
+		return models.BaseEvent{}, &utils.ValidationError{
+			Code:   "message.data",
+			Detail: "Message data is not valid base64",
+		}
+	}
+
+	gigsEvent, err := decodeEvent(data)
+	if err != nil {
+		return models.BaseEvent{}, err
+	}
+
+	gigsEvent.PubSub = envelope.Metadata()
+	return gigsEvent, nil
+}
+
+func decodeEvent(data []byte) (models.BaseEvent, error) {
+	var gigsEvent models.BaseEvent
+	if err := json.Unmarshal(data, &gigsEvent); err != nil {
+		return models.BaseEvent{}, invalidBodyError()
+	}
+
+	if err := binding.Validator.ValidateStruct(&gigsEvent); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			// Return the first validation error
+			for _, err := range validationErrors {
+				return models.BaseEvent{}, &utils.ValidationError{
+					Code:   err.Field(),
+					Detail: utils.GetValidationMessage(err.Tag()),
+				}
+			}
+		}
+		return models.BaseEvent{}, invalidBodyError()
+	}
+
+	return gigsEvent, nil
+}
+
+// invalidBodyError is returned when the body is not JSON or not the expected shape
+func invalidBodyError() *utils.ValidationError {
+	return &utils.ValidationError{
+		Code:   "body",
+		Detail: "Invalid JSON format in request body",
+	}
+}
@@ -0,0 +1,114 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+
+	"github.com/markonick/gigs-challenge/internal/logger"
+	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/services"
+	"github.com/markonick/gigs-challenge/internal/utils"
+)
+
+// Outcome tells an ingestion source what to do with a message after dispatching it
+type Outcome int
+
+const (
+	// Ack the message, it was handled
+	Ack Outcome = iota
+	// Retry the message later, the failure is transient
+	Retry
+	// Reject the message, it can never succeed and redelivering it is pointless
+	Reject
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Ack:
+		return "ack"
+	case Retry:
+		return "retry"
+	case Reject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+// AdmitFunc returns an error when the event cannot be delivered right now, e.g. while
+// the Svix circuit breaker is open. The error is answered instead of accepting the event.
+type AdmitFunc func(event models.BaseEvent) error
+
+// Dispatcher is the single entry point every ingestion source (HTTP push, pull
+// subscription) feeds decoded events into
+type Dispatcher struct {
+	taskService services.TaskService
+	admit       AdmitFunc
+}
+
+// NewDispatcher creates a dispatcher, a nil admit accepts every event
+func NewDispatcher(taskService services.TaskService, admit AdmitFunc) *Dispatcher {
+	return &Dispatcher{
+		taskService: taskService,
+		admit:       admit,
+	}
+}
+
+// Dispatch hands the event over to the task service
+// Everything logged while handling the event carries its ID, project and type.
+func (d *Dispatcher) Dispatch(ctx context.Context, event models.BaseEvent) (services.ProcessResult, error) {
+	ctx = logger.WithEvent(ctx, event)
+	if d.admit != nil {
+		if err := d.admit(event); err != nil {
+			logger.Ctx(ctx).Warn().
+				Err(err).
+				Msg("Turning event away, delivery is failing fast")
+			return services.ProcessResult{}, err
+		}
+	}
+	return d.taskService.ProcessEvent(ctx, event)
+}
+
+// DispatchMessage decodes a Pub/Sub message, dispatches it and classifies the result
+func (d *Dispatcher) DispatchMessage(ctx context.Context, message models.PubSubMessage) (models.BaseEvent, Outcome, error) {
+	event, err := DecodePubSubMessage(message)
+	if err != nil {
+		logger.Ctx(ctx).Warn().
+			Err(err).
+			Str("message_id", message.Message.MessageID).
+			Msg("Rejecting undecodable Pub/Sub message")
+		return event, Reject, err
+	}
+
+	_, err = d.Dispatch(ctx, event)
+	return event, Classify(err), err
+}
+
+// Classify maps a dispatch error onto the action the ingestion source should take
+func Classify(err error) Outcome {
+	if err == nil {
+		return Ack
+	}
+
+	var (
+		validationErr *utils.ValidationError
+		tooLargeErr   *utils.PayloadTooLargeError
+		conflictErr   *utils.ConflictError
+		notFoundErr   *utils.NotFoundError
+	)
+	switch {
+	case errors.As(err, &conflictErr) && conflictErr.Code == services.EventInProgressCode:
+		// Another delivery is working on it, check back later in case it fails
+		return Retry
+	case errors.As(err, &conflictErr):
+		// Svix already has a message with this event ID
+		return Ack
+	case errors.As(err, &validationErr), errors.As(err, &tooLargeErr):
+		return Reject
+	case errors.As(err, &notFoundErr) && notFoundErr.Code == utils.UnknownProjectCode:
+		// The project is not on the allowlist, redelivering does not change that
+		return Reject
+	default:
+		return Retry
+	}
+}
@@ -0,0 +1,116 @@
+package ingest
+
+import (
+	"context"
+	"time"
+
+	"github.com/markonick/gigs-challenge/internal/logger"
+	"github.com/markonick/gigs-challenge/internal/metrics"
+	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/tracing"
+	"github.com/markonick/gigs-challenge/internal/utils"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PullConfig holds the flow control and lease settings of a PullConsumer
+type PullConfig struct {
+	// MaxOutstandingMessages caps the number of leased messages being processed at once
+	MaxOutstandingMessages int
+	// Streams is the number of StreamingPull streams kept open
+	Streams int
+	// AckDeadline is the longest lease extension at a time, between 10s and 600s. It bounds
+	// how long a message stays leased when the process dies while processing it.
+	AckDeadline time.Duration
+}
+
+// DefaultPullConfig is used for any zero valued PullConfig field
+var DefaultPullConfig = PullConfig{
+	MaxOutstandingMessages: 100,
+	Streams:                1,
+	AckDeadline:            60 * time.Second,
+}
+
+// PullConsumer receives messages from a pull subscription over StreamingPull and feeds them
+// into the Dispatcher. Messages are acked on success and nacked on retryable failures, the
+// redelivery backoff comes from the retry policy of the subscription. The subscription keeps
+// the leases of the messages being processed extended, also while the consumer shuts down.
+type PullConsumer struct {
+	subscription Subscription
+	dispatcher   *Dispatcher
+	config       PullConfig
+}
+
+func NewPullConsumer(subscription Subscription, dispatcher *Dispatcher, config PullConfig) *PullConsumer {
+	if config.MaxOutstandingMessages <= 0 {
+		config.MaxOutstandingMessages = DefaultPullConfig.MaxOutstandingMessages
+	}
+	if config.Streams <= 0 {
+		config.Streams = DefaultPullConfig.Streams
+	}
+	if config.AckDeadline <= 0 {
+		config.AckDeadline = DefaultPullConfig.AckDeadline
+	}
+
+	return &PullConsumer{
+		subscription: subscription,
+		dispatcher:   dispatcher,
+		config:       config,
+	}
+}
+
+// Run receives messages until the context is cancelled, waits for the messages already
+// leased to finish processing and closes the subscription
+func (c *PullConsumer) Run(ctx context.Context) error {
+	logger.Log.Info().
+		Str("subscription", c.subscription.Name()).
+		Int("max_outstanding", c.config.MaxOutstandingMessages).
+		Int("streams", c.config.Streams).
+		Msg("Starting Pub/Sub pull consumer")
+
+	defer func() {
+		if err := c.subscription.Close(); err != nil {
+			logger.Log.Warn().Err(err).Msg("Failed to close Pub/Sub subscription")
+		}
+	}()
+	return c.subscription.Receive(ctx, c.config, c.handle)
+}
+
+func (c *PullConsumer) handle(ctx context.Context, msg ReceivedMessage) {
+	metrics.NotificationsReceived.WithLabelValues("pull").Inc()
+	ctx, span := tracing.Start(tracing.FromAttributes(ctx, msg.Message.Attributes), "pubsub.receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingMessageID(msg.Message.MessageID),
+			semconv.MessagingDestinationName(c.subscription.Name()),
+		))
+	event, outcome, err := c.dispatcher.DispatchMessage(ctx, models.PubSubMessage{
+		Message:      msg.Message,
+		Subscription: c.subscription.Name(),
+	})
+	span.SetAttributes(tracing.EventAttributes(event)...)
+	span.SetAttributes(attribute.Stringer("pubsub.outcome", outcome))
+	tracing.End(span, err)
+	if err != nil {
+		metrics.NotificationsRejected.WithLabelValues("pull", utils.ErrorClass(err)).Inc()
+	}
+
+	switch outcome {
+	case Retry:
+		msg.Nack()
+	default:
+		msg.Ack()
+	}
+
+	log := logger.Ctx(ctx).Info()
+	if err != nil {
+		log = logger.Ctx(ctx).Warn().Err(err)
+	}
+	log.
+		Str("event_id", event.ID).
+		Str("message_id", msg.Message.MessageID).
+		Int("delivery_attempt", msg.DeliveryAttempt).
+		Stringer("outcome", outcome).
+		Msg("Processed pulled message")
+}
@@ -0,0 +1,197 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/services"
+	"github.com/markonick/gigs-challenge/internal/utils"
+)
+
+// fakeTaskService records dispatched events and returns a scripted error per event ID
+type fakeTaskService struct {
+	mu      sync.Mutex
+	events  []models.BaseEvent
+	errs    map[string]error
+	delay   time.Duration
+	active  int32
+	maxSeen int32
+}
+
+func (f *fakeTaskService) ProcessEvent(_ context.Context, event models.BaseEvent) (services.ProcessResult, error) {
+	active := atomic.AddInt32(&f.active, 1)
+	defer atomic.AddInt32(&f.active, -1)
+	for {
+		seen := atomic.LoadInt32(&f.maxSeen)
+		if active <= seen || atomic.CompareAndSwapInt32(&f.maxSeen, seen, active) {
+			break
+		}
+	}
+	time.Sleep(f.delay)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+	return services.ProcessResult{}, f.errs[event.ID]
+}
+
+func (f *fakeTaskService) Recover(_ context.Context) (int, error) {
+	return 0, nil
+}
+
+// newTestSubscription returns the subscription of a topic on an in-process Pub/Sub server
+func newTestSubscription(t *testing.T) (*pstest.Server, Subscription, string) {
+	t.Helper()
+	ctx := context.Background()
+	server := pstest.NewServer()
+	t.Cleanup(func() { _ = server.Close() })
+
+	conn, err := grpc.NewClient(server.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	admin, err := pubsub.NewClient(ctx, "test", option.WithGRPCConn(conn))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = admin.Close() })
+
+	topic, err := admin.CreateTopic(ctx, "events")
+	require.NoError(t, err)
+	_, err = admin.CreateSubscription(ctx, "hookbro", pubsub.SubscriptionConfig{Topic: topic, AckDeadline: 10 * time.Second})
+	require.NoError(t, err)
+
+	subscription, err := NewSubscription(ctx, "projects/test/subscriptions/hookbro", "", server.Addr)
+	require.NoError(t, err)
+	return server, subscription, topic.String()
+}
+
+func gigsEvent(id string) []byte {
+	raw, _ := json.Marshal(models.BaseEvent{
+		ID:      id,
+		Type:    "user.created",
+		Project: "dev",
+		Data:    map[string]interface{}{"id": "usr_1"},
+	})
+	return raw
+}
+
+// runConsumer runs the consumer until the test ends or the returned stop function is called
+func runConsumer(t *testing.T, consumer *PullConsumer) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		assert.NoError(t, consumer.Run(ctx))
+		close(done)
+	}()
+	stop := func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return stop
+}
+
+func acked(server *pstest.Server, ids ...string) bool {
+	for _, id := range ids {
+		if server.Message(id).Acks == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// nacked reports whether the lease of the message was released for redelivery
+func nacked(server *pstest.Server, id string) bool {
+	for _, modack := range server.Message(id).Modacks {
+		if modack.AckDeadline == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPullConsumer_SettlesMessages(t *testing.T) {
+	server, subscription, topic := newTestSubscription(t)
+	ids := map[string]string{}
+	for _, name := range []string{"ok", "retry", "duplicate", "invalid", "unknown"} {
+		ids[name] = server.Publish(topic, gigsEvent("evt_"+name), nil)
+	}
+	ids["garbage"] = server.Publish(topic, []byte("not json"), nil)
+
+	service := &fakeTaskService{errs: map[string]error{
+		"evt_retry":     utils.NewRateLimitError("slow down"),
+		"evt_duplicate": utils.NewConflictError("already sent"),
+		"evt_invalid":   utils.NewValidationError("validation_failed", "bad payload"),
+		"evt_unknown":   &utils.NotFoundError{Code: utils.UnknownProjectCode, Detail: "project not allowed"},
+	}}
+	stop := runConsumer(t, NewPullConsumer(subscription, NewDispatcher(service, nil), PullConfig{}))
+
+	require.Eventually(t, func() bool {
+		return acked(server, ids["ok"], ids["duplicate"], ids["invalid"], ids["unknown"], ids["garbage"]) &&
+			nacked(server, ids["retry"])
+	}, 5*time.Second, 10*time.Millisecond)
+	stop()
+
+	assert.Zero(t, server.Message(ids["retry"]).Acks, "retryable failure must be redelivered")
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	for _, event := range service.events {
+		assert.NotEqual(t, "", event.ID, "undecodable message must not reach the task service")
+		require.NotNil(t, event.PubSub)
+		assert.Equal(t, subscription.Name(), event.PubSub.Subscription)
+	}
+}
+
+func TestPullConsumer_FlowControl(t *testing.T) {
+	server, subscription, topic := newTestSubscription(t)
+	var ids []string
+	for i := 0; i < 20; i++ {
+		ids = append(ids, server.Publish(topic, gigsEvent(fmt.Sprintf("evt_%d", i)), nil))
+	}
+	service := &fakeTaskService{delay: 20 * time.Millisecond}
+
+	runConsumer(t, NewPullConsumer(subscription, NewDispatcher(service, nil), PullConfig{MaxOutstandingMessages: 3}))
+	require.Eventually(t, func() bool { return acked(server, ids...) }, 5*time.Second, 10*time.Millisecond)
+
+	assert.LessOrEqual(t, atomic.LoadInt32(&service.maxSeen), int32(3))
+}
+
+func TestPullConsumer_SettlesInFlightMessagesOnShutdown(t *testing.T) {
+	server, subscription, topic := newTestSubscription(t)
+	id := server.Publish(topic, gigsEvent("evt_slow"), nil)
+	service := &fakeTaskService{delay: 200 * time.Millisecond}
+
+	stop := runConsumer(t, NewPullConsumer(subscription, NewDispatcher(service, nil), PullConfig{}))
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&service.active) == 1 }, 5*time.Second, time.Millisecond)
+	stop()
+
+	assert.Equal(t, 1, server.Message(id).Acks)
+	assert.Equal(t, 1, server.Message(id).Deliveries, "the message must not be redelivered while in flight")
+}
+
+func TestParseSubscription(t *testing.T) {
+	project, name, err := ParseSubscription("projects/gigs/subscriptions/hookbro")
+	require.NoError(t, err)
+	assert.Equal(t, "gigs", project)
+	assert.Equal(t, "hookbro", name)
+
+	for _, invalid := range []string{"", "hookbro", "projects/gigs/topics/hookbro", "projects//subscriptions/hookbro"} {
+		_, _, err := ParseSubscription(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
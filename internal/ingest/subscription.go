@@ -0,0 +1,125 @@
+package ingest
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/markonick/gigs-challenge/internal/models"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// DefaultPubSubEndpoint is the public Pub/Sub gRPC endpoint
+const DefaultPubSubEndpoint = "pubsub.googleapis.com:443"
+
+// ReceivedMessage is a message leased from a pull subscription, settled with Ack or Nack
+type ReceivedMessage struct {
+	Message         models.PubSubMessagePayload
+	DeliveryAttempt int
+
+	ack  func()
+	nack func()
+}
+
+// Ack tells Pub/Sub the message was handled
+func (m ReceivedMessage) Ack() {
+	m.ack()
+}
+
+// Nack hands the message back for redelivery, after the backoff of the subscription retry policy
+func (m ReceivedMessage) Nack() {
+	m.nack()
+}
+
+// Subscription streams the messages of a pull subscription
+type Subscription interface {
+	Name() string
+	// Receive calls handle concurrently for every leased message until ctx is cancelled.
+	// At most config.MaxOutstandingMessages are leased at once and their leases are
+	// extended until they are settled, also after ctx is cancelled. Receive returns
+	// once every call of handle has returned.
+	Receive(ctx context.Context, config PullConfig, handle func(ctx context.Context, msg ReceivedMessage)) error
+	Close() error
+}
+
+// ParseSubscription splits projects/{project}/subscriptions/{name} into the project and the name
+func ParseSubscription(subscription string) (project, name string, err error) {
+	parts := strings.Split(subscription, "/")
+	if len(parts) != 4 || parts[0] != "projects" || parts[1] == "" || parts[2] != "subscriptions" || parts[3] == "" {
+		return "", "", fmt.Errorf("invalid subscription %q, expected projects/{project}/subscriptions/{name}", subscription)
+	}
+	return parts[1], parts[3], nil
+}
+
+// streamingSubscription receives messages over StreamingPull with the Pub/Sub client,
+// which keeps the stream open, applies the flow control and extends the leases
+type streamingSubscription struct {
+	name   string
+	client *pubsub.Client
+	sub    *pubsub.Subscription
+}
+
+// NewSubscription connects to projects/{project}/subscriptions/{name} at the gRPC endpoint
+// with the application default credentials. With an emulator host the endpoint and the
+// credentials are not used.
+func NewSubscription(ctx context.Context, subscription, endpoint, emulatorHost string, opts ...option.ClientOption) (Subscription, error) {
+	project, name, err := ParseSubscription(subscription)
+	if err != nil {
+		return nil, err
+	}
+
+	if emulatorHost != "" {
+		opts = append([]option.ClientOption{
+			option.WithEndpoint(emulatorHost),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+		}, opts...)
+	} else if endpoint != "" {
+		opts = append([]option.ClientOption{option.WithEndpoint(endpoint)}, opts...)
+	}
+
+	client, err := pubsub.NewClient(ctx, project, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pub/sub client: %w", err)
+	}
+	return &streamingSubscription{
+		name:   subscription,
+		client: client,
+		sub:    client.Subscription(name),
+	}, nil
+}
+
+func (s *streamingSubscription) Name() string {
+	return s.name
+}
+
+func (s *streamingSubscription) Receive(ctx context.Context, config PullConfig, handle func(ctx context.Context, msg ReceivedMessage)) error {
+	s.sub.ReceiveSettings.MaxOutstandingMessages = config.MaxOutstandingMessages
+	s.sub.ReceiveSettings.NumGoroutines = config.Streams
+	s.sub.ReceiveSettings.MaxExtensionPeriod = config.AckDeadline
+
+	return s.sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+		received := ReceivedMessage{
+			Message: models.PubSubMessagePayload{
+				Data:        base64.StdEncoding.EncodeToString(msg.Data),
+				Attributes:  msg.Attributes,
+				MessageID:   msg.ID,
+				PublishTime: msg.PublishTime,
+			},
+			ack:  msg.Ack,
+			nack: msg.Nack,
+		}
+		if msg.DeliveryAttempt != nil {
+			received.DeliveryAttempt = *msg.DeliveryAttempt
+		}
+		handle(ctx, received)
+	})
+}
+
+func (s *streamingSubscription) Close() error {
+	return s.client.Close()
+}
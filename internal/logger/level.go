@@ -0,0 +1,128 @@
+package logger
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// level is the minimum level written, it can be changed at runtime with SetLevel
+var level atomic.Int32
+
+// SetLevel changes the minimum level written by every logger
+func SetLevel(l zerolog.Level) {
+	level.Store(int32(l))
+}
+
+// Level returns the minimum level written
+func Level() zerolog.Level {
+	return zerolog.Level(level.Load())
+}
+
+// levelSampler drops the lines below the current level before handing the others to next
+type levelSampler struct {
+	next zerolog.Sampler
+}
+
+func (s levelSampler) Sample(l zerolog.Level) bool {
+	if l < Level() {
+		return false
+	}
+	return s.next == nil || s.next.Sample(l)
+}
+
+// eventSampler writes the debug lines of an event with debug logging enabled for its
+// project or type, whatever the level, and leaves the other lines to next
+type eventSampler struct {
+	project   string
+	eventType string
+	next      zerolog.Sampler
+}
+
+func (s eventSampler) Sample(l zerolog.Level) bool {
+	if l >= zerolog.DebugLevel && debugEnabled(s.project, s.eventType, time.Now()) {
+		return true
+	}
+	return s.next.Sample(l)
+}
+
+// DebugScope selects the events debug logging is enabled for, an empty field matches any value
+type DebugScope struct {
+	Project   string `json:"project,omitempty"`
+	EventType string `json:"event_type,omitempty"`
+}
+
+// ActiveDebugScope is a scope with debug logging enabled until Until
+type ActiveDebugScope struct {
+	DebugScope
+	Until time.Time `json:"until"`
+}
+
+// DebugConfig bounds how long scoped debug logging stays on
+type DebugConfig struct {
+	// DefaultDuration applies when no duration is given
+	DefaultDuration time.Duration
+	MaxDuration     time.Duration
+}
+
+var DefaultDebugConfig = DebugConfig{
+	DefaultDuration: 15 * time.Minute,
+	MaxDuration:     time.Hour,
+}
+
+var debugScopes = struct {
+	sync.RWMutex
+	until map[DebugScope]time.Time
+}{until: map[DebugScope]time.Time{}}
+
+// EnableDebug writes the debug lines of the events in the scope until the time,
+// replacing an earlier deadline of the same scope
+func EnableDebug(scope DebugScope, until time.Time) {
+	debugScopes.Lock()
+	defer debugScopes.Unlock()
+	debugScopes.until[scope] = until
+}
+
+// DisableDebug ends debug logging for the scope and reports whether it was enabled
+func DisableDebug(scope DebugScope) bool {
+	debugScopes.Lock()
+	defer debugScopes.Unlock()
+	until, found := debugScopes.until[scope]
+	delete(debugScopes.until, scope)
+	return found && until.After(time.Now())
+}
+
+// DebugScopes returns the scopes with debug logging enabled, dropping the expired ones
+func DebugScopes() []ActiveDebugScope {
+	debugScopes.Lock()
+	defer debugScopes.Unlock()
+
+	now := time.Now()
+	active := []ActiveDebugScope{}
+	for scope, until := range debugScopes.until {
+		if !until.After(now) {
+			delete(debugScopes.until, scope)
+			continue
+		}
+		active = append(active, ActiveDebugScope{DebugScope: scope, Until: until})
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].Until.Before(active[j].Until) })
+	return active
+}
+
+func debugEnabled(project, eventType string, now time.Time) bool {
+	debugScopes.RLock()
+	defer debugScopes.RUnlock()
+	for scope, until := range debugScopes.until {
+		if !until.After(now) {
+			continue
+		}
+		if (scope.Project == "" || scope.Project == project) && (scope.EventType == "" || scope.EventType == eventType) {
+			return true
+		}
+	}
+	return false
+}
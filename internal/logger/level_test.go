@@ -0,0 +1,103 @@
+package logger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+)
+
+func TestSetLevel(t *testing.T) {
+	out := configure(t, Config{Format: FormatJSON, Level: "info"})
+
+	Log.Debug().Msg("hidden")
+	SetLevel(zerolog.DebugLevel)
+	Log.Debug().Msg("shown")
+	SetLevel(zerolog.WarnLevel)
+	Log.Info().Msg("hidden")
+
+	written := lines(t, out)
+	require.Len(t, written, 1)
+	assert.Equal(t, "shown", written[0]["message"])
+	assert.Equal(t, zerolog.WarnLevel, Level())
+}
+
+func TestEnableDebug(t *testing.T) {
+	t.Cleanup(func() {
+		for _, scope := range DebugScopes() {
+			DisableDebug(scope.DebugScope)
+		}
+	})
+
+	activated := models.BaseEvent{ID: "evt_1", Project: "dev", Type: "subscription.activated"}
+	ended := models.BaseEvent{ID: "evt_2", Project: "dev", Type: "subscription.ended"}
+	other := models.BaseEvent{ID: "evt_3", Project: "prod", Type: "subscription.activated"}
+
+	tests := []struct {
+		name  string
+		scope DebugScope
+		until time.Time
+		want  []string
+	}{
+		{
+			name:  "project",
+			scope: DebugScope{Project: "dev"},
+			until: time.Now().Add(time.Hour),
+			want:  []string{"evt_1", "evt_2"},
+		},
+		{
+			name:  "event type",
+			scope: DebugScope{EventType: "subscription.activated"},
+			until: time.Now().Add(time.Hour),
+			want:  []string{"evt_1", "evt_3"},
+		},
+		{
+			name:  "project and event type",
+			scope: DebugScope{Project: "dev", EventType: "subscription.ended"},
+			until: time.Now().Add(time.Hour),
+			want:  []string{"evt_2"},
+		},
+		{
+			name:  "expired",
+			scope: DebugScope{Project: "dev"},
+			until: time.Now().Add(-time.Second),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := configure(t, Config{Format: FormatJSON, Level: "info"})
+			EnableDebug(tt.scope, tt.until)
+			defer DisableDebug(tt.scope)
+
+			for _, event := range []models.BaseEvent{activated, ended, other} {
+				Ctx(WithEvent(context.Background(), event)).Debug().Msg("details")
+			}
+			Log.Debug().Msg("unscoped")
+
+			var logged []string
+			for _, line := range lines(t, out) {
+				logged = append(logged, line["event_id"].(string))
+			}
+			assert.Equal(t, tt.want, logged)
+		})
+	}
+}
+
+func TestDebugScopes(t *testing.T) {
+	EnableDebug(DebugScope{Project: "dev"}, time.Now().Add(time.Hour))
+	EnableDebug(DebugScope{Project: "old"}, time.Now().Add(-time.Second))
+
+	scopes := DebugScopes()
+	require.Len(t, scopes, 1)
+	assert.Equal(t, "dev", scopes[0].Project)
+
+	assert.True(t, DisableDebug(DebugScope{Project: "dev"}))
+	assert.False(t, DisableDebug(DebugScope{Project: "dev"}))
+	assert.Empty(t, DebugScopes())
+}
@@ -1,34 +1,174 @@
 package logger
 
 import (
-	"os"
-	"time"
-
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"strings"
+	"time"
 
+	"github.com/markonick/gigs-challenge/internal/models"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var Log zerolog.Logger
 
+// sampler is the sampler of Log, event loggers wrap it
+var sampler levelSampler
+
+// Output formats
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+// Config describes how and what is logged
+type Config struct {
+	// Format is json for log pipelines or console for humans
+	Format string
+	// Level is the minimum level written: trace, debug, info, warn or error
+	Level string
+	// Caller adds the file and line of the log call
+	Caller   bool
+	Sampling Sampling
+	// RedactFields are the field names whose values never reach the output, see Redact
+	RedactFields []string
+	// Output receives the lines, os.Stdout when nil
+	Output io.Writer
+}
+
+// Sampling thins out debug and info lines, warnings and errors are always written.
+// Burst lines are written per Period, one second when zero, beyond that one in every N
+// or none when N is zero. A zero Burst disables sampling.
+type Sampling struct {
+	Burst  uint32
+	Period time.Duration
+	N      uint32
+}
+
+// sampler shares one budget between the debug and info lines
+func (s Sampling) sampler() zerolog.Sampler {
+	burst := &zerolog.BurstSampler{Burst: s.Burst, Period: s.Period}
+	if burst.Period <= 0 {
+		burst.Period = time.Second
+	}
+	// Without a next sampler every line beyond the burst is dropped
+	if s.N > 0 {
+		burst.NextSampler = &zerolog.BasicSampler{N: s.N}
+	}
+	return &zerolog.LevelSampler{TraceSampler: burst, DebugSampler: burst, InfoSampler: burst}
+}
+
+// DefaultRedactFields cover the personal data found in Gigs event payloads
+var DefaultRedactFields = []string{"phoneNumber", "msisdn", "last4", "address", "email"}
+
+// DefaultConfig writes everything to the console, for local development
+var DefaultConfig = Config{
+	Format:       FormatConsole,
+	Level:        "debug",
+	Caller:       true,
+	RedactFields: DefaultRedactFields,
+}
+
 func init() {
-	output := zerolog.ConsoleWriter{
-		Out:        os.Stdout,
+	zerolog.TimeFieldFormat = time.RFC3339
+	if err := Configure(DefaultConfig); err != nil {
+		panic(err)
+	}
+}
+
+// Configure replaces Log according to the config and sets the level
+func Configure(config Config) error {
+	parsed, err := zerolog.ParseLevel(strings.ToLower(config.Level))
+	if err != nil || parsed == zerolog.NoLevel {
+		return fmt.Errorf("invalid log level %q", config.Level)
+	}
+
+	output := config.Output
+	if output == nil {
+		output = os.Stdout
+	}
+	switch config.Format {
+	case FormatJSON:
+	case FormatConsole, "":
+		output = consoleWriter(output)
+	default:
+		return fmt.Errorf("invalid log format %q", config.Format)
+	}
+	if len(config.RedactFields) > 0 {
+		output = Redact(output, config.RedactFields)
+	}
+
+	context := zerolog.New(output).Hook(traceHook{}).With().Timestamp()
+	if config.Caller {
+		context = context.Caller()
+	}
+	// The level is enforced by the sampler, so that it can change at runtime and
+	// debug logging can be enabled for some events only, see EnableDebug
+	sampler = levelSampler{}
+	if config.Sampling.Burst > 0 {
+		sampler.next = config.Sampling.sampler()
+	}
+
+	zerolog.SetGlobalLevel(zerolog.TraceLevel)
+	SetLevel(parsed)
+	Log = context.Logger().Sample(sampler)
+	return nil
+}
+
+func consoleWriter(out io.Writer) zerolog.ConsoleWriter {
+	return zerolog.ConsoleWriter{
+		Out:        out,
 		TimeFormat: "2006-01-02 15:04:05", // Direct time format here
 		NoColor:    false,
 		// Indent JSON for better readability
 		FormatMessage: func(i interface{}) string {
-			return "  " + i.(string) // Add two spaces before message
+			return "  " + fmt.Sprint(i) // Add two spaces before message
 		},
 		// Format level with consistent padding
 		FormatLevel: func(i interface{}) string {
 			return strings.ToUpper(fmt.Sprintf("| %-6s|", i)) // Pad level to 6 chars
 		},
 	}
+}
 
-	zerolog.TimeFieldFormat = time.RFC3339
-	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+type loggerKey struct{}
+
+// WithEvent returns ctx carrying a child of Log with the fields of the event,
+// every line logged through Ctx(ctx) while handling the event gets them.
+// The child writes debug lines while debug logging is enabled for the event.
+func WithEvent(ctx context.Context, event models.BaseEvent) context.Context {
+	child := Log.With().
+		Str("event_id", event.ID).
+		Str("project", event.Project).
+		Str("event_type", event.Type).
+		Logger().
+		Sample(eventSampler{project: event.Project, eventType: event.Type, next: sampler})
+	return context.WithValue(ctx, loggerKey{}, &child)
+}
 
-	Log = zerolog.New(output).With().Timestamp().Caller().Logger()
+// Ctx returns the logger carried by ctx, Log when there is none.
+// Its lines are written with ctx, so they carry the IDs of the span in ctx.
+func Ctx(ctx context.Context) *zerolog.Logger {
+	log := &Log
+	if child, ok := ctx.Value(loggerKey{}).(*zerolog.Logger); ok {
+		log = child
+	}
+	withCtx := log.With().Ctx(ctx).Logger()
+	return &withCtx
+}
+
+// traceHook adds the trace and span IDs to lines logged with a context that carries a span,
+// see zerolog.Event.Ctx
+type traceHook struct{}
+
+func (traceHook) Run(e *zerolog.Event, _ zerolog.Level, _ string) {
+	spanContext := trace.SpanContextFromContext(e.GetCtx())
+	if !spanContext.IsValid() {
+		return
+	}
+	e.Str("trace_id", spanContext.TraceID().String()).
+		Str("span_id", spanContext.SpanID().String())
 }
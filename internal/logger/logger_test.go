@@ -0,0 +1,110 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+)
+
+// configure points Log at a buffer for the duration of the test
+func configure(t *testing.T, config Config) *bytes.Buffer {
+	t.Helper()
+	previous, previousSampler, previousLevel := Log, sampler, Level()
+	t.Cleanup(func() {
+		Log, sampler = previous, previousSampler
+		SetLevel(previousLevel)
+	})
+
+	var out bytes.Buffer
+	config.Output = &out
+	require.NoError(t, Configure(config))
+	return &out
+}
+
+// lines decodes the JSON lines written to out
+func lines(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var decoded []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var fields map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &fields), line)
+		decoded = append(decoded, fields)
+	}
+	return decoded
+}
+
+func TestConfigure(t *testing.T) {
+	t.Run("json lines at the configured level", func(t *testing.T) {
+		out := configure(t, Config{Format: FormatJSON, Level: "info"})
+		Log.Debug().Msg("hidden")
+		Log.Info().Msg("shown")
+
+		written := lines(t, out)
+		require.Len(t, written, 1)
+		assert.Equal(t, "shown", written[0]["message"])
+		assert.NotContains(t, written[0], "caller")
+	})
+
+	t.Run("caller", func(t *testing.T) {
+		out := configure(t, Config{Format: FormatJSON, Level: "debug", Caller: true})
+		Log.Info().Msg("with caller")
+		assert.Contains(t, lines(t, out)[0]["caller"], "logger_test.go")
+	})
+
+	t.Run("sampling keeps warnings", func(t *testing.T) {
+		out := configure(t, Config{Format: FormatJSON, Level: "debug", Sampling: Sampling{Burst: 2, Period: time.Hour}})
+		for i := 0; i < 5; i++ {
+			Log.Info().Msg("busy")
+		}
+		Log.Warn().Msg("important")
+
+		written := lines(t, out)
+		require.Len(t, written, 3)
+		assert.Equal(t, "important", written[2]["message"])
+	})
+
+	t.Run("invalid level", func(t *testing.T) {
+		assert.Error(t, Configure(Config{Format: FormatJSON, Level: "loud"}))
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		assert.Error(t, Configure(Config{Format: "xml", Level: "info"}))
+	})
+}
+
+func TestCtx(t *testing.T) {
+	out := configure(t, Config{Format: FormatJSON, Level: "debug"})
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+	ctx = WithEvent(ctx, models.BaseEvent{ID: "evt_1", Project: "dev", Type: "subscription.activated"})
+
+	Ctx(ctx).Info().Msg("handling")
+	Ctx(context.Background()).Info().Msg("no event")
+
+	written := lines(t, out)
+	require.Len(t, written, 2)
+	assert.Equal(t, "evt_1", written[0]["event_id"])
+	assert.Equal(t, "dev", written[0]["project"])
+	assert.Equal(t, "subscription.activated", written[0]["event_type"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", written[0]["trace_id"])
+	assert.Equal(t, "00f067aa0ba902b7", written[0]["span_id"])
+	assert.NotContains(t, written[1], "event_id")
+	assert.NotContains(t, written[1], "trace_id")
+}
@@ -0,0 +1,125 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces the value of a redacted field
+const Redacted = "[REDACTED]"
+
+// droppedLine is written instead of a line that mentions a redacted field but cannot be decoded
+const droppedLine = `{"level":"error","message":"Log line dropped, it could not be redacted"}` + "\n"
+
+// Redact wraps out so that the values of the fields are replaced before a line is written,
+// however deep in the line they are. Field names match case-insensitively and as a suffix,
+// so "address" also covers "billingAddress". Lines without such a field are written as is.
+// JSON embedded in string values, such as a response body in an error message, is scrubbed
+// too, but only "field":value pairs with a string, number or literal value; an object or
+// array under a redacted field inside a string is kept. A line that mentions a field and is
+// not valid JSON is replaced by a placeholder error line.
+func Redact(out io.Writer, fields []string) io.Writer {
+	lowered := make([]string, 0, len(fields))
+	quoted := make([]string, 0, len(fields))
+	for _, field := range fields {
+		lowered = append(lowered, strings.ToLower(field))
+		quoted = append(quoted, regexp.QuoteMeta(field))
+	}
+	// The key and the value may be quoted with escaped quotes when the JSON was encoded twice,
+	// the value is quoted the same way as the key
+	embedded := regexp.MustCompile(`(?i)(\\*")([^"\\]*(?:` + strings.Join(quoted, "|") + `))\\*"(\s*:\s*)(?:\\*".*?\\*"|[^\s,}\]"\\]+)`)
+	return &redactWriter{out: out, fields: lowered, embedded: embedded}
+}
+
+type redactWriter struct {
+	out    io.Writer
+	fields []string
+	// embedded matches "field":value pairs inside string values
+	embedded *regexp.Regexp
+}
+
+func (w *redactWriter) Write(p []byte) (int, error) {
+	if !w.mentions(p) {
+		return w.out.Write(p)
+	}
+
+	var line map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(p))
+	decoder.UseNumber()
+	if err := decoder.Decode(&line); err != nil {
+		// Not a JSON line, nothing can be matched safely
+		return w.drop(p)
+	}
+	w.redact(line)
+
+	encoded, err := json.Marshal(line)
+	if err != nil {
+		return w.drop(p)
+	}
+	if _, err := w.out.Write(append(encoded, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// drop writes the placeholder line in place of p
+func (w *redactWriter) drop(p []byte) (int, error) {
+	if _, err := io.WriteString(w.out, droppedLine); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// mentions tells cheaply whether the line may hold one of the fields
+func (w *redactWriter) mentions(p []byte) bool {
+	lowered := bytes.ToLower(p)
+	for _, field := range w.fields {
+		if bytes.Contains(lowered, []byte(field)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *redactWriter) redact(value interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range value {
+			if w.matches(key) {
+				value[key] = Redacted
+				continue
+			}
+			if text, ok := nested.(string); ok {
+				value[key] = w.scrub(text)
+				continue
+			}
+			w.redact(nested)
+		}
+	case []interface{}:
+		for i, nested := range value {
+			if text, ok := nested.(string); ok {
+				value[i] = w.scrub(text)
+				continue
+			}
+			w.redact(nested)
+		}
+	}
+}
+
+// scrub replaces the values of the fields in JSON embedded in a string value
+func (w *redactWriter) scrub(text string) string {
+	return w.embedded.ReplaceAllString(text, "${1}${2}${1}${3}${1}"+Redacted+"${1}")
+}
+
+func (w *redactWriter) matches(key string) bool {
+	key = strings.ToLower(key)
+	for _, field := range w.fields {
+		if strings.HasSuffix(key, field) {
+			return true
+		}
+	}
+	return false
+}
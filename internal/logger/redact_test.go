@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{
+			name: "line without sensitive fields is written as is",
+			line: `{"level":"info","event_id":"evt_1","message":"Processing"}` + "\n",
+			want: `{"level":"info","event_id":"evt_1","message":"Processing"}` + "\n",
+		},
+		{
+			name: "top level field",
+			line: `{"phoneNumber":"+4915112345678","message":"x"}` + "\n",
+			want: `{"message":"x","phoneNumber":"[REDACTED]"}` + "\n",
+		},
+		{
+			name: "nested fields, suffixes and any case",
+			line: `{"data":{"card":{"Last4":"4242","brand":"visa"},"billingAddress":{"line1":"Main St 1"},"users":[{"email":"a@b.c"}]}}` + "\n",
+			want: `{"data":{"billingAddress":"[REDACTED]","card":{"Last4":"[REDACTED]","brand":"visa"},"users":[{"email":"[REDACTED]"}]}}` + "\n",
+		},
+		{
+			name: "numbers keep their precision",
+			line: `{"address":"x","amount":12345678901234567890}` + "\n",
+			want: `{"address":"[REDACTED]","amount":12345678901234567890}` + "\n",
+		},
+		{
+			name: "fields inside JSON embedded in a string",
+			line: `{"error":"Svix answered 422: {\"email\":\"a@b.c\",\"age\":3,\"billingAddress\": 12}","message":"x"}` + "\n",
+			want: `{"error":"Svix answered 422: {\"email\":\"[REDACTED]\",\"age\":3,\"billingAddress\": \"[REDACTED]\"}","message":"x"}` + "\n",
+		},
+		{
+			name: "fields inside JSON encoded twice",
+			line: `{"body":["{\\\"phoneNumber\\\":\\\"+4915112345678\\\"}"]}` + "\n",
+			want: `{"body":["{\\\"phoneNumber\\\":\\\"[REDACTED]\\\"}"]}` + "\n",
+		},
+		{
+			name: "line that cannot be decoded is replaced",
+			line: `{"email":"a@b.c"` + "\n",
+			want: droppedLine,
+		},
+		{
+			name: "values mentioning a field name are kept",
+			line: `{"message":"phoneNumber missing"}` + "\n",
+			want: `{"message":"phoneNumber missing"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			n, err := Redact(&out, DefaultRedactFields).Write([]byte(tt.line))
+			require.NoError(t, err)
+			assert.Equal(t, len(tt.line), n)
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
+
+func TestConfigure_Redacts(t *testing.T) {
+	out := configure(t, Config{Format: FormatJSON, Level: "info", RedactFields: DefaultRedactFields})
+	Log.Info().Str("phoneNumber", "+4915112345678").Msg("sms sent")
+
+	assert.NotContains(t, out.String(), "+4915112345678")
+	assert.Equal(t, Redacted, lines(t, out)[0]["phoneNumber"])
+}
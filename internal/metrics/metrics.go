@@ -0,0 +1,105 @@
+// Package metrics holds the Prometheus collectors of the service. Packages record
+// into the collectors directly, Handler serves them on /metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "hookbro"
+
+// Registry holds every collector of the service, along with the Go runtime and process collectors
+var Registry = prometheus.NewRegistry()
+
+var (
+	// NotificationsReceived counts the notifications per ingestion source, push or pull
+	NotificationsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_received_total",
+		Help:      "Notifications received, per ingestion source.",
+	}, []string{"source"})
+
+	// NotificationsRejected counts the notifications that were not accepted, by error class
+	NotificationsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_rejected_total",
+		Help:      "Notifications not accepted for delivery, per ingestion source and reason.",
+	}, []string{"source", "reason"})
+
+	// Tasks counts the finished tasks, error_class is empty for succeeded ones
+	Tasks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tasks_total",
+		Help:      "Finished tasks, per outcome, error class, project and event type.",
+	}, []string{"outcome", "error_class", "project", "event_type"})
+
+	// TaskDuration observes how long tasks ran
+	TaskDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "task_duration_seconds",
+		Help:      "Task execution time, per outcome.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"outcome"})
+
+	// QueueDepth is the number of tasks waiting for a worker
+	QueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "worker_queue_depth",
+		Help:      "Tasks waiting for a worker.",
+	})
+
+	// ActiveWorkers is the number of workers running a task
+	ActiveWorkers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "worker_active",
+		Help:      "Workers running a task.",
+	})
+
+	// SvixRequestDuration observes every attempt of a Svix call
+	SvixRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "svix_request_duration_seconds",
+		Help:      "Latency of a single Svix call attempt, per operation and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "result"})
+
+	// SvixRetries counts the retries of Svix operations
+	SvixRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "svix_retries_total",
+		Help:      "Retried Svix calls, per operation.",
+	}, []string{"operation"})
+
+	// DeliveryLatency observes the time from the event time to Svix accepting the message
+	DeliveryLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "delivery_latency_seconds",
+		Help:      "Time from the event time to Svix accepting the message, per project and event type.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600},
+	}, []string{"project", "event_type"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		NotificationsReceived,
+		NotificationsRejected,
+		Tasks,
+		TaskDuration,
+		QueueDepth,
+		ActiveWorkers,
+		SvixRequestDuration,
+		SvixRetries,
+		DeliveryLatency,
+	)
+}
+
+// Handler serves the collectors in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
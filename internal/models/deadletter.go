@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// DeadLetter is an event whose delivery failed and that waits for inspection or replay
+type DeadLetter struct {
+	EventID       string          `json:"event_id"`
+	Event         BaseEvent       `json:"event"`
+	PubSub        *PubSubMetadata `json:"pubsub,omitempty"`
+	ErrorClass    string          `json:"error_class"`
+	Error         string          `json:"error"`
+	Attempts      int             `json:"attempts"`
+	Failures      int             `json:"failures"`
+	FirstFailedAt time.Time       `json:"first_failed_at"`
+	LastFailedAt  time.Time       `json:"last_failed_at"`
+}
+
+// RestoredEvent returns the event with its Pub/Sub metadata attached again
+func (d DeadLetter) RestoredEvent() BaseEvent {
+	event := d.Event
+	event.PubSub = d.PubSub
+	return event
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/go-playground/validator/v10"
 )
 
@@ -13,6 +15,11 @@ type BaseEvent struct {
 	Type    string                 `json:"type" binding:"required"`
 	Project string                 `json:"project" binding:"required"`
 	Data    map[string]interface{} `json:"data" binding:"required"`
+	// Time is when Gigs produced the event, zero when the event has none
+	Time time.Time `json:"time"`
+
+	// PubSub is set when the event arrived wrapped in a Pub/Sub message
+	PubSub *PubSubMetadata `json:"-"`
 }
 
 // RegisterValidators registers custom validators for BaseEvent
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// IdempotencyState is the processing state of an event
+type IdempotencyState string
+
+const (
+	// IdempotencyInFlight means a worker claimed the event and is delivering it
+	IdempotencyInFlight IdempotencyState = "in_flight"
+	// IdempotencyDone means the event was delivered to Svix
+	IdempotencyDone IdempotencyState = "done"
+)
+
+// IdempotencyRecord is what the idempotency store remembers about an event
+type IdempotencyRecord struct {
+	EventID     string           `json:"event_id"`
+	State       IdempotencyState `json:"state"`
+	Status      string           `json:"status,omitempty"`
+	ClaimedAt   time.Time        `json:"claimed_at"`
+	CompletedAt time.Time        `json:"completed_at,omitempty"`
+}
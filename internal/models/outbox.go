@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// OutboxEntry is an accepted event waiting to be delivered to Svix
+type OutboxEntry struct {
+	Event      BaseEvent       `json:"event"`
+	PubSub     *PubSubMetadata `json:"pubsub,omitempty"`
+	AcceptedAt time.Time       `json:"accepted_at"`
+	Replays    int             `json:"replays"`
+}
+
+// NewOutboxEntry captures the event together with its Pub/Sub metadata
+func NewOutboxEntry(event BaseEvent) OutboxEntry {
+	return OutboxEntry{
+		Event:      event,
+		PubSub:     event.PubSub,
+		AcceptedAt: time.Now().UTC(),
+	}
+}
+
+// RestoredEvent returns the event with its Pub/Sub metadata attached again
+func (e OutboxEntry) RestoredEvent() BaseEvent {
+	event := e.Event
+	event.PubSub = e.PubSub
+	return event
+}
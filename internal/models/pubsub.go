@@ -1,8 +1,36 @@
 package models
 
-// PubSubMessage is the wrapper for the Pub/Sub message
+import "time"
+
+// PubSubMessage is the wrapper for the Pub/Sub message as delivered by a push subscription
 type PubSubMessage struct {
-	Message struct {
-		Data string `json:"data"`
-	} `json:"message"`
+	Message      PubSubMessagePayload `json:"message"`
+	Subscription string               `json:"subscription"`
+}
+
+// PubSubMessagePayload is the inner message of a Pub/Sub push request.
+// Data holds the base64 encoded Gigs event.
+type PubSubMessagePayload struct {
+	Data        string            `json:"data"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	MessageID   string            `json:"messageId"`
+	PublishTime time.Time         `json:"publishTime"`
+}
+
+// PubSubMetadata carries the Pub/Sub delivery details alongside the decoded event
+type PubSubMetadata struct {
+	MessageID    string            `json:"message_id"`
+	PublishTime  time.Time         `json:"publish_time"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Subscription string            `json:"subscription,omitempty"`
+}
+
+// Metadata returns the delivery details of the push request without the payload
+func (m PubSubMessage) Metadata() *PubSubMetadata {
+	return &PubSubMetadata{
+		MessageID:    m.Message.MessageID,
+		PublishTime:  m.Message.PublishTime,
+		Attributes:   m.Message.Attributes,
+		Subscription: m.Subscription,
+	}
 }
@@ -0,0 +1,88 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+var entriesBucket = []byte("outbox")
+
+// BoltOutbox is a durable outbox in an embedded bbolt database.
+// Every write is committed to disk before it returns.
+type BoltOutbox struct {
+	db *bolt.DB
+}
+
+func NewBoltOutbox(path string) (*BoltOutbox, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(entriesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise outbox: %w", err)
+	}
+
+	return &BoltOutbox{db: db}, nil
+}
+
+func (o *BoltOutbox) Append(_ context.Context, entry models.OutboxEntry) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return o.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(entriesBucket).Put([]byte(entry.Event.ID), raw)
+	})
+}
+
+func (o *BoltOutbox) Remove(_ context.Context, eventID string) error {
+	return o.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(entriesBucket).Delete([]byte(eventID))
+	})
+}
+
+// List returns the pending entries, oldest first
+func (o *BoltOutbox) List(_ context.Context) ([]models.OutboxEntry, error) {
+	var entries []models.OutboxEntry
+	err := o.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(entriesBucket).ForEach(func(k, v []byte) error {
+			var entry models.OutboxEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("corrupt outbox entry %s: %w", k, err)
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	sortByAcceptedAt(entries)
+	return entries, err
+}
+
+// Close closes the database
+func (o *BoltOutbox) Close() error {
+	return o.db.Close()
+}
+
+func sortByAcceptedAt(entries []models.OutboxEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].AcceptedAt.Before(entries[j].AcceptedAt)
+	})
+}
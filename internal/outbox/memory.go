@@ -0,0 +1,46 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+)
+
+// MemoryOutbox keeps entries in process. It does not survive a crash and is meant
+// for tests and local development.
+type MemoryOutbox struct {
+	mu      sync.Mutex
+	entries map[string]models.OutboxEntry
+}
+
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{entries: make(map[string]models.OutboxEntry)}
+}
+
+func (o *MemoryOutbox) Append(_ context.Context, entry models.OutboxEntry) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.entries[entry.Event.ID] = entry
+	return nil
+}
+
+func (o *MemoryOutbox) Remove(_ context.Context, eventID string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.entries, eventID)
+	return nil
+}
+
+// List returns the pending entries, oldest first
+func (o *MemoryOutbox) List(_ context.Context) ([]models.OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries := make([]models.OutboxEntry, 0, len(o.entries))
+	for _, entry := range o.entries {
+		entries = append(entries, entry)
+	}
+	sortByAcceptedAt(entries)
+	return entries, nil
+}
@@ -0,0 +1,47 @@
+package outbox
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+)
+
+func TestBoltOutbox(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "outbox.db")
+
+	box, err := NewBoltOutbox(path)
+	require.NoError(t, err)
+
+	start := time.Now()
+	for i, id := range []string{"evt_c", "evt_a", "evt_b"} {
+		entry := models.NewOutboxEntry(models.BaseEvent{
+			ID:     id,
+			PubSub: &models.PubSubMetadata{MessageID: "msg_" + id},
+		})
+		entry.AcceptedAt = start.Add(time.Duration(i) * time.Second)
+		require.NoError(t, box.Append(ctx, entry))
+	}
+	require.NoError(t, box.Remove(ctx, "evt_a"))
+	require.NoError(t, box.Close())
+
+	box, err = NewBoltOutbox(path)
+	require.NoError(t, err)
+	defer box.Close()
+
+	entries, err := box.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "evt_c", entries[0].Event.ID, "entries must come back oldest first")
+	assert.Equal(t, "evt_b", entries[1].Event.ID)
+
+	restored := entries[0].RestoredEvent()
+	require.NotNil(t, restored.PubSub)
+	assert.Equal(t, "msg_evt_c", restored.PubSub.MessageID)
+}
@@ -0,0 +1,193 @@
+package reload
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/markonick/gigs-challenge/config"
+	"github.com/markonick/gigs-challenge/internal/logger"
+	"github.com/markonick/gigs-challenge/internal/svix"
+	"github.com/markonick/gigs-challenge/internal/worker"
+	"github.com/rs/zerolog"
+)
+
+// Result lists the settings that changed in a reload by their config file key
+type Result struct {
+	// Applied settings took effect right away
+	Applied []string `json:"applied"`
+	// Ignored settings only take effect on the next restart
+	Ignored []string `json:"ignored"`
+}
+
+// Reloader applies a reloaded configuration to the running service. The project list and
+// allowlist, the Svix retry policies and rate limits, the log level and the worker count
+// change live. Changes to any other setting are reported and ignored, the running service
+// keeps its current value until it is restarted.
+type Reloader struct {
+	registry *svix.ProjectRegistry
+	client   svix.Reconfigurer
+	pool     *worker.Pool
+	// load reads the configuration again, replaced in tests
+	load func() (config.Config, error)
+
+	mu      sync.Mutex
+	current config.Config
+}
+
+func NewReloader(current config.Config, registry *svix.ProjectRegistry, client svix.Reconfigurer, pool *worker.Pool) *Reloader {
+	return &Reloader{
+		registry: registry,
+		client:   client,
+		pool:     pool,
+		load:     current.Reload,
+		current:  current,
+	}
+}
+
+// live reports whether the setting with the config file key can change while the service runs
+func live(key string) bool {
+	switch key {
+	case "svix.projects", "svix.project_allowlist", "log.level", "worker.max_workers":
+		return true
+	}
+	return strings.HasPrefix(key, "svix.retry.") || strings.HasPrefix(key, "svix.rate_limit.")
+}
+
+// Reload loads the configuration again and applies the changes that can be applied live.
+// A configuration that fails to load or validate is rejected as a whole and nothing changes.
+func (r *Reloader) Reload() (Result, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := r.load()
+	if err != nil {
+		logger.Log.Error().
+			Err(err).
+			Msg("Failed to reload configuration, keeping the current one")
+		return Result{}, err
+	}
+
+	var result Result
+	for _, key := range r.current.Changes(next) {
+		if live(key) {
+			result.Applied = append(result.Applied, key)
+		} else {
+			result.Ignored = append(result.Ignored, key)
+		}
+	}
+	if len(result.Ignored) > 0 {
+		logger.Log.Warn().
+			Strs("settings", result.Ignored).
+			Msg("Configuration changes need a restart, ignoring them")
+	}
+	if len(result.Applied) == 0 {
+		logger.Log.Info().Msg("Reloaded configuration, no changes to apply")
+		return result, nil
+	}
+
+	// Everything that can fail is done before anything is applied
+	updated := r.current
+	updated.Svix.Projects = next.Svix.Projects
+	updated.Svix.ProjectAllowlist = next.Svix.ProjectAllowlist
+	updated.Svix.Retry = next.Svix.Retry
+	updated.Svix.RateLimit = next.Svix.RateLimit
+	updated.Log.Level = next.Log.Level
+	updated.Worker.MaxWorkers = next.Worker.MaxWorkers
+	rateLimit, err := updated.Svix.RateLimit.RateLimitConfig()
+	if err != nil {
+		return Result{}, err
+	}
+	level, err := zerolog.ParseLevel(strings.ToLower(updated.Log.Level))
+	if err != nil {
+		return Result{}, err
+	}
+
+	changed := func(prefixes ...string) bool {
+		for _, key := range result.Applied {
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(key, prefix) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if changed("svix.projects", "svix.project_allowlist") {
+		r.registry.SetProjects(updated.Svix.Projects, updated.Svix.ProjectAllowlist)
+	}
+	if changed("svix.retry.") {
+		r.client.SetRetryPolicies(updated.Svix.Retry.Policies())
+	}
+	if changed("svix.rate_limit.") {
+		r.client.SetRateLimits(rateLimit)
+	}
+	if changed("log.level") {
+		logger.SetLevel(level)
+	}
+	if changed("worker.max_workers") {
+		r.pool.Resize(updated.Worker.MaxWorkers)
+	}
+	r.current = updated
+
+	logger.Log.Info().
+		Strs("settings", result.Applied).
+		Msg("Applied configuration changes")
+	return result, nil
+}
+
+// Run reloads the configuration on SIGHUP and, with a watch interval, whenever the
+// config file changes, until ctx is done
+func (r *Reloader) Run(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	r.mu.Lock()
+	file, interval := r.current.File, r.current.Watch.Interval
+	r.mu.Unlock()
+
+	// A nil channel never fires, without a file to watch only SIGHUP reloads
+	var tick <-chan time.Time
+	if file != "" && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	modified := modTime(file)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			logger.Log.Info().Msg("Received SIGHUP, reloading configuration")
+		case <-tick:
+			current := modTime(file)
+			if current.Equal(modified) {
+				continue
+			}
+			modified = current
+			logger.Log.Info().
+				Str("file", file).
+				Msg("Config file changed, reloading configuration")
+		}
+		_, _ = r.Reload()
+	}
+}
+
+// modTime returns when the file was last modified, zero when it cannot be read
+func modTime(file string) time.Time {
+	if file == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,203 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/config"
+	"github.com/markonick/gigs-challenge/internal/logger"
+	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/svix"
+	"github.com/markonick/gigs-challenge/internal/utils"
+	"github.com/markonick/gigs-challenge/internal/worker"
+)
+
+// fakeClient records the retry policies and rate limits it is reconfigured with
+type fakeClient struct {
+	mu             sync.Mutex
+	retry          svix.RetryPolicies
+	rateLimit      svix.RateLimitConfig
+	retryCalls     int
+	rateLimitCalls int
+}
+
+func (f *fakeClient) Ping(context.Context) error { return nil }
+
+func (f *fakeClient) CreateApplication(_ context.Context, uid, _ string) (string, error) {
+	return "app_" + uid, nil
+}
+
+func (f *fakeClient) SetupApplicationEndpoints(context.Context, string) error { return nil }
+
+func (f *fakeClient) SendMessage(context.Context, string, models.BaseEvent) error { return nil }
+
+func (f *fakeClient) SetRetryPolicies(retry svix.RetryPolicies) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.retry = retry
+	f.retryCalls++
+}
+
+func (f *fakeClient) SetRateLimits(rateLimit svix.RateLimitConfig) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rateLimit = rateLimit
+	f.rateLimitCalls++
+}
+
+// newReloader returns a reloader of the current configuration that loads next
+func newReloader(t *testing.T, current config.Config, next func() (config.Config, error)) (*Reloader, *fakeClient, *worker.Pool) {
+	t.Helper()
+	client := &fakeClient{}
+	pool := worker.NewPool(current.Worker.PoolConfig())
+	t.Cleanup(pool.Close)
+	previous := logger.Level()
+	t.Cleanup(func() { logger.SetLevel(previous) })
+
+	reloader := NewReloader(current, svix.NewProjectRegistry(client, current.Svix.RegistryConfig()), client, pool)
+	reloader.load = next
+	return reloader, client, pool
+}
+
+func baseConfig() config.Config {
+	cfg := config.Default()
+	cfg.Svix.AuthToken = "testsk_token"
+	cfg.Svix.ProjectAllowlist = []string{"dev"}
+	return cfg
+}
+
+func TestReloader_Reload(t *testing.T) {
+	t.Run("applies the live settings", func(t *testing.T) {
+		next := baseConfig()
+		next.Svix.Projects = []string{"dev", "prod"}
+		next.Svix.ProjectAllowlist = []string{"dev", "prod"}
+		next.Svix.Retry.SendMessage.Attempts = 8
+		next.Svix.RateLimit.Projects = []string{"prod=40:80"}
+		next.Log.Level = "warn"
+		next.Worker.MaxWorkers = 3
+
+		reloader, client, pool := newReloader(t, baseConfig(), func() (config.Config, error) { return next, nil })
+		assert.Equal(t, utils.UnknownProjectCode, utils.ErrorClass(reloader.registry.Admit("prod")))
+
+		result, err := reloader.Reload()
+		require.NoError(t, err)
+
+		assert.ElementsMatch(t, []string{
+			"svix.projects",
+			"svix.project_allowlist",
+			"svix.retry.send_message.attempts",
+			"svix.rate_limit.projects",
+			"log.level",
+			"worker.max_workers",
+		}, result.Applied)
+		assert.Empty(t, result.Ignored)
+
+		assert.Contains(t, reloader.registry.Pending(), "prod")
+		var unavailableErr *utils.ServiceUnavailableError
+		require.ErrorAs(t, reloader.registry.Admit("prod"), &unavailableErr)
+		assert.Equal(t, utils.ProjectInitializingCode, unavailableErr.Code)
+		assert.Equal(t, 8, client.retry.For(svix.OperationSendMessage).Attempts)
+		assert.Equal(t, svix.RateLimit{Rate: 40, Burst: 80}, client.rateLimit.Projects["prod"])
+		assert.Equal(t, zerolog.WarnLevel, logger.Level())
+		assert.Equal(t, 3, pool.Stats().Workers)
+	})
+
+	t.Run("ignores settings that need a restart", func(t *testing.T) {
+		next := baseConfig()
+		next.Server.Port = 9090
+		next.Idempotency.Store = "disk"
+		next.Worker.MaxWorkers = 4
+
+		reloader, client, pool := newReloader(t, baseConfig(), func() (config.Config, error) { return next, nil })
+		result, err := reloader.Reload()
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"worker.max_workers"}, result.Applied)
+		assert.Equal(t, []string{"server.port", "idempotency.store"}, result.Ignored)
+		assert.Equal(t, 4, pool.Stats().Workers)
+		assert.Zero(t, client.retryCalls)
+		assert.Zero(t, client.rateLimitCalls)
+
+		// The ignored changes are reported again until the service restarts
+		result, err = reloader.Reload()
+		require.NoError(t, err)
+		assert.Empty(t, result.Applied)
+		assert.Equal(t, []string{"server.port", "idempotency.store"}, result.Ignored)
+	})
+
+	t.Run("changes the retry policies without touching the rate limits", func(t *testing.T) {
+		next := baseConfig()
+		next.Svix.Retry.Attempts = 2
+
+		reloader, client, _ := newReloader(t, baseConfig(), func() (config.Config, error) { return next, nil })
+		_, err := reloader.Reload()
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, client.retryCalls)
+		assert.Zero(t, client.rateLimitCalls)
+	})
+
+	t.Run("keeps the current configuration when the new one is invalid", func(t *testing.T) {
+		reloader, client, pool := newReloader(t, baseConfig(), func() (config.Config, error) {
+			return config.Config{}, errors.New("invalid configuration")
+		})
+		_, err := reloader.Reload()
+		assert.Error(t, err)
+
+		assert.Zero(t, client.retryCalls)
+		assert.Zero(t, client.rateLimitCalls)
+		assert.Equal(t, 10, pool.Stats().Workers)
+		assert.Equal(t, baseConfig(), reloader.current)
+	})
+}
+
+func TestReloader_Run(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hookbro.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("worker:\n  max_workers: 2\n"), 0o600))
+
+	current := baseConfig()
+	current.File = path
+	current.Watch.Interval = 5 * time.Millisecond
+
+	var mu sync.Mutex
+	workers := 2
+	reloader, _, pool := newReloader(t, current, func() (config.Config, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		workers++
+		next := current
+		next.Worker.MaxWorkers = workers
+		return next, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		reloader.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// An unchanged file is not reloaded
+	assert.Never(t, func() bool { return pool.Stats().Workers != 10 }, 50*time.Millisecond, 5*time.Millisecond)
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	require.Eventually(t, func() bool { return pool.Stats().Workers == 3 }, time.Second, 5*time.Millisecond)
+
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	require.Eventually(t, func() bool { return pool.Stats().Workers == 4 }, time.Second, 5*time.Millisecond)
+}
@@ -1,12 +1,66 @@
 package router
 
 import (
+	"net/http/pprof"
+
 	"github.com/gin-gonic/gin"
+	"github.com/markonick/gigs-challenge/internal/auth"
 	controller "github.com/markonick/gigs-challenge/internal/controllers"
+	"github.com/markonick/gigs-challenge/internal/metrics"
 )
 
-func Setup(notificationCtrl *controller.NotificationController) *gin.Engine {
+// Options toggles the optional routes
+type Options struct {
+	// Pprof serves the runtime profiles under /admin/debug/pprof, behind the admin token
+	Pprof bool
+}
+
+func Setup(
+	notificationCtrl *controller.NotificationController,
+	deadLetterCtrl *controller.DeadLetterController,
+	healthCtrl *controller.HealthController,
+	loggingCtrl *controller.LoggingController,
+	pushVerifier *auth.Verifier,
+	adminAuth *auth.AdminAuthenticator,
+	options Options,
+) *gin.Engine {
 	r := gin.Default()
-	r.POST("/notifications", notificationCtrl.Create)
+	r.POST("/notifications", auth.RequirePubSubToken(pushVerifier), notificationCtrl.Create)
+	r.GET("/healthz", healthCtrl.Live)
+	r.GET("/readyz", healthCtrl.Ready)
+	r.GET("/health", healthCtrl.Health)
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// Operator endpoints are only served when an admin token is configured
+	if adminAuth != nil {
+		admin := r.Group("/admin", auth.RequireAdmin(adminAuth))
+		admin.GET("/deadletters", deadLetterCtrl.List)
+		admin.GET("/deadletters/:id", deadLetterCtrl.Get)
+		admin.POST("/deadletters/replay", deadLetterCtrl.Replay)
+		admin.POST("/deadletters/:id/replay", deadLetterCtrl.ReplayOne)
+		admin.DELETE("/deadletters", deadLetterCtrl.Purge)
+		admin.DELETE("/deadletters/:id", deadLetterCtrl.Delete)
+		admin.GET("/logging", loggingCtrl.Get)
+		admin.PUT("/logging/level", loggingCtrl.SetLevel)
+		admin.POST("/logging/debug", loggingCtrl.EnableDebug)
+		admin.DELETE("/logging/debug", loggingCtrl.DisableDebug)
+		if options.Pprof {
+			registerPprof(admin.Group("/debug/pprof"))
+		}
+	}
 	return r
 }
+
+// registerPprof serves the net/http/pprof handlers on the group
+func registerPprof(group *gin.RouterGroup) {
+	group.GET("/", gin.WrapF(pprof.Index))
+	group.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	group.GET("/profile", gin.WrapF(pprof.Profile))
+	group.GET("/symbol", gin.WrapF(pprof.Symbol))
+	group.POST("/symbol", gin.WrapF(pprof.Symbol))
+	group.GET("/trace", gin.WrapF(pprof.Trace))
+	// heap, goroutine, allocs, block, mutex and threadcreate
+	group.GET("/:profile", func(c *gin.Context) {
+		pprof.Handler(c.Param("profile")).ServeHTTP(c.Writer, c.Request)
+	})
+}
@@ -0,0 +1,68 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/markonick/gigs-challenge/internal/auth"
+	controller "github.com/markonick/gigs-challenge/internal/controllers"
+	"github.com/markonick/gigs-challenge/internal/logger"
+)
+
+func TestSetup_Pprof(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	adminAuth := auth.NewAdminAuthenticator("secret")
+
+	tests := []struct {
+		name       string
+		options    Options
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{
+			name:       "index",
+			options:    Options{Pprof: true},
+			path:       "/admin/debug/pprof/",
+			token:      "secret",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "named profile",
+			options:    Options{Pprof: true},
+			path:       "/admin/debug/pprof/goroutine?debug=1",
+			token:      "secret",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "requires the admin token",
+			options:    Options{Pprof: true},
+			path:       "/admin/debug/pprof/",
+			token:      "wrong",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "disabled",
+			path:       "/admin/debug/pprof/",
+			token:      "secret",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := Setup(nil, nil, nil, controller.NewLoggingController(logger.DefaultDebugConfig), nil, adminAuth, tt.options)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/markonick/gigs-challenge/internal/logger"
+	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/utils"
+)
+
+// Replay statuses reported per dead letter
+const (
+	ReplayAccepted  = "accepted"
+	ReplayDuplicate = "duplicate"
+	ReplayNotFound  = "not_found"
+	ReplayFailed    = "failed"
+)
+
+// DeadLetterFilter narrows the dead letters an operation applies to
+type DeadLetterFilter struct {
+	EventIDs   []string
+	ErrorClass string
+	Project    string
+	Limit      int
+}
+
+// ReplayResult is the outcome of replaying a single dead letter
+type ReplayResult struct {
+	EventID string `json:"event_id"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+type DeadLetterService interface {
+	List(ctx context.Context, filter DeadLetterFilter) ([]models.DeadLetter, error)
+	Get(ctx context.Context, eventID string) (models.DeadLetter, error)
+	// Replay sends dead letters back through the TaskService, so idempotency and routing still apply
+	Replay(ctx context.Context, filter DeadLetterFilter) ([]ReplayResult, error)
+	Purge(ctx context.Context, filter DeadLetterFilter) (int, error)
+}
+
+type deadLetterServiceImpl struct {
+	store       DeadLetterStore
+	taskService TaskService
+}
+
+func NewDeadLetterService(store DeadLetterStore, taskService TaskService) DeadLetterService {
+	return &deadLetterServiceImpl{
+		store:       store,
+		taskService: taskService,
+	}
+}
+
+func (d *deadLetterServiceImpl) List(ctx context.Context, filter DeadLetterFilter) ([]models.DeadLetter, error) {
+	entries, err := d.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool, len(filter.EventIDs))
+	for _, id := range filter.EventIDs {
+		ids[id] = true
+	}
+
+	matched := make([]models.DeadLetter, 0, len(entries))
+	for _, entry := range entries {
+		if len(ids) > 0 && !ids[entry.EventID] {
+			continue
+		}
+		if filter.ErrorClass != "" && entry.ErrorClass != filter.ErrorClass {
+			continue
+		}
+		if filter.Project != "" && entry.Event.Project != filter.Project {
+			continue
+		}
+		matched = append(matched, entry)
+		if filter.Limit > 0 && len(matched) == filter.Limit {
+			break
+		}
+	}
+	return matched, nil
+}
+
+func (d *deadLetterServiceImpl) Get(ctx context.Context, eventID string) (models.DeadLetter, error) {
+	entry, found, err := d.store.Get(ctx, eventID)
+	if err != nil {
+		return models.DeadLetter{}, err
+	}
+	if !found {
+		return models.DeadLetter{}, utils.NewNotFoundError(fmt.Sprintf("No dead letter for event %s", eventID))
+	}
+	return entry, nil
+}
+
+func (d *deadLetterServiceImpl) Replay(ctx context.Context, filter DeadLetterFilter) ([]ReplayResult, error) {
+	entries, err := d.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ReplayResult, 0, len(entries))
+	found := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		found[entry.EventID] = true
+		results = append(results, d.replay(ctx, entry))
+	}
+	for _, id := range filter.EventIDs {
+		if !found[id] {
+			results = append(results, ReplayResult{EventID: id, Status: ReplayNotFound})
+		}
+	}
+	return results, nil
+}
+
+// replay removes the dead letter before requeueing, so a task failing again
+// right away writes a fresh dead letter instead of having it removed after the fact
+func (d *deadLetterServiceImpl) replay(ctx context.Context, entry models.DeadLetter) ReplayResult {
+	if _, err := d.store.Delete(ctx, entry.EventID); err != nil {
+		return ReplayResult{EventID: entry.EventID, Status: ReplayFailed, Error: err.Error()}
+	}
+
+	event := entry.RestoredEvent()
+	ctx = logger.WithEvent(ctx, event)
+	result, err := d.taskService.ProcessEvent(ctx, event)
+	if err != nil {
+		if putErr := d.store.Put(ctx, entry); putErr != nil {
+			logger.Ctx(ctx).Error().
+				Err(putErr).
+				Msg("Failed to restore dead letter after replay failure")
+		}
+		return ReplayResult{EventID: entry.EventID, Status: ReplayFailed, Error: err.Error()}
+	}
+
+	status := ReplayAccepted
+	if result.Duplicate {
+		status = ReplayDuplicate
+	}
+	logger.Ctx(ctx).Info().
+		Str("status", status).
+		Msg("Replayed dead letter")
+	return ReplayResult{EventID: entry.EventID, Status: status}
+}
+
+func (d *deadLetterServiceImpl) Purge(ctx context.Context, filter DeadLetterFilter) (int, error) {
+	entries, err := d.List(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.EventID)
+	}
+
+	purged, err := d.store.Delete(ctx, ids...)
+	if err == nil {
+		logger.Log.Info().Int("purged", purged).Msg("Purged dead letters")
+	}
+	return purged, err
+}
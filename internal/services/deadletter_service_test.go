@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/deadletter"
+	"github.com/markonick/gigs-challenge/internal/idempotency"
+	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/outbox"
+	"github.com/markonick/gigs-challenge/internal/utils"
+	"github.com/markonick/gigs-challenge/internal/worker"
+)
+
+func TestDeadLetterService_FailedEventCanBeReplayed(t *testing.T) {
+	ctx := context.Background()
+	store := deadletter.NewMemoryStore()
+	idempotencyStore := idempotency.NewMemoryStore(idempotency.Options{})
+
+	failing := true
+	pool := worker.NewPool(worker.Config{MaxWorkers: 1})
+	taskService := NewTaskService(pool, func(event models.BaseEvent) worker.Task {
+		task := &MockTask{id: event.ID, event: event}
+		if failing {
+			task.err = &utils.RetryExhaustedError{
+				Operation: "send_message",
+				Attempts:  3,
+				Err:       utils.NewRateLimitError("slow down"),
+			}
+		}
+		return task
+	}, idempotencyStore, outbox.NewMemoryOutbox(), store)
+	service := NewDeadLetterService(store, taskService)
+
+	event := models.BaseEvent{ID: "evt_dlq", Type: "user.created", Project: "dev"}
+	_, err := taskService.ProcessEvent(ctx, event)
+	require.NoError(t, err)
+	pool.Close()
+
+	entry, err := service.Get(ctx, event.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "retries_exhausted", entry.ErrorClass)
+	assert.Equal(t, 3, entry.Attempts)
+	assert.Equal(t, 1, entry.Failures)
+	assert.Equal(t, event.Type, entry.Event.Type)
+
+	listed, err := service.List(ctx, DeadLetterFilter{ErrorClass: "retries_exhausted"})
+	require.NoError(t, err)
+	assert.Len(t, listed, 1)
+	listed, err = service.List(ctx, DeadLetterFilter{ErrorClass: "validation_failed"})
+	require.NoError(t, err)
+	assert.Empty(t, listed)
+
+	// Replay once Svix recovers
+	failing = false
+	pool = worker.NewPool(worker.Config{MaxWorkers: 1})
+	taskService = NewTaskService(pool, func(event models.BaseEvent) worker.Task {
+		return &MockTask{id: event.ID, event: event}
+	}, idempotencyStore, outbox.NewMemoryOutbox(), store)
+	service = NewDeadLetterService(store, taskService)
+
+	results, err := service.Replay(ctx, DeadLetterFilter{EventIDs: []string{event.ID, "evt_unknown"}})
+	require.NoError(t, err)
+	pool.Close()
+	assert.Equal(t, []ReplayResult{
+		{EventID: event.ID, Status: ReplayAccepted},
+		{EventID: "evt_unknown", Status: ReplayNotFound},
+	}, results)
+
+	_, err = service.Get(ctx, event.ID)
+	var notFoundErr *utils.NotFoundError
+	assert.ErrorAs(t, err, &notFoundErr)
+
+	// A replayed event that was delivered in the meantime is not sent twice
+	require.NoError(t, store.Put(ctx, entry))
+	results, err = service.Replay(ctx, DeadLetterFilter{EventIDs: []string{event.ID}})
+	require.NoError(t, err)
+	assert.Equal(t, ReplayDuplicate, results[0].Status)
+}
+
+func TestDeadLetterService_Purge(t *testing.T) {
+	ctx := context.Background()
+	store := deadletter.NewMemoryStore()
+	service := NewDeadLetterService(store, nil)
+
+	require.NoError(t, store.Put(ctx, models.DeadLetter{EventID: "evt_1", ErrorClass: "internal"}))
+	require.NoError(t, store.Put(ctx, models.DeadLetter{EventID: "evt_2", ErrorClass: "unknown_project"}))
+	require.NoError(t, store.Put(ctx, models.DeadLetter{EventID: "evt_3", ErrorClass: "unknown_project"}))
+
+	purged, err := service.Purge(ctx, DeadLetterFilter{ErrorClass: "unknown_project"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged)
+
+	remaining, err := service.List(ctx, DeadLetterFilter{})
+	require.NoError(t, err)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, "evt_1", remaining[0].EventID)
+}
@@ -1,47 +1,348 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/markonick/gigs-challenge/internal/logger"
 	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/utils"
 	"github.com/markonick/gigs-challenge/internal/worker"
 )
 
+// EventInProgressCode marks the conflict returned while another delivery of the same event is in flight
+const EventInProgressCode = "event_in_progress"
+
+// DeliveredStatus is recorded for events Svix accepted
+const DeliveredStatus = "delivered"
+
+// CircuitOpenRequeueDelay is how long an event turned away by an open Svix circuit
+// breaker waits before it is queued again
+const CircuitOpenRequeueDelay = 5 * time.Second
+
 type TaskService interface {
-	ProcessEvent(event models.BaseEvent) error
+	ProcessEvent(ctx context.Context, event models.BaseEvent) (ProcessResult, error)
+	// Recover requeues the events left in the outbox by a previous run
+	Recover(ctx context.Context) (int, error)
+}
+
+// IdempotencyStore remembers which events were claimed or delivered, keyed by event ID
+type IdempotencyStore interface {
+	// Claim marks the event as in flight. When the event is already in flight or
+	// delivered the existing record is returned and claimed is false.
+	Claim(ctx context.Context, eventID string) (record models.IdempotencyRecord, claimed bool, err error)
+	// Complete marks the event as delivered with the given status
+	Complete(ctx context.Context, eventID string, status string) error
+	// Release drops an in-flight claim so that a redelivery can try again
+	Release(ctx context.Context, eventID string) error
 }
 
-// Implementation holds channels and task creation function
+// Outbox durably holds accepted events until a worker has settled them
+type Outbox interface {
+	Append(ctx context.Context, entry models.OutboxEntry) error
+	Remove(ctx context.Context, eventID string) error
+	// List returns the pending entries, oldest first
+	List(ctx context.Context) ([]models.OutboxEntry, error)
+}
+
+// DeadLetterStore keeps events whose delivery failed, keyed by event ID
+type DeadLetterStore interface {
+	Put(ctx context.Context, entry models.DeadLetter) error
+	Get(ctx context.Context, eventID string) (models.DeadLetter, bool, error)
+	// List returns all dead letters, most recent failure first
+	List(ctx context.Context) ([]models.DeadLetter, error)
+	Delete(ctx context.Context, eventIDs ...string) (int, error)
+}
+
+// ProcessResult tells the caller whether the event was queued or had been delivered before
+type ProcessResult struct {
+	Duplicate bool
+	Record    models.IdempotencyRecord
+}
+
+// eventTask is implemented by tasks that deliver a Gigs event
+type eventTask interface {
+	Event() models.BaseEvent
+}
+
+// Implementation holds the worker pool, task creation function and the stores
+// that track an event from acceptance to delivery or dead letter
 type taskServiceImpl struct {
-	workerPool *worker.Pool
-	createTask func(models.BaseEvent) worker.Task
+	workerPool       *worker.Pool
+	createTask       func(models.BaseEvent) worker.Task
+	idempotencyStore IdempotencyStore
+	outbox           Outbox
+	deadLetters      DeadLetterStore
+	// requeueDelay is CircuitOpenRequeueDelay, shortened in tests
+	requeueDelay time.Duration
 }
 
-func NewTaskService(numWorkers int, createTask func(models.BaseEvent) worker.Task) TaskService {
-	logger.Log.Info().
-		Int("num_workers", numWorkers).
-		Msg("Initializing task service with worker pool")
-	return &taskServiceImpl{
-		workerPool: worker.NewPool(numWorkers),
-		createTask: createTask,
+func NewTaskService(
+	workerPool *worker.Pool,
+	createTask func(models.BaseEvent) worker.Task,
+	idempotencyStore IdempotencyStore,
+	outbox Outbox,
+	deadLetters DeadLetterStore,
+) TaskService {
+	t := &taskServiceImpl{
+		workerPool:       workerPool,
+		createTask:       createTask,
+		idempotencyStore: idempotencyStore,
+		outbox:           outbox,
+		deadLetters:      deadLetters,
+		requeueDelay:     CircuitOpenRequeueDelay,
 	}
+	workerPool.OnResult(t.recordResult)
+	return t
 }
 
-func (t *taskServiceImpl) ProcessEvent(event models.BaseEvent) error {
+// ProcessEvent writes the event to the outbox and queues it for delivery.
+// The returned error only covers accepting the event, delivery failures are
+// reported through the worker pool result hooks.
+// Events that were already delivered are not queued again.
+func (t *taskServiceImpl) ProcessEvent(ctx context.Context, event models.BaseEvent) (ProcessResult, error) {
+	record, claimed, err := t.idempotencyStore.Claim(ctx, event.ID)
+	if err != nil {
+		logger.Ctx(ctx).Error().
+			Err(err).
+			Msg("Failed to claim event in idempotency store")
+		return ProcessResult{}, err
+	}
+
+	if !claimed {
+		if record.State == models.IdempotencyDone {
+			logger.Ctx(ctx).Info().
+				Str("status", record.Status).
+				Msg("Event already delivered, skipping")
+			return ProcessResult{Duplicate: true, Record: record}, nil
+		}
+		return ProcessResult{Record: record}, &utils.ConflictError{
+			Code:   EventInProgressCode,
+			Detail: fmt.Sprintf("Event %s is already being processed", event.ID),
+		}
+	}
+
+	// Write ahead, so the event survives a crash once we acknowledge it
+	if err := t.outbox.Append(ctx, models.NewOutboxEntry(event)); err != nil {
+		logger.Ctx(ctx).Error().
+			Err(err).
+			Msg("Failed to write event to outbox")
+		t.release(ctx, event.ID)
+		return ProcessResult{}, err
+	}
+
 	task := t.createTask(event)
-	logger.Log.Info().
-		Str("event_id", event.ID).
+	logger.Ctx(ctx).Info().
 		Str("task_id", task.ID()).
 		Msg("Created task, submitting to worker pool")
 
-	err := t.workerPool.ProcessTask(task)
+	err = t.workerPool.ProcessTask(ctx, task)
+	if err != nil {
+		logger.Ctx(ctx).Error().
+			Err(err).
+			Str("task_id", task.ID()).
+			Msg("Failed to queue task")
+		t.removeFromOutbox(ctx, event.ID)
+		t.release(ctx, event.ID)
+		return ProcessResult{}, err
+	}
+
+	return ProcessResult{Record: record}, nil
+}
+
+// Recover requeues every event left in the outbox, waiting for room in the worker queue.
+// Events that turn out to be delivered already are dropped from the outbox.
+func (t *taskServiceImpl) Recover(ctx context.Context) (int, error) {
+	entries, err := t.outbox.List(ctx)
 	if err != nil {
+		return 0, fmt.Errorf("failed to list outbox: %w", err)
+	}
+
+	requeued := 0
+	for _, entry := range entries {
+		event := entry.RestoredEvent()
+
+		// The outbox entry proves this process owned the event, so an
+		// in-flight claim left behind by the crash is ours to take over
+		record, _, err := t.idempotencyStore.Claim(ctx, event.ID)
+		if err != nil {
+			return requeued, fmt.Errorf("failed to claim event %s: %w", event.ID, err)
+		}
+		if record.State == models.IdempotencyDone {
+			t.removeFromOutbox(ctx, event.ID)
+			continue
+		}
+
+		entry.Replays++
+		if err := t.outbox.Append(ctx, entry); err != nil {
+			return requeued, fmt.Errorf("failed to update outbox entry %s: %w", event.ID, err)
+		}
+
+		eventCtx := logger.WithEvent(ctx, event)
+		if err := t.submitWhenRoom(eventCtx, t.createTask(event)); err != nil {
+			return requeued, err
+		}
+		requeued++
+
+		logger.Ctx(eventCtx).Info().
+			Int("replays", entry.Replays).
+			Time("accepted_at", entry.AcceptedAt).
+			Msg("Requeued event from outbox")
+	}
+
+	return requeued, nil
+}
+
+func (t *taskServiceImpl) submitWhenRoom(ctx context.Context, task worker.Task) error {
+	for {
+		err := t.workerPool.ProcessTask(ctx, task)
+		var unavailable *utils.ServiceUnavailableError
+		if err == nil || !errors.As(err, &unavailable) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// recordResult settles the idempotency claim once the task has finished
+func (t *taskServiceImpl) recordResult(result worker.Result) {
+	ctx := context.Background()
+	eventID := result.Task.ID()
+
+	// Cut short by shutdown, the outbox entry stays so the next start redelivers it
+	if result.Interrupted {
+		t.release(ctx, eventID)
+		logger.Log.Warn().
+			Str("event_id", eventID).
+			Msg("Delivery interrupted by shutdown, kept in outbox for redelivery")
+		return
+	}
+
+	// An open circuit breaker is back-pressure, not a failed delivery. The event keeps its
+	// outbox entry and claim and is queued again once the breaker had time to recover.
+	var unavailableErr *utils.ServiceUnavailableError
+	if errors.As(result.Err, &unavailableErr) && unavailableErr.Code == utils.CircuitOpenCode {
+		logger.Log.Warn().
+			Str("event_id", eventID).
+			Dur("delay", t.requeueDelay).
+			Msg("Svix circuit breaker is open, requeueing event")
+		go t.requeue(result.Task)
+		return
+	}
+
+	// Failures move on to the dead letter store. When the dead letter cannot be stored the
+	// outbox entry and the claim both stay, the next start takes the claim over and redelivers.
+	var conflictErr *utils.ConflictError
+	if result.Err != nil && !errors.As(result.Err, &conflictErr) {
+		if err := t.deadLetter(ctx, result); err != nil {
+			return
+		}
+		t.removeFromOutbox(ctx, eventID)
+		t.release(ctx, eventID)
+		return
+	}
+
+	// A conflict from Svix means it already holds a message with this event ID
+	if err := t.idempotencyStore.Complete(ctx, eventID, DeliveredStatus); err != nil {
+		logger.Log.Error().
+			Err(err).
+			Str("event_id", eventID).
+			Msg("Failed to record delivered event")
+	}
+	t.removeFromOutbox(ctx, eventID)
+}
+
+// requeue queues the task again after the requeue delay, waiting while the queue is full.
+// Once the pool is closed the claim is released and the outbox entry is left for the next start.
+func (t *taskServiceImpl) requeue(task worker.Task) {
+	ctx := context.Background()
+	if eventTask, ok := task.(eventTask); ok {
+		ctx = logger.WithEvent(ctx, eventTask.Event())
+	}
+
+	for {
+		time.Sleep(t.requeueDelay)
+		if t.workerPool.Closed() {
+			t.release(ctx, task.ID())
+			logger.Ctx(ctx).Warn().
+				Msg("Worker pool closed before requeueing, kept in outbox for redelivery")
+			return
+		}
+		err := t.workerPool.ProcessTask(ctx, task)
+		if err == nil {
+			return
+		}
+		logger.Ctx(ctx).Warn().
+			Err(err).
+			Msg("Failed to requeue event, trying again")
+	}
+}
+
+// deadLetter stores the failed event, merging with an earlier failure of the same event
+func (t *taskServiceImpl) deadLetter(ctx context.Context, result worker.Result) error {
+	task, ok := result.Task.(eventTask)
+	if !ok {
+		return nil
+	}
+	event := task.Event()
+	now := time.Now().UTC()
+
+	attempts := 1
+	var retryErr *utils.RetryExhaustedError
+	if errors.As(result.Err, &retryErr) {
+		attempts = retryErr.Attempts
+	}
+
+	entry, found, err := t.deadLetters.Get(ctx, event.ID)
+	if err != nil || !found {
+		entry = models.DeadLetter{EventID: event.ID, FirstFailedAt: now}
+	}
+	entry.Event = event
+	entry.PubSub = event.PubSub
+	entry.ErrorClass = utils.ErrorClass(result.Err)
+	entry.Error = result.Err.Error()
+	entry.Attempts += attempts
+	entry.Failures++
+	entry.LastFailedAt = now
+
+	if err := t.deadLetters.Put(ctx, entry); err != nil {
 		logger.Log.Error().
 			Err(err).
 			Str("event_id", event.ID).
-			Str("task_id", task.ID()).
-			Msg("Failed to process task")
+			Msg("Failed to store dead letter, kept in outbox for redelivery")
 		return err
 	}
 
+	logger.Log.Warn().
+		Str("event_id", event.ID).
+		Str("error_class", entry.ErrorClass).
+		Int("attempts", entry.Attempts).
+		Int("failures", entry.Failures).
+		Msg("Moved event to dead letter store")
 	return nil
 }
+
+func (t *taskServiceImpl) release(ctx context.Context, eventID string) {
+	if err := t.idempotencyStore.Release(ctx, eventID); err != nil {
+		logger.Log.Error().
+			Err(err).
+			Str("event_id", eventID).
+			Msg("Failed to release idempotency claim")
+	}
+}
+
+func (t *taskServiceImpl) removeFromOutbox(ctx context.Context, eventID string) {
+	if err := t.outbox.Remove(ctx, eventID); err != nil {
+		logger.Log.Error().
+			Err(err).
+			Str("event_id", eventID).
+			Msg("Failed to remove event from outbox")
+	}
+}
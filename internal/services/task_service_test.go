@@ -2,11 +2,25 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/deadletter"
+	"github.com/markonick/gigs-challenge/internal/idempotency"
 	"github.com/markonick/gigs-challenge/internal/logger"
 	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/outbox"
+	"github.com/markonick/gigs-challenge/internal/utils"
 	"github.com/markonick/gigs-challenge/internal/worker"
 )
 
@@ -24,6 +38,10 @@ func (m *MockTask) ID() string {
 	return m.id
 }
 
+func (m *MockTask) Event() models.BaseEvent {
+	return m.event
+}
+
 func TestTaskService_ProcessEvent(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -63,10 +81,16 @@ func TestTaskService_ProcessEvent(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create service with small worker pool
-			service := NewTaskService(2, tt.createTask)
+			service := NewTaskService(
+				worker.NewPool(worker.Config{MaxWorkers: 2}),
+				tt.createTask,
+				idempotency.NewMemoryStore(idempotency.Options{}),
+				outbox.NewMemoryOutbox(),
+				deadletter.NewMemoryStore(),
+			)
 
 			// Submit task
-			err := service.ProcessEvent(tt.event)
+			_, err := service.ProcessEvent(context.Background(), tt.event)
 
 			// Verify submission result
 			if (err != nil) != tt.wantErr {
@@ -78,3 +102,374 @@ func TestTaskService_ProcessEvent(t *testing.T) {
 		})
 	}
 }
+
+func TestTaskService_ProcessEvent_Idempotency(t *testing.T) {
+	event := models.BaseEvent{ID: "evt_dup", Type: "user.created", Project: "dev"}
+
+	t.Run("delivered event is not sent again", func(t *testing.T) {
+		pool := worker.NewPool(worker.Config{MaxWorkers: 1})
+		executions := 0
+		service := NewTaskService(pool, func(event models.BaseEvent) worker.Task {
+			executions++
+			return &MockTask{id: event.ID, event: event}
+		}, idempotency.NewMemoryStore(idempotency.Options{}), outbox.NewMemoryOutbox(), deadletter.NewMemoryStore())
+
+		result, err := service.ProcessEvent(context.Background(), event)
+		require.NoError(t, err)
+		assert.False(t, result.Duplicate)
+		pool.Close()
+
+		result, err = service.ProcessEvent(context.Background(), event)
+		require.NoError(t, err)
+		assert.True(t, result.Duplicate)
+		assert.Equal(t, DeliveredStatus, result.Record.Status)
+		assert.Equal(t, 1, executions)
+	})
+
+	t.Run("failed event can be retried", func(t *testing.T) {
+		pool := worker.NewPool(worker.Config{MaxWorkers: 1})
+		store := idempotency.NewMemoryStore(idempotency.Options{})
+		service := NewTaskService(pool, func(event models.BaseEvent) worker.Task {
+			return &MockTask{id: event.ID, event: event, err: utils.NewRateLimitError("slow down")}
+		}, store, outbox.NewMemoryOutbox(), deadletter.NewMemoryStore())
+
+		_, err := service.ProcessEvent(context.Background(), event)
+		require.NoError(t, err)
+		pool.Close()
+
+		_, claimed, err := store.Claim(context.Background(), event.ID)
+		require.NoError(t, err)
+		assert.True(t, claimed, "failed delivery must release its claim")
+	})
+
+	t.Run("concurrent delivery is reported as in progress", func(t *testing.T) {
+		store := idempotency.NewMemoryStore(idempotency.Options{})
+		_, _, err := store.Claim(context.Background(), event.ID)
+		require.NoError(t, err)
+
+		service := NewTaskService(worker.NewPool(worker.Config{MaxWorkers: 1}), func(event models.BaseEvent) worker.Task {
+			return &MockTask{id: event.ID, event: event}
+		}, store, outbox.NewMemoryOutbox(), deadletter.NewMemoryStore())
+
+		_, err = service.ProcessEvent(context.Background(), event)
+		var conflictErr *utils.ConflictError
+		require.ErrorAs(t, err, &conflictErr)
+		assert.Equal(t, EventInProgressCode, conflictErr.Code)
+	})
+}
+
+type countingTask struct {
+	id         string
+	executions *int32
+}
+
+func (c *countingTask) Execute(_ context.Context) error {
+	atomic.AddInt32(c.executions, 1)
+	time.Sleep(10 * time.Millisecond)
+	return nil
+}
+
+func (c *countingTask) ID() string {
+	return c.id
+}
+
+func TestTaskService_ProcessEvent_AcrossReplicas(t *testing.T) {
+	server := miniredis.RunT(t)
+	var executions int32
+
+	var (
+		replicas []TaskService
+		pools    []*worker.Pool
+	)
+	for i := 0; i < 3; i++ {
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		pool := worker.NewPool(worker.Config{MaxWorkers: 2, QueueCapacity: 10})
+		pools = append(pools, pool)
+		replicas = append(replicas, NewTaskService(pool, func(event models.BaseEvent) worker.Task {
+			return &countingTask{id: event.ID, executions: &executions}
+		}, idempotency.NewRedisStore(client, "", idempotency.Options{}), outbox.NewMemoryOutbox(), deadletter.NewMemoryStore()))
+	}
+
+	event := models.BaseEvent{ID: "evt_shared", Type: "user.created", Project: "dev"}
+	var wg sync.WaitGroup
+	for _, replica := range replicas {
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(service TaskService) {
+				defer wg.Done()
+				_, _ = service.ProcessEvent(context.Background(), event)
+			}(replica)
+		}
+	}
+	wg.Wait()
+	for _, pool := range pools {
+		pool.Close()
+	}
+
+	assert.Equal(t, int32(1), executions)
+
+	result, err := replicas[0].ProcessEvent(context.Background(), event)
+	require.NoError(t, err)
+	assert.True(t, result.Duplicate)
+}
+
+// deliveryTask records successful deliveries, or hangs until killed when hang is set
+type deliveryTask struct {
+	id        string
+	delivered *sync.Map
+	hang      chan struct{}
+}
+
+func (d *deliveryTask) Execute(_ context.Context) error {
+	if d.hang != nil {
+		<-d.hang
+		return errors.New("killed mid-flight")
+	}
+	count, _ := d.delivered.LoadOrStore(d.id, new(int32))
+	atomic.AddInt32(count.(*int32), 1)
+	return nil
+}
+
+func (d *deliveryTask) ID() string {
+	return d.id
+}
+
+func TestTaskService_Recover_AfterCrash(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	outboxPath := filepath.Join(dir, "outbox.db")
+	storePath := filepath.Join(dir, "idempotency.db")
+
+	var delivered sync.Map
+	hang := make(chan struct{})
+	deliveredCount := func() int {
+		n := 0
+		delivered.Range(func(_, _ interface{}) bool { n++; return true })
+		return n
+	}
+
+	// First run: even events are delivered, odd events are still in flight when the process dies
+	box, err := outbox.NewBoltOutbox(outboxPath)
+	require.NoError(t, err)
+	store, err := idempotency.NewBoltStore(storePath, idempotency.Options{})
+	require.NoError(t, err)
+
+	crashedPool := worker.NewPool(worker.Config{MaxWorkers: 10, QueueCapacity: 10})
+	service := NewTaskService(crashedPool, func(event models.BaseEvent) worker.Task {
+		task := &deliveryTask{id: event.ID, delivered: &delivered}
+		if event.Data["slow"] == true {
+			task.hang = hang
+		}
+		return task
+	}, store, box, deadletter.NewMemoryStore())
+
+	for i := 0; i < 10; i++ {
+		_, err := service.ProcessEvent(ctx, models.BaseEvent{
+			ID:      fmt.Sprintf("evt_%d", i),
+			Type:    "user.created",
+			Project: "dev",
+			Data:    map[string]interface{}{"slow": i%2 == 1},
+		})
+		require.NoError(t, err)
+	}
+	require.Eventually(t, func() bool { return deliveredCount() == 5 }, 5*time.Second, 10*time.Millisecond)
+
+	// Svix accepted this one but the process died before it was removed from the outbox
+	lateEvent := models.BaseEvent{ID: "evt_late", Type: "user.created", Project: "dev"}
+	require.NoError(t, box.Append(ctx, models.NewOutboxEntry(lateEvent)))
+	require.NoError(t, store.Complete(ctx, lateEvent.ID, DeliveredStatus))
+
+	// Crash: the storage goes away without the in-flight tasks reporting back
+	require.NoError(t, box.Close())
+	require.NoError(t, store.Close())
+
+	// Second run on the same files
+	box, err = outbox.NewBoltOutbox(outboxPath)
+	require.NoError(t, err)
+	defer box.Close()
+	store, err = idempotency.NewBoltStore(storePath, idempotency.Options{})
+	require.NoError(t, err)
+	defer store.Close()
+
+	pool := worker.NewPool(worker.Config{MaxWorkers: 2, QueueCapacity: 1})
+	restarted := NewTaskService(pool, func(event models.BaseEvent) worker.Task {
+		return &deliveryTask{id: event.ID, delivered: &delivered}
+	}, store, box, deadletter.NewMemoryStore())
+
+	requeued, err := restarted.Recover(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 5, requeued)
+	pool.Close()
+
+	// The killed calls of the first run finish without delivering anything
+	close(hang)
+	crashedPool.Close()
+
+	assert.Equal(t, 10, deliveredCount())
+	delivered.Range(func(id, count interface{}) bool {
+		assert.Equal(t, int32(1), atomic.LoadInt32(count.(*int32)), "event %s delivered more than once", id)
+		return true
+	})
+	_, lateDelivered := delivered.Load(lateEvent.ID)
+	assert.False(t, lateDelivered, "already delivered event must not be sent again")
+
+	entries, err := box.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	for i := 0; i < 10; i++ {
+		result, err := restarted.ProcessEvent(ctx, models.BaseEvent{ID: fmt.Sprintf("evt_%d", i)})
+		require.NoError(t, err)
+		assert.True(t, result.Duplicate)
+	}
+}
+
+func TestTaskService_Shutdown_KeepsInterruptedEventsForRedelivery(t *testing.T) {
+	ctx := context.Background()
+	box := outbox.NewMemoryOutbox()
+	store := idempotency.NewMemoryStore(idempotency.Options{})
+	deadLetters := deadletter.NewMemoryStore()
+
+	started := make(chan struct{})
+	pool := worker.NewPool(worker.Config{MaxWorkers: 1, QueueCapacity: 1})
+	service := NewTaskService(pool, func(event models.BaseEvent) worker.Task {
+		return &slowTask{MockTask: MockTask{id: event.ID, event: event}, started: started}
+	}, store, box, deadLetters)
+
+	_, err := service.ProcessEvent(ctx, models.BaseEvent{ID: "evt_running", Project: "dev"})
+	require.NoError(t, err)
+	_, err = service.ProcessEvent(ctx, models.BaseEvent{ID: "evt_queued", Project: "dev"})
+	require.NoError(t, err)
+	<-started
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, pool.Shutdown(shutdownCtx), context.DeadlineExceeded)
+
+	entries, err := box.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "interrupted events must stay in the outbox")
+
+	deadLettered, err := deadLetters.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, deadLettered)
+
+	for _, id := range []string{"evt_running", "evt_queued"} {
+		_, claimed, err := store.Claim(ctx, id)
+		require.NoError(t, err)
+		assert.True(t, claimed, "interrupted event %s must release its claim", id)
+	}
+}
+
+// failingDeadLetters fails every write
+type failingDeadLetters struct {
+	DeadLetterStore
+}
+
+func (f failingDeadLetters) Put(context.Context, models.DeadLetter) error {
+	return errors.New("disk full")
+}
+
+func TestTaskService_FailedDelivery_Outbox(t *testing.T) {
+	tests := []struct {
+		name        string
+		deadLetters DeadLetterStore
+		wantOutbox  int
+		wantClaimed bool
+	}{
+		{
+			name:        "removed once the dead letter is stored",
+			deadLetters: deadletter.NewMemoryStore(),
+			wantOutbox:  0,
+		},
+		{
+			name:        "kept when the dead letter cannot be stored",
+			deadLetters: failingDeadLetters{DeadLetterStore: deadletter.NewMemoryStore()},
+			wantOutbox:  1,
+			wantClaimed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			box := outbox.NewMemoryOutbox()
+			store := idempotency.NewMemoryStore(idempotency.Options{})
+			pool := worker.NewPool(worker.Config{MaxWorkers: 1})
+			service := NewTaskService(pool, func(event models.BaseEvent) worker.Task {
+				return &MockTask{id: event.ID, event: event, err: errors.New("bad request")}
+			}, store, box, tt.deadLetters)
+
+			_, err := service.ProcessEvent(ctx, models.BaseEvent{ID: "evt_failed", Project: "dev"})
+			require.NoError(t, err)
+			pool.Close()
+
+			entries, err := box.List(ctx)
+			require.NoError(t, err)
+			assert.Len(t, entries, tt.wantOutbox)
+
+			// A kept claim is taken over by Recover on the next start
+			_, claimed, err := store.Claim(ctx, "evt_failed")
+			require.NoError(t, err)
+			assert.Equal(t, !tt.wantClaimed, claimed)
+		})
+	}
+}
+
+// breakerTask is turned away by an open circuit breaker until it ran closedAfter times
+type breakerTask struct {
+	MockTask
+	executions  *int32
+	closedAfter int32
+}
+
+func (b *breakerTask) Execute(_ context.Context) error {
+	if atomic.AddInt32(b.executions, 1) <= b.closedAfter {
+		return &utils.ServiceUnavailableError{Code: utils.CircuitOpenCode, Detail: "Svix circuit breaker is open"}
+	}
+	return nil
+}
+
+func TestTaskService_CircuitOpen_RequeuesEvent(t *testing.T) {
+	ctx := context.Background()
+	box := outbox.NewMemoryOutbox()
+	store := idempotency.NewMemoryStore(idempotency.Options{})
+	deadLetters := deadletter.NewMemoryStore()
+
+	var executions int32
+	pool := worker.NewPool(worker.Config{MaxWorkers: 1})
+	defer pool.Close()
+	service := NewTaskService(pool, func(event models.BaseEvent) worker.Task {
+		return &breakerTask{MockTask: MockTask{id: event.ID, event: event}, executions: &executions, closedAfter: 2}
+	}, store, box, deadLetters)
+	service.(*taskServiceImpl).requeueDelay = 10 * time.Millisecond
+
+	_, err := service.ProcessEvent(ctx, models.BaseEvent{ID: "evt_breaker", Project: "dev"})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		record, _, err := store.Claim(ctx, "evt_breaker")
+		return err == nil && record.State == models.IdempotencyDone
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&executions))
+
+	entries, err := box.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	deadLettered, err := deadLetters.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, deadLettered, "an open circuit breaker must not dead-letter events")
+}
+
+// slowTask blocks until its context is cancelled
+type slowTask struct {
+	MockTask
+	started chan struct{}
+}
+
+func (s *slowTask) Execute(ctx context.Context) error {
+	close(s.started)
+	<-ctx.Done()
+	return ctx.Err()
+}
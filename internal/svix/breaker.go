@@ -0,0 +1,373 @@
+package svix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/markonick/gigs-challenge/internal/health"
+	"github.com/markonick/gigs-challenge/internal/logger"
+	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/utils"
+	svixapi "github.com/svix/svix-webhooks/go"
+)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets every call through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails every call fast until the open timeout has passed
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe through, its outcome closes or reopens the breaker
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText reports the state by name in JSON
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// BreakerConfig controls when the breakers trip and for how long they stay open.
+// A zero FailureThreshold disables them.
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive 5xx or timeouts that opens a breaker
+	FailureThreshold int
+	// OpenTimeout is how long a breaker fails fast before letting a probe through
+	OpenTimeout time.Duration
+}
+
+// DefaultBreakerConfig trips after 5 consecutive failures and probes again after 30s
+var DefaultBreakerConfig = BreakerConfig{
+	FailureThreshold: 5,
+	OpenTimeout:      30 * time.Second,
+}
+
+// BreakerStatus is a snapshot of a breaker, reported by health checks
+type BreakerStatus struct {
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	OpenedAt            *time.Time   `json:"opened_at,omitempty"`
+}
+
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	// outcomeIgnored releases a half-open probe without judging Svix, like a cancelled call
+	outcomeIgnored
+)
+
+type breaker struct {
+	name   string
+	config BreakerConfig
+	now    func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(name string, config BreakerConfig) *breaker {
+	return &breaker{name: name, config: config, now: time.Now}
+}
+
+// allow returns an error while the breaker is open, or while its half-open probe is in flight.
+// Otherwise the call may go ahead, in half-open state as the probe.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.config.OpenTimeout {
+		b.transition(BreakerHalfOpen)
+	}
+	if err := b.rejectLocked(); err != nil {
+		return err
+	}
+	if b.state == BreakerHalfOpen {
+		b.probing = true
+	}
+	return nil
+}
+
+// check is allow without taking the probe
+func (b *breaker) check() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.config.OpenTimeout {
+		return nil
+	}
+	return b.rejectLocked()
+}
+
+func (b *breaker) rejectLocked() error {
+	if b.state == BreakerOpen || (b.state == BreakerHalfOpen && b.probing) {
+		return &utils.ServiceUnavailableError{
+			Code:   utils.CircuitOpenCode,
+			Detail: fmt.Sprintf("Svix circuit breaker %s is open", b.name),
+		}
+	}
+	return nil
+}
+
+func (b *breaker) record(result outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	probe := b.state == BreakerHalfOpen && b.probing
+	b.probing = false
+
+	switch result {
+	case outcomeSuccess:
+		b.failures = 0
+		if probe {
+			b.transition(BreakerClosed)
+		}
+	case outcomeFailure:
+		b.failures++
+		if probe || (b.state == BreakerClosed && b.failures >= b.config.FailureThreshold) {
+			b.openedAt = b.now()
+			b.transition(BreakerOpen)
+		}
+	}
+}
+
+// transition must be called with the lock held
+func (b *breaker) transition(to BreakerState) {
+	if b.state == to {
+		return
+	}
+	log := logger.Log.Info()
+	if to == BreakerOpen {
+		log = logger.Log.Warn()
+	}
+	log.
+		Str("breaker", b.name).
+		Stringer("from", b.state).
+		Stringer("to", to).
+		Int("consecutive_failures", b.failures).
+		Msg("Svix circuit breaker changed state")
+	b.state = to
+}
+
+func (b *breaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{State: b.state, ConsecutiveFailures: b.failures}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+// classify decides whether an error counts against Svix: 5xx responses and requests timing
+// out in flight do, 4xx responses, cancellations and deadlines hit while waiting for the
+// rate limiter or a retry do not
+func classify(err error) outcome {
+	if err == nil {
+		return outcomeSuccess
+	}
+
+	var (
+		internalErr *utils.InternalError
+		svixError   *svixapi.Error
+		timeoutErr  *requestTimeoutError
+		openErr     *utils.ServiceUnavailableError
+	)
+	switch {
+	case errors.As(err, &openErr) && openErr.Code == utils.CircuitOpenCode:
+		return outcomeIgnored
+	case errors.As(err, &internalErr):
+		return outcomeFailure
+	case errors.As(err, &svixError):
+		if svixError.Status() >= http.StatusInternalServerError {
+			return outcomeFailure
+		}
+		return outcomeSuccess
+	case errors.As(err, &timeoutErr):
+		return outcomeFailure
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return outcomeIgnored
+	default:
+		// Svix answered, just not with what we wanted
+		return outcomeSuccess
+	}
+}
+
+// BreakerClient wraps a Client with circuit breakers, one for the whole account and
+// one per application. While a breaker is open calls fail fast with a retryable
+// ServiceUnavailableError instead of spending their retry budget on an outage.
+type BreakerClient struct {
+	client Client
+	config BreakerConfig
+	global *breaker
+
+	mu   sync.Mutex
+	apps map[string]*breaker
+}
+
+func NewBreakerClient(client Client, config BreakerConfig) *BreakerClient {
+	return &BreakerClient{
+		client: client,
+		config: config,
+		global: newBreaker("global", config),
+		apps:   make(map[string]*breaker),
+	}
+}
+
+func (c *BreakerClient) app(appID string) *breaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.apps[appID]
+	if !ok {
+		b = newBreaker(appID, c.config)
+		c.apps[appID] = b
+	}
+	return b
+}
+
+// Allow reports whether calls for the application would currently go through.
+// Ingestion uses it to turn events away while Svix is down, so Pub/Sub redelivers them later.
+func (c *BreakerClient) Allow(appID string) error {
+	if c.config.FailureThreshold <= 0 {
+		return nil
+	}
+	if err := c.global.check(); err != nil {
+		return err
+	}
+	if appID == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	b, ok := c.apps[appID]
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return b.check()
+}
+
+// call runs fn through the global breaker and the breaker of appID, if any
+func (c *BreakerClient) call(appID string, fn func() error) error {
+	if c.config.FailureThreshold <= 0 {
+		return fn()
+	}
+
+	breakers := []*breaker{c.global}
+	if appID != "" {
+		breakers = append(breakers, c.app(appID))
+	}
+	for i, b := range breakers {
+		if err := b.allow(); err != nil {
+			for _, allowed := range breakers[:i] {
+				allowed.record(outcomeIgnored)
+			}
+			return err
+		}
+	}
+
+	err := fn()
+	result := classify(err)
+	for _, b := range breakers {
+		b.record(result)
+	}
+	return err
+}
+
+// SetRetryPolicies passes the retry policies on to the wrapped client
+func (c *BreakerClient) SetRetryPolicies(retry RetryPolicies) {
+	if client, ok := c.client.(Reconfigurer); ok {
+		client.SetRetryPolicies(retry)
+	}
+}
+
+// SetRateLimits passes the rate limits on to the wrapped client
+func (c *BreakerClient) SetRateLimits(rateLimit RateLimitConfig) {
+	if client, ok := c.client.(Reconfigurer); ok {
+		client.SetRateLimits(rateLimit)
+	}
+}
+
+// Ping bypasses the breakers, a health probe must not trip or reset them
+func (c *BreakerClient) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx)
+}
+
+func (c *BreakerClient) CreateApplication(ctx context.Context, uid, name string) (string, error) {
+	var appID string
+	err := c.call("", func() error {
+		var err error
+		appID, err = c.client.CreateApplication(ctx, uid, name)
+		return err
+	})
+	return appID, err
+}
+
+func (c *BreakerClient) SetupApplicationEndpoints(ctx context.Context, appID string) error {
+	return c.call(appID, func() error {
+		return c.client.SetupApplicationEndpoints(ctx, appID)
+	})
+}
+
+func (c *BreakerClient) SendMessage(ctx context.Context, appID string, event models.BaseEvent) error {
+	return c.call(appID, func() error {
+		return c.client.SendMessage(ctx, appID, event)
+	})
+}
+
+// BreakerStatuses returns the state of the global breaker and of every application breaker
+func (c *BreakerClient) BreakerStatuses() (BreakerStatus, map[string]BreakerStatus) {
+	c.mu.Lock()
+	apps := make(map[string]*breaker, len(c.apps))
+	for appID, b := range c.apps {
+		apps[appID] = b
+	}
+	c.mu.Unlock()
+
+	statuses := make(map[string]BreakerStatus, len(apps))
+	for appID, b := range apps {
+		statuses[appID] = b.status()
+	}
+	return c.global.status(), statuses
+}
+
+// BreakerReport is the detail of the breaker health check
+type BreakerReport struct {
+	Global       BreakerStatus            `json:"global"`
+	Applications map[string]BreakerStatus `json:"applications"`
+}
+
+// HealthCheck is down while the global breaker is not closed, deliveries fail fast then
+func (c *BreakerClient) HealthCheck(_ context.Context) health.Result {
+	global, apps := c.BreakerStatuses()
+	report := BreakerReport{Global: global, Applications: apps}
+	if global.State != BreakerClosed {
+		return health.Down(fmt.Errorf("svix circuit breaker is %s", global.State), report)
+	}
+	return health.Up(report)
+}
@@ -0,0 +1,161 @@
+package svix
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/utils"
+)
+
+// fakeClient answers SendMessage with the error registered for the app
+type fakeClient struct {
+	errs  map[string]error
+	calls int
+}
+
+func (f *fakeClient) Ping(_ context.Context) error {
+	return nil
+}
+
+func (f *fakeClient) CreateApplication(_ context.Context, uid, _ string) (string, error) {
+	return "app_" + uid, nil
+}
+
+func (f *fakeClient) SetupApplicationEndpoints(_ context.Context, _ string) error {
+	return nil
+}
+
+func (f *fakeClient) SendMessage(_ context.Context, appID string, _ models.BaseEvent) error {
+	f.calls++
+	return f.errs[appID]
+}
+
+func newTestBreakerClient(fake *fakeClient, now *time.Time) *BreakerClient {
+	client := NewBreakerClient(fake, BreakerConfig{FailureThreshold: 3, OpenTimeout: time.Minute})
+	clock := func() time.Time { return *now }
+	client.global.now = clock
+	for _, appID := range []string{"app_a", "app_b"} {
+		client.app(appID).now = clock
+	}
+	return client
+}
+
+func isCircuitOpen(err error) bool {
+	return utils.ErrorClass(err) == utils.CircuitOpenCode
+}
+
+func TestBreakerClient(t *testing.T) {
+	ctx := context.Background()
+	event := models.BaseEvent{ID: "evt_1"}
+
+	t.Run("opens after consecutive failures and fails fast", func(t *testing.T) {
+		now := time.Now()
+		fake := &fakeClient{errs: map[string]error{"app_a": utils.NewInternalError("svix is down")}}
+		client := newTestBreakerClient(fake, &now)
+
+		for i := 0; i < 3; i++ {
+			err := client.SendMessage(ctx, "app_a", event)
+			assert.False(t, isCircuitOpen(err))
+		}
+
+		err := client.SendMessage(ctx, "app_a", event)
+		assert.True(t, isCircuitOpen(err), "expected circuit open, got %v", err)
+		assert.Equal(t, 3, fake.calls, "open breaker must not call Svix")
+		assert.True(t, isCircuitOpen(client.Allow("app_a")))
+
+		global, apps := client.BreakerStatuses()
+		assert.Equal(t, BreakerOpen, global.State)
+		assert.Equal(t, BreakerOpen, apps["app_a"].State)
+		assert.Equal(t, 3, apps["app_a"].ConsecutiveFailures)
+	})
+
+	t.Run("half-open probe closes the breaker on success", func(t *testing.T) {
+		now := time.Now()
+		fake := &fakeClient{errs: map[string]error{"app_a": utils.NewInternalError("svix is down")}}
+		client := newTestBreakerClient(fake, &now)
+		for i := 0; i < 3; i++ {
+			_ = client.SendMessage(ctx, "app_a", event)
+		}
+
+		now = now.Add(time.Minute)
+		require.NoError(t, client.Allow("app_a"), "Allow must not hold back the probe once the timeout passed")
+
+		delete(fake.errs, "app_a")
+		require.NoError(t, client.SendMessage(ctx, "app_a", event))
+
+		global, apps := client.BreakerStatuses()
+		assert.Equal(t, BreakerClosed, global.State)
+		assert.Equal(t, BreakerClosed, apps["app_a"].State)
+	})
+
+	t.Run("failed probe reopens the breaker", func(t *testing.T) {
+		now := time.Now()
+		fake := &fakeClient{errs: map[string]error{"app_a": utils.NewInternalError("svix is down")}}
+		client := newTestBreakerClient(fake, &now)
+		for i := 0; i < 3; i++ {
+			_ = client.SendMessage(ctx, "app_a", event)
+		}
+
+		now = now.Add(time.Minute)
+		assert.False(t, isCircuitOpen(client.SendMessage(ctx, "app_a", event)))
+		assert.True(t, isCircuitOpen(client.SendMessage(ctx, "app_a", event)))
+		assert.Equal(t, 4, fake.calls)
+	})
+
+	t.Run("client errors and cancellations do not count", func(t *testing.T) {
+		now := time.Now()
+		fake := &fakeClient{errs: map[string]error{
+			"app_a": utils.NewValidationError("validation_failed", "bad payload"),
+			"app_b": &utils.CancelledError{Operation: OperationSendMessage, Attempts: 1, Err: context.Canceled},
+		}}
+		client := newTestBreakerClient(fake, &now)
+
+		for i := 0; i < 5; i++ {
+			assert.False(t, isCircuitOpen(client.SendMessage(ctx, "app_a", event)))
+			assert.False(t, isCircuitOpen(client.SendMessage(ctx, "app_b", event)))
+		}
+	})
+
+	t.Run("request timeouts count", func(t *testing.T) {
+		now := time.Now()
+		timeout := &requestTimeoutError{operation: "send_message", err: context.DeadlineExceeded}
+		fake := &fakeClient{errs: map[string]error{
+			"app_a": &utils.CancelledError{Operation: OperationSendMessage, Attempts: 1, Err: timeout},
+		}}
+		client := newTestBreakerClient(fake, &now)
+
+		for i := 0; i < 3; i++ {
+			_ = client.SendMessage(ctx, "app_a", event)
+		}
+		assert.True(t, isCircuitOpen(client.SendMessage(ctx, "app_a", event)))
+	})
+
+	t.Run("deadlines outside a request do not count", func(t *testing.T) {
+		now := time.Now()
+		fake := &fakeClient{errs: map[string]error{
+			"app_a": context.DeadlineExceeded,
+			"app_b": &utils.CancelledError{Operation: OperationSendMessage, Attempts: 2, Err: context.DeadlineExceeded},
+		}}
+		client := newTestBreakerClient(fake, &now)
+
+		for i := 0; i < 5; i++ {
+			assert.False(t, isCircuitOpen(client.SendMessage(ctx, "app_a", event)))
+			assert.False(t, isCircuitOpen(client.SendMessage(ctx, "app_b", event)))
+		}
+	})
+
+	t.Run("disabled without a threshold", func(t *testing.T) {
+		fake := &fakeClient{errs: map[string]error{"app_a": utils.NewInternalError("svix is down")}}
+		client := NewBreakerClient(fake, BreakerConfig{})
+
+		for i := 0; i < 10; i++ {
+			assert.False(t, isCircuitOpen(client.SendMessage(ctx, "app_a", event)))
+		}
+		assert.Equal(t, 10, fake.calls)
+	})
+}
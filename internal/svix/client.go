@@ -4,56 +4,247 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/markonick/gigs-challenge/internal/logger"
+	"github.com/markonick/gigs-challenge/internal/metrics"
 	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/tracing"
 	"github.com/markonick/gigs-challenge/internal/utils"
 	svixapi "github.com/svix/svix-webhooks/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Client interface {
-	CreateApplication(ctx context.Context, name string) (string, error)
+	// Ping checks that Svix is reachable and accepts the token
+	Ping(ctx context.Context) error
+	// CreateApplication returns the ID of the application with the uid, creating it when missing
+	CreateApplication(ctx context.Context, uid, name string) (string, error)
 	SetupApplicationEndpoints(ctx context.Context, appID string) error
 	SendMessage(ctx context.Context, appID string, event models.BaseEvent) error
 }
 
+// DefaultTimeout bounds a single HTTP request to Svix
+const DefaultTimeout = 60 * time.Second
+
+// Config tunes the Svix client
+type Config struct {
+	// ServerURL points the client at a self-hosted Svix or a fake server.
+	// When empty the server is inferred from the token region.
+	ServerURL string
+	// Timeout bounds a single HTTP request, DefaultTimeout when zero
+	Timeout time.Duration
+	// HTTPClient replaces the default HTTP client, its transport is wrapped
+	HTTPClient *http.Client
+	// Transport replaces the transport of the HTTP client
+	Transport http.RoundTripper
+	// Debug logs every request made to Svix
+	Debug bool
+
+	// Retry holds the retry policy per operation, see RetryPolicies.For
+	Retry RetryPolicies
+	// RateLimit throttles the calls before Svix has to answer with 429
+	RateLimit RateLimitConfig
+}
+
+// Reconfigurer is implemented by clients whose retry policies and rate limits can change at runtime
+type Reconfigurer interface {
+	SetRetryPolicies(retry RetryPolicies)
+	SetRateLimits(rateLimit RateLimitConfig)
+}
+
 type clientImpl struct {
-	svix *svixapi.Svix
+	svix    *svixapi.Svix
+	config  Config
+	retry   atomic.Pointer[RetryPolicies]
+	limiter *limiter
 }
 
-func NewClient(svixToken string) Client {
-	// Let Svix infer the server URL from the token
-	return &clientImpl{
-		svix: svixapi.New(svixToken, nil),
+func NewClient(svixToken string, config Config) (Client, error) {
+	options := &svixapi.SvixOptions{HTTPClient: httpClient(config)}
+	if config.ServerURL != "" {
+		serverURL, err := url.Parse(config.ServerURL)
+		if err != nil || serverURL.Scheme == "" || serverURL.Host == "" {
+			return nil, fmt.Errorf("invalid Svix server URL %q", config.ServerURL)
+		}
+		options.ServerUrl = serverURL
+	}
+
+	client := &clientImpl{
+		svix:    svixapi.New(svixToken, options),
+		config:  config,
+		limiter: newLimiter(config.RateLimit),
+	}
+	client.retry.Store(&config.Retry)
+	return client, nil
+}
+
+// SetRetryPolicies replaces the retry policies, calls already retrying keep their policy
+func (c *clientImpl) SetRetryPolicies(retry RetryPolicies) {
+	c.retry.Store(&retry)
+}
+
+// SetRateLimits replaces the rate limits. The buckets keep their tokens and the pauses
+// from Retry-After.
+func (c *clientImpl) SetRateLimits(rateLimit RateLimitConfig) {
+	c.limiter.reconfigure(rateLimit)
+}
+
+// httpClient builds the HTTP client from the config. The transport always reports
+// Retry-After to the retry layer and timeouts to the call, and logs requests in debug mode.
+func httpClient(config Config) *http.Client {
+	client := &http.Client{}
+	if config.HTTPClient != nil {
+		copied := *config.HTTPClient
+		client = &copied
+	}
+
+	transport := config.Transport
+	if transport == nil {
+		transport = client.Transport
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if config.Debug {
+		transport = debugTransport{base: transport}
+	}
+	client.Transport = retryAfterTransport{base: timeoutTransport{base: transport}}
+
+	switch {
+	case config.Timeout > 0:
+		client.Timeout = config.Timeout
+	case client.Timeout == 0:
+		client.Timeout = DefaultTimeout
 	}
+	return client
 }
 
-func (c *clientImpl) CreateApplication(ctx context.Context, name string) (string, error) {
-	// First check if application already exists
-	apps, err := c.svix.Application.List(ctx, nil)
+// debugTransport logs the requests sent to Svix without their headers, which carry the token
+type debugTransport struct {
+	base http.RoundTripper
+}
+
+func (t debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+
+	log := logger.Log.Debug().
+		Str("method", req.Method).
+		Str("url", req.URL.Redacted()).
+		Dur("duration", time.Since(start))
 	if err != nil {
-		return "", fmt.Errorf("failed to list applications: %w", err)
+		log.Err(err).Msg("Svix request failed")
+		return resp, err
 	}
+	log.
+		Int("status", resp.StatusCode).
+		Str("request_id", resp.Header.Get("svix-req-id")).
+		Msg("Svix request")
+	return resp, nil
+}
 
-	// Check for existing app with same name
-	for _, app := range apps.Data {
-		if app.Name == name {
-			logger.Log.Info().
-				Str("app_id", app.Id).
-				Str("name", name).
-				Msg("Found existing Svix application")
-			return app.Id, nil
+// timeoutTransport marks the call of the request as timed out when the request times
+// out in flight. The SDK retries failed requests itself, so the error it returns is
+// not necessarily the timeout.
+type timeoutTransport struct {
+	base http.RoundTripper
+}
+
+func (t timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil && (isTimeout(err) || errors.Is(req.Context().Err(), context.DeadlineExceeded)) {
+		if call, ok := req.Context().Value(callStateKey{}).(*callState); ok {
+			call.timedOut.Store(true)
 		}
 	}
+	return resp, err
+}
 
-	// If not found, create new application
-	var appID string
-	err = withRetry("create_application", func() error {
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// withRetry runs the operation under its configured retry policy
+func (c *clientImpl) withRetry(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	return withRetry(ctx, operation, c.retry.Load().For(operation), fn)
+}
+
+// Ping lists a single application, without retries
+func (c *clientImpl) Ping(ctx context.Context) error {
+	ctx, done := startCall(ctx, "ping")
+	_, err := c.svix.Application.List(ctx, &svixapi.ApplicationListOptions{Limit: svixapi.Int32(1)})
+	return done(err)
+}
+
+// CreateApplication looks the application up by uid and creates it on a 404. A 409 on
+// create means another replica created it in the meantime, so it is looked up again.
+// Applications created before uids were used are matched by name and adopted by setting their uid.
+func (c *clientImpl) CreateApplication(ctx context.Context, uid, name string) (string, error) {
+	appID, err := c.getApplication(ctx, uid)
+	if err == nil {
+		return appID, nil
+	}
+	if !isStatus(err, http.StatusNotFound) {
+		return "", fmt.Errorf("failed to get application %s: %w", uid, err)
+	}
+
+	appID, err = c.adoptApplication(ctx, uid, name)
+	if err != nil || appID != "" {
+		return appID, err
+	}
+
+	err = c.withRetry(ctx, OperationCreateApplication, func(ctx context.Context) error {
+		if err := c.limiter.wait(ctx, "", ""); err != nil {
+			return err
+		}
 		rateLimit := int32(1)
+		ctx, done := startCall(ctx, "create_application")
 		app, err := c.svix.Application.Create(ctx, &svixapi.ApplicationIn{
 			Name:      name,
+			Uid:       *svixapi.NullableString(&uid),
 			RateLimit: *svixapi.NullableInt32(&rateLimit)})
+		err = done(err)
+		if err != nil {
+			return err
+		}
+		appID = app.Id
+		return nil
+	})
+	if isStatus(err, http.StatusConflict) {
+		logger.Log.Info().
+			Str("uid", uid).
+			Msg("Svix application was created concurrently")
+		return c.getApplication(ctx, uid)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	logger.Log.Info().
+		Str("app_id", appID).
+		Str("uid", uid).
+		Msg("Created Svix application")
+	return appID, nil
+}
+
+// getApplication returns the ID of the application with the uid
+func (c *clientImpl) getApplication(ctx context.Context, uid string) (string, error) {
+	var appID string
+	err := c.withRetry(ctx, OperationCreateApplication, func(ctx context.Context) error {
+		if err := c.limiter.wait(ctx, "", ""); err != nil {
+			return err
+		}
+		ctx, done := startCall(ctx, "get_application")
+		app, err := c.svix.Application.Get(ctx, uid)
+		err = done(err)
 		if err != nil {
 			return err
 		}
@@ -63,20 +254,190 @@ func (c *clientImpl) CreateApplication(ctx context.Context, name string) (string
 	return appID, err
 }
 
+// adoptApplication sets the uid of an application that has the name but no uid yet and
+// returns its ID, or an empty ID when there is none
+func (c *clientImpl) adoptApplication(ctx context.Context, uid, name string) (string, error) {
+	apps, err := c.listApplications(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list applications: %w", err)
+	}
+
+	for _, app := range apps {
+		if app.Name != name || app.Uid.Get() != nil {
+			continue
+		}
+
+		err := c.withRetry(ctx, OperationCreateApplication, func(ctx context.Context) error {
+			if err := c.limiter.wait(ctx, "", ""); err != nil {
+				return err
+			}
+			ctx, done := startCall(ctx, "patch_application")
+			_, err := c.svix.Application.Patch(ctx, app.Id, &svixapi.ApplicationPatch{
+				Uid: *svixapi.NullableString(&uid),
+			})
+			return done(err)
+		})
+		if isStatus(err, http.StatusConflict) {
+			// Another replica adopted or created the application first
+			return c.getApplication(ctx, uid)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to set uid of application %s: %w", app.Id, err)
+		}
+
+		logger.Log.Info().
+			Str("app_id", app.Id).
+			Str("name", name).
+			Str("uid", uid).
+			Msg("Adopted existing Svix application")
+		return app.Id, nil
+	}
+	return "", nil
+}
+
+// listPageSize is the number of items requested per page, the maximum Svix allows
+const listPageSize = int32(250)
+
+// listApplications returns all applications, following the pages
+func (c *clientImpl) listApplications(ctx context.Context) ([]svixapi.ApplicationOut, error) {
+	var apps []svixapi.ApplicationOut
+	options := &svixapi.ApplicationListOptions{Limit: svixapi.Int32(listPageSize)}
+	for {
+		var page *svixapi.ListResponseApplicationOut
+		err := c.withRetry(ctx, OperationCreateApplication, func(ctx context.Context) error {
+			if err := c.limiter.wait(ctx, "", ""); err != nil {
+				return err
+			}
+			var err error
+			ctx, done := startCall(ctx, "list_applications")
+			page, err = c.svix.Application.List(ctx, options)
+			return done(err)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		apps = append(apps, page.Data...)
+		if page.Done || page.Iterator.Get() == nil {
+			return apps, nil
+		}
+		options.Iterator = page.Iterator.Get()
+	}
+}
+
+// listEndpoints returns all endpoints of the application, following the pages
+func (c *clientImpl) listEndpoints(ctx context.Context, appID string) ([]svixapi.EndpointOut, error) {
+	var endpoints []svixapi.EndpointOut
+	options := &svixapi.EndpointListOptions{Limit: svixapi.Int32(listPageSize)}
+	for {
+		var page *svixapi.ListResponseEndpointOut
+		err := c.withRetry(ctx, OperationCreateEndpoint, func(ctx context.Context) error {
+			if err := c.limiter.wait(ctx, appID, ""); err != nil {
+				return err
+			}
+			var err error
+			ctx, done := startCall(ctx, "list_endpoints")
+			page, err = c.svix.Endpoint.List(ctx, appID, options)
+			return done(err)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		endpoints = append(endpoints, page.Data...)
+		if page.Done || page.Iterator.Get() == nil {
+			return endpoints, nil
+		}
+		options.Iterator = page.Iterator.Get()
+	}
+}
+
+// callState is a single Svix request, the transport reports its timeouts in it
+type callState struct {
+	timedOut atomic.Bool
+}
+
+type callStateKey struct{}
+
+// startCall starts the span of a single Svix request and times it, the returned
+// function records the outcome and must be called once the request is done. It
+// returns the error of the request, wrapped in a requestTimeoutError when it timed out.
+func startCall(ctx context.Context, operation string) (context.Context, func(err error) error) {
+	call := &callState{}
+	ctx = context.WithValue(ctx, callStateKey{}, call)
+
+	options := []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindClient)}
+	if attempt := attemptFrom(ctx); attempt > 0 {
+		options = append(options, trace.WithAttributes(attribute.Int("svix.attempt", attempt)))
+	}
+	ctx, span := tracing.Start(ctx, "svix."+operation, options...)
+	start := time.Now()
+
+	return ctx, func(err error) error {
+		result := result(err)
+		metrics.SvixRequestDuration.
+			WithLabelValues(operation, result).
+			Observe(time.Since(start).Seconds())
+		span.SetAttributes(attribute.String("svix.result", result))
+		tracing.End(span, err)
+
+		if err != nil && (call.timedOut.Load() || isTimeout(err)) {
+			return &requestTimeoutError{operation: operation, err: err}
+		}
+		return err
+	}
+}
+
+// requestTimeoutError is a Svix request that timed out while in flight, unlike a
+// deadline hit while waiting for the rate limiter or between retries
+type requestTimeoutError struct {
+	operation string
+	err       error
+}
+
+func (e *requestTimeoutError) Error() string {
+	return fmt.Sprintf("svix %s request timed out: %v", e.operation, e.err)
+}
+
+func (e *requestTimeoutError) Unwrap() error { return e.err }
+
+// result labels the outcome of a Svix call: "ok", the HTTP status of the response or "error"
+func result(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	var svixError *svixapi.Error
+	if errors.As(err, &svixError) {
+		return strconv.Itoa(svixError.Status())
+	}
+	return "error"
+}
+
+// isStatus reports whether err is a Svix error with the HTTP status
+func isStatus(err error, status int) bool {
+	var svixError *svixapi.Error
+	return errors.As(err, &svixError) && svixError.Status() == status
+}
+
 func (c *clientImpl) SetupApplicationEndpoints(ctx context.Context, appID string) error {
 	// First create all event types
 	for _, eventType := range models.GetCommonEventTypes() {
 		eventTypeStr := string(eventType)
 
-		err := withRetry("create_event_type", func() error {
+		err := c.withRetry(ctx, OperationCreateEventType, func(ctx context.Context) error {
+			if err := c.limiter.wait(ctx, "", ""); err != nil {
+				return err
+			}
 			eventTypeIn := &svixapi.EventTypeIn{
 				Name:        eventTypeStr,
 				Description: fmt.Sprintf("Event type for %s", eventTypeStr),
 			}
 
+			ctx, done := startCall(ctx, "create_event_type")
 			_, err := c.svix.EventType.Create(ctx, eventTypeIn)
+			err = done(err)
 			if err != nil {
-				if apiErr, ok := err.(*svixapi.Error); ok && apiErr.Status() == 409 {
+				if isStatus(err, http.StatusConflict) {
 					logger.Log.Debug().
 						Str("event_type", eventTypeStr).
 						Msg("Event type exists")
@@ -102,7 +463,7 @@ func (c *clientImpl) SetupApplicationEndpoints(ctx context.Context, appID string
 	}
 
 	// Then list all existing endpoints
-	endpoints, err := c.svix.Endpoint.List(ctx, appID, nil)
+	endpoints, err := c.listEndpoints(ctx, appID)
 	if err != nil {
 		return fmt.Errorf("failed to list endpoints: %w", err)
 	}
@@ -112,7 +473,7 @@ func (c *clientImpl) SetupApplicationEndpoints(ctx context.Context, appID string
 
 		// Check if endpoint already exists
 		endpointExists := false
-		for _, ep := range endpoints.Data {
+		for _, ep := range endpoints {
 			if ep.Url == endpointURL {
 				logger.Log.Info().
 					Str("event_type", string(eventType)).
@@ -125,7 +486,10 @@ func (c *clientImpl) SetupApplicationEndpoints(ctx context.Context, appID string
 		}
 
 		if !endpointExists {
-			err := withRetry("create_endpoint", func() error {
+			err := c.withRetry(ctx, OperationCreateEndpoint, func(ctx context.Context) error {
+				if err := c.limiter.wait(ctx, appID, ""); err != nil {
+					return err
+				}
 				version := int32(1)
 				endpointIn := &svixapi.EndpointIn{
 					Url:         endpointURL,
@@ -134,7 +498,9 @@ func (c *clientImpl) SetupApplicationEndpoints(ctx context.Context, appID string
 					Version:     *svixapi.NullableInt32(&version), // Add dereferencing operator *
 				}
 
+				ctx, done := startCall(ctx, "create_endpoint")
 				_, err := c.svix.Endpoint.Create(ctx, appID, endpointIn)
+				err = done(err)
 				if err != nil {
 					if apiErr, ok := err.(*svixapi.Error); ok {
 						logger.Log.Error().
@@ -167,46 +533,77 @@ func (c *clientImpl) SendMessage(ctx context.Context, appID string, event models
 		Payload:   event.Data,
 	}
 
-	err := withRetry("send_message", func() error {
+	// Errors are mapped after the retries, withRetry needs the Svix status to decide
+	err := c.withRetry(ctx, OperationSendMessage, func(ctx context.Context) error {
+		if err := c.limiter.wait(ctx, appID, event.Project); err != nil {
+			return err
+		}
+
+		ctx, done := startCall(ctx, "send_message")
 		_, err := c.svix.Message.Create(ctx, appID, message)
+		err = done(err)
 		if err != nil {
-			logger.Log.Debug().
+			logger.Ctx(ctx).Debug().
 				Str("error_type", fmt.Sprintf("%T", err)).
 				Msg("Error from Svix API")
 
+			// Hold back every worker sending to this application, not just this one
 			var svixError *svixapi.Error
-			if errors.As(err, &svixError) {
-				switch svixError.Status() {
-				case http.StatusConflict: // 409
-					return utils.NewConflictError(svixError.Error())
-				case http.StatusUnauthorized: // 401
-					return utils.NewAuthError(svixError.Error())
-				case http.StatusForbidden: // 403
-					return utils.NewForbiddenError(svixError.Error())
-				case http.StatusNotFound: // 404
-					return utils.NewNotFoundError(svixError.Error())
-				case http.StatusRequestEntityTooLarge: // 413
-					return utils.NewPayloadTooLargeError(svixError.Error())
-				case http.StatusTooManyRequests: // 429
-					return utils.NewRateLimitError(svixError.Error())
-				case http.StatusUnprocessableEntity: // 422
-					return utils.NewValidationError("validation_failed", svixError.Error())
-				default:
-					if svixError.Status() >= 500 {
-						return utils.NewInternalError(svixError.Error())
-					}
-					return err
+			if errors.As(err, &svixError) && svixError.Status() == http.StatusTooManyRequests {
+				if retryAfter := retryAfterFrom(ctx); retryAfter > 0 {
+					c.limiter.pause(appID, event.Project, time.Now().Add(retryAfter))
 				}
 			}
-			return err
 		}
-		return nil
+		return err
 	})
 
 	if err != nil {
-		logger.Log.Debug().
+		logger.Ctx(ctx).Debug().
 			Str("error_type", fmt.Sprintf("%T", err)).
 			Msg("Error after retry")
+	} else if !event.Time.IsZero() {
+		metrics.DeliveryLatency.
+			WithLabelValues(event.Project, event.Type).
+			Observe(time.Since(event.Time).Seconds())
+	}
+	return mapSendError(err)
+}
+
+// mapSendError turns a Svix error into the matching utils error, keeping the retry wrapper
+func mapSendError(err error) error {
+	var retryErr *utils.RetryExhaustedError
+	if errors.As(err, &retryErr) {
+		return &utils.RetryExhaustedError{
+			Operation: retryErr.Operation,
+			Attempts:  retryErr.Attempts,
+			Err:       mapSendError(retryErr.Err),
+		}
+	}
+
+	var svixError *svixapi.Error
+	if !errors.As(err, &svixError) {
+		return err
+	}
+	switch svixError.Status() {
+	case http.StatusConflict: // 409
+		return utils.NewConflictError(svixError.Error())
+	case http.StatusUnauthorized: // 401
+		return utils.NewAuthError(svixError.Error())
+	case http.StatusForbidden: // 403
+		return utils.NewForbiddenError(svixError.Error())
+	case http.StatusNotFound: // 404
+		return utils.NewNotFoundError(svixError.Error())
+	case http.StatusRequestEntityTooLarge: // 413
+		return utils.NewPayloadTooLargeError(svixError.Error())
+	case http.StatusTooManyRequests: // 429
+		return utils.NewRateLimitError(svixError.Error())
+	case http.StatusUnprocessableEntity: // 422
+		return utils.NewValidationError("validation_failed", svixError.Error())
+	default:
+		if svixError.Status() >= 500 {
+			return utils.NewInternalError(svixError.Error())
+		}
+		return err
 	}
-	return err
 }
@@ -0,0 +1,251 @@
+package svix
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/svix/svixtest"
+	"github.com/markonick/gigs-challenge/internal/utils"
+)
+
+// countingTransport counts the requests that went through it
+type countingTransport struct {
+	base  http.RoundTripper
+	count int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.count, 1)
+	return c.base.RoundTrip(req)
+}
+
+func TestNewClient(t *testing.T) {
+	event := models.BaseEvent{ID: "evt_1", Type: "user.created"}
+	accepted := func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer testsk_token", r.Header.Get("Authorization"))
+		respond(w, http.StatusAccepted, `{"id":"msg_1","eventType":"user.created","payload":{},"timestamp":"2024-01-01T00:00:00Z"}`)
+	}
+
+	t.Run("targets the configured server", func(t *testing.T) {
+		var calls int32
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			assert.Equal(t, "/api/v1/app/app_1/msg", r.URL.Path)
+			accepted(w, r)
+		}, Config{Debug: true})
+
+		require.NoError(t, client.SendMessage(context.Background(), "app_1", event))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("uses the custom transport", func(t *testing.T) {
+		transport := &countingTransport{base: http.DefaultTransport}
+		client := newTestClient(t, accepted, Config{Transport: transport})
+
+		require.NoError(t, client.SendMessage(context.Background(), "app_1", event))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&transport.count))
+	})
+
+	t.Run("uses the custom HTTP client", func(t *testing.T) {
+		transport := &countingTransport{base: http.DefaultTransport}
+		custom := &http.Client{Transport: transport}
+		client := newTestClient(t, accepted, Config{HTTPClient: custom})
+
+		require.NoError(t, client.SendMessage(context.Background(), "app_1", event))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&transport.count))
+		assert.Equal(t, transport, custom.Transport, "the caller's client must not be modified")
+	})
+
+	t.Run("applies the timeout", func(t *testing.T) {
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Second)
+			accepted(w, r)
+		}, Config{Timeout: 20 * time.Millisecond, Retry: RetryPolicies{OperationSendMessage: {Attempts: 1}}})
+
+		start := time.Now()
+		err := client.SendMessage(context.Background(), "app_1", event)
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), 800*time.Millisecond, "the request must not wait for the slow server")
+		assert.Equal(t, outcomeFailure, classify(err), "a request timing out counts against Svix")
+	})
+
+	t.Run("a deadline hit during a request counts against Svix", func(t *testing.T) {
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Second)
+			accepted(w, r)
+		}, Config{})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		err := client.SendMessage(ctx, "app_1", event)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, outcomeFailure, classify(err))
+	})
+
+	t.Run("a deadline hit waiting for the rate limiter does not count", func(t *testing.T) {
+		var calls int32
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			accepted(w, r)
+		}, Config{RateLimit: RateLimitConfig{App: RateLimit{Rate: 0.1, Burst: 1}}})
+		require.NoError(t, client.SendMessage(context.Background(), "app_1", event))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		err := client.SendMessage(ctx, "app_1", event)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, outcomeIgnored, classify(err))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("rejects an invalid server URL", func(t *testing.T) {
+		_, err := NewClient("testsk_token", Config{ServerURL: "localhost:8071"})
+		assert.Error(t, err)
+	})
+}
+
+func TestSendMessage_FakeServer(t *testing.T) {
+	event := models.BaseEvent{ID: "evt_1", Type: "user.created", Project: "dev", Data: map[string]interface{}{"id": "usr_1"}}
+
+	t.Run("delivers the event", func(t *testing.T) {
+		client, server := newFakeClient(t, Config{})
+		appID := server.AddApplication("app", "")
+
+		require.NoError(t, client.SendMessage(context.Background(), appID, event))
+		messages := server.Messages(appID)
+		require.Len(t, messages, 1)
+		assert.Equal(t, "evt_1", *messages[0].EventId.Get())
+		assert.Equal(t, "user.created", messages[0].EventType)
+		assert.Equal(t, "usr_1", messages[0].Payload["id"])
+	})
+
+	t.Run("duplicate event ID is a conflict", func(t *testing.T) {
+		client, server := newFakeClient(t, Config{})
+		appID := server.AddApplication("app", "")
+		require.NoError(t, client.SendMessage(context.Background(), appID, event))
+
+		err := client.SendMessage(context.Background(), appID, event)
+		var conflictErr *utils.ConflictError
+		assert.ErrorAs(t, err, &conflictErr)
+		assert.Len(t, server.Messages(appID), 1)
+	})
+
+	t.Run("waits out Retry-After", func(t *testing.T) {
+		client, server := newFakeClient(t, Config{Retry: RetryPolicies{"default": fastPolicy}})
+		appID := server.AddApplication("app", "")
+		server.Fail(svixtest.CreateMessage, svixtest.Fault{Status: http.StatusTooManyRequests, RetryAfter: time.Second})
+
+		start := time.Now()
+		require.NoError(t, client.SendMessage(context.Background(), appID, event))
+		assert.GreaterOrEqual(t, time.Since(start), time.Second)
+		assert.Equal(t, 2, server.Requests(svixtest.CreateMessage))
+		assert.Len(t, server.Messages(appID), 1)
+	})
+
+	t.Run("payload too large is not retried", func(t *testing.T) {
+		client, server := newFakeClient(t, Config{Retry: RetryPolicies{"default": fastPolicy}})
+		appID := server.AddApplication("app", "")
+		server.Fail(svixtest.CreateMessage, svixtest.Fault{Status: http.StatusRequestEntityTooLarge})
+
+		err := client.SendMessage(context.Background(), appID, event)
+		var tooLargeErr *utils.PayloadTooLargeError
+		assert.ErrorAs(t, err, &tooLargeErr)
+		assert.Equal(t, 1, server.Requests(svixtest.CreateMessage))
+	})
+
+	t.Run("uses the project rate limit after the application setup", func(t *testing.T) {
+		client, _ := newFakeClient(t, Config{RateLimit: RateLimitConfig{
+			App:      RateLimit{Rate: 100, Burst: 1},
+			Projects: map[string]RateLimit{"dev": {Rate: 100, Burst: 40}},
+		}})
+		ctx := context.Background()
+		appID, err := client.CreateApplication(ctx, "dev", "app")
+		require.NoError(t, err)
+		require.NoError(t, client.SetupApplicationEndpoints(ctx, appID))
+
+		require.NoError(t, client.SendMessage(ctx, appID, event))
+		limiter := client.(*clientImpl).limiter
+		assert.Equal(t, float64(40), limiter.app(appID, "").burst)
+		assert.Equal(t, "dev", limiter.projects[appID])
+	})
+
+	t.Run("unknown application", func(t *testing.T) {
+		client, _ := newFakeClient(t, Config{})
+
+		err := client.SendMessage(context.Background(), "app_unknown", event)
+		var notFoundErr *utils.NotFoundError
+		assert.ErrorAs(t, err, &notFoundErr)
+	})
+}
+
+func TestCreateApplication(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(server *svixtest.Server) (wantID string)
+		wantNew bool
+	}{
+		{
+			name: "finds the application by uid",
+			setup: func(server *svixtest.Server) string {
+				return server.AddApplication("gigs-webhook-service-dev", "dev")
+			},
+		},
+		{
+			name: "adopts an application matched by name on a later page",
+			setup: func(server *svixtest.Server) string {
+				server.SetPageSize(1)
+				server.AddApplication("other", "")
+				server.AddApplication("gigs-webhook-service-staging", "staging")
+				return server.AddApplication("gigs-webhook-service-dev", "")
+			},
+		},
+		{
+			name: "creates a missing application",
+			setup: func(server *svixtest.Server) string {
+				server.AddApplication("gigs-webhook-service-dev", "prod")
+				return ""
+			},
+			wantNew: true,
+		},
+		{
+			name: "treats a conflict on create as created by another replica",
+			setup: func(server *svixtest.Server) string {
+				server.Fail(svixtest.GetApplication, svixtest.Fault{Status: http.StatusNotFound})
+				server.Fail(svixtest.CreateApplication, svixtest.Fault{Status: http.StatusConflict})
+				return server.AddApplication("gigs-webhook-service-dev", "dev")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := newFakeClient(t, Config{})
+			wantID := tt.setup(server)
+			before := len(server.Applications())
+
+			appID, err := client.CreateApplication(context.Background(), "dev", "gigs-webhook-service-dev")
+			require.NoError(t, err)
+
+			apps := server.Applications()
+			if tt.wantNew {
+				require.Len(t, apps, before+1)
+				wantID = apps[len(apps)-1].Id
+			} else {
+				assert.Len(t, apps, before)
+			}
+			assert.Equal(t, wantID, appID)
+			for _, app := range apps {
+				if app.Id == appID {
+					assert.Equal(t, "dev", *app.Uid.Get())
+				}
+			}
+		})
+	}
+}
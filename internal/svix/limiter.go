@@ -0,0 +1,260 @@
+package svix
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/markonick/gigs-challenge/internal/logger"
+)
+
+// RateLimit is a token bucket refilled at Rate tokens per second holding at most Burst tokens.
+// A zero Rate disables the limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitConfig limits the calls made to Svix, per application and for the whole account
+type RateLimitConfig struct {
+	Global RateLimit
+	// App is the limit of every application without a project specific one
+	App RateLimit
+	// Projects overrides App for the application of a project
+	Projects map[string]RateLimit
+}
+
+// ParseRateLimits reads project limits written as "project=rate" or "project=rate:burst"
+func ParseRateLimits(items []string) (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit, len(items))
+	for _, item := range items {
+		project, value, found := strings.Cut(item, "=")
+		if !found || project == "" {
+			return nil, fmt.Errorf("invalid rate limit %q, expected project=rate[:burst]", item)
+		}
+		rawRate, rawBurst, hasBurst := strings.Cut(value, ":")
+		rate, err := strconv.ParseFloat(rawRate, 64)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("invalid rate in %q", item)
+		}
+		limit := RateLimit{Rate: rate, Burst: int(math.Ceil(rate))}
+		if hasBurst {
+			if limit.Burst, err = strconv.Atoi(rawBurst); err != nil || limit.Burst < 1 {
+				return nil, fmt.Errorf("invalid burst in %q", item)
+			}
+		}
+		limits[project] = limit
+	}
+	return limits, nil
+}
+
+// bucket is a token bucket that can be paused, as when Svix answers with Retry-After.
+// Callers reserve a token and sleep until it becomes available, so concurrent
+// workers queue up at the configured rate instead of racing each other.
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	// last is when tokens was computed, it lies in the future while the bucket is paused
+	last time.Time
+}
+
+func newBucket(limit RateLimit, now time.Time) *bucket {
+	if limit.Rate <= 0 {
+		return nil
+	}
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &bucket{rate: limit.Rate, burst: burst, tokens: burst, last: now}
+}
+
+// reserve takes a token and returns how long the caller has to wait for it
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+	b.tokens--
+
+	wait := b.last.Sub(now)
+	if b.tokens < 0 {
+		wait += time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	return wait
+}
+
+// cancel gives back a reserved token that will not be used
+func (b *bucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+// pause empties the bucket and stops refilling it until the given time
+func (b *bucket) pause(until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until.After(b.last) {
+		b.tokens = math.Min(b.tokens, 0)
+		b.last = until
+	}
+}
+
+// wait blocks until a token is available or ctx is done
+func (b *bucket) wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	delay := b.reserve(time.Now())
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
+
+// limiter holds the buckets shared by every worker using the client
+type limiter struct {
+	mu     sync.Mutex
+	config RateLimitConfig
+	global *bucket
+	apps   map[string]*bucket
+	// projects holds the project of every application with a bucket
+	projects map[string]string
+}
+
+func newLimiter(config RateLimitConfig) *limiter {
+	return &limiter{
+		config:   config,
+		global:   newBucket(config.Global, time.Now()),
+		apps:     make(map[string]*bucket),
+		projects: make(map[string]string),
+	}
+}
+
+// reconfigure replaces the limits. The buckets keep their tokens, up to the new burst,
+// and the pauses from Retry-After, so a change of limits neither ends a pause nor
+// hands out a fresh burst on top of the calls just made.
+func (l *limiter) reconfigure(config RateLimitConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.config = config
+	l.global = carry(l.global, config.Global, now)
+	for appID, b := range l.apps {
+		l.apps[appID] = carry(b, l.limitLocked(l.projects[appID]), now)
+	}
+}
+
+// carry returns a bucket with the new limit holding the tokens and the pause of old
+func carry(old *bucket, limit RateLimit, now time.Time) *bucket {
+	b := newBucket(limit, now)
+	if old == nil {
+		return b
+	}
+
+	old.mu.Lock()
+	defer old.mu.Unlock()
+	if b == nil {
+		if !old.last.After(now) {
+			return nil
+		}
+		// Unlimited from now on, the pause still has to be honoured
+		b = newBucket(RateLimit{Rate: math.MaxFloat64, Burst: 1}, now)
+	}
+
+	tokens, last := old.tokens, old.last
+	if now.After(last) {
+		tokens = math.Min(old.burst, tokens+now.Sub(last).Seconds()*old.rate)
+		last = now
+	}
+	b.tokens = math.Min(b.burst, tokens)
+	b.last = last
+	return b
+}
+
+// app returns the bucket of the application, created with the limit of its project.
+// Calls that do not know the project pass an empty one, such as the endpoint setup that
+// runs before the first send, the bucket then takes the project limit once it is known.
+func (l *limiter) app(appID, project string) *bucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.appLocked(appID, project)
+}
+
+func (l *limiter) appLocked(appID, project string) *bucket {
+	b, ok := l.apps[appID]
+	if !ok {
+		b = newBucket(l.limitLocked(project), time.Now())
+		l.apps[appID] = b
+		l.projects[appID] = project
+		return b
+	}
+	if project != "" && l.projects[appID] != project {
+		b = carry(b, l.limitLocked(project), time.Now())
+		l.apps[appID] = b
+		l.projects[appID] = project
+	}
+	return b
+}
+
+// limitLocked returns the limit of the applications of the project
+func (l *limiter) limitLocked(project string) RateLimit {
+	if limit, found := l.config.Projects[project]; found {
+		return limit
+	}
+	return l.config.App
+}
+
+// wait blocks until both the application and the account have room for a call
+func (l *limiter) wait(ctx context.Context, appID, project string) error {
+	l.mu.Lock()
+	global := l.global
+	var app *bucket
+	if appID != "" {
+		app = l.appLocked(appID, project)
+	}
+	l.mu.Unlock()
+
+	if err := app.wait(ctx); err != nil {
+		return err
+	}
+	return global.wait(ctx)
+}
+
+// pause holds back every call to the application until the given time
+func (l *limiter) pause(appID, project string, until time.Time) {
+	l.mu.Lock()
+	b := l.appLocked(appID, project)
+	if b == nil {
+		// Unlimited applications still have to honour Retry-After
+		b = newBucket(RateLimit{Rate: math.MaxFloat64, Burst: 1}, time.Now())
+		l.apps[appID] = b
+	}
+	l.mu.Unlock()
+	b.pause(until)
+
+	logger.Log.Warn().
+		Str("app_id", appID).
+		Time("until", until).
+		Msg("Svix rate limited the application, pausing its calls")
+}
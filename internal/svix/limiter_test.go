@@ -0,0 +1,164 @@
+package svix
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+)
+
+func TestBucket(t *testing.T) {
+	now := time.Now()
+
+	t.Run("spends the burst then waits for refills", func(t *testing.T) {
+		b := newBucket(RateLimit{Rate: 10, Burst: 2}, now)
+		assert.Zero(t, b.reserve(now))
+		assert.Zero(t, b.reserve(now))
+		assert.Equal(t, 100*time.Millisecond, b.reserve(now))
+		assert.Equal(t, 200*time.Millisecond, b.reserve(now))
+
+		// Refills never exceed the burst
+		b = newBucket(RateLimit{Rate: 10, Burst: 2}, now)
+		later := now.Add(time.Hour)
+		assert.Zero(t, b.reserve(later))
+		assert.Zero(t, b.reserve(later))
+		assert.Equal(t, 100*time.Millisecond, b.reserve(later))
+	})
+
+	t.Run("pause holds every caller until the given time", func(t *testing.T) {
+		b := newBucket(RateLimit{Rate: 10, Burst: 5}, now)
+		b.pause(now.Add(time.Second))
+
+		assert.Equal(t, 1100*time.Millisecond, b.reserve(now))
+		assert.Equal(t, 1200*time.Millisecond, b.reserve(now))
+	})
+
+	t.Run("cancelled reservations give the token back", func(t *testing.T) {
+		b := newBucket(RateLimit{Rate: 1, Burst: 1}, now)
+		assert.Zero(t, b.reserve(now))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, b.wait(ctx), context.Canceled)
+		assert.InDelta(t, time.Second, b.reserve(time.Now()), float64(50*time.Millisecond), "the cancelled wait must not keep its token")
+	})
+
+	t.Run("zero rate is unlimited", func(t *testing.T) {
+		assert.Nil(t, newBucket(RateLimit{}, now))
+		assert.NoError(t, (*bucket)(nil).wait(context.Background()))
+	})
+}
+
+func TestLimiter_ProjectLimits(t *testing.T) {
+	l := newLimiter(RateLimitConfig{
+		App:      RateLimit{Rate: 1, Burst: 1},
+		Projects: map[string]RateLimit{"prod": {Rate: 100, Burst: 50}},
+	})
+
+	assert.Equal(t, float64(1), l.app("app_dev", "dev").burst)
+	assert.Equal(t, float64(50), l.app("app_prod", "prod").burst)
+	assert.Same(t, l.app("app_prod", "prod"), l.app("app_prod", ""), "buckets are keyed by app ID")
+
+	// A bucket created before the project was known takes its limit once it is
+	assert.Equal(t, float64(1), l.app("app_staging", "").burst)
+	l.config.Projects["staging"] = RateLimit{Rate: 10, Burst: 20}
+	assert.Equal(t, float64(20), l.app("app_staging", "staging").burst)
+	assert.Equal(t, float64(20), l.app("app_staging", "").burst)
+}
+
+func TestParseRateLimits(t *testing.T) {
+	limits, err := ParseRateLimits([]string{"dev=5", "prod=20:40", "slow=0.5"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]RateLimit{
+		"dev":  {Rate: 5, Burst: 5},
+		"prod": {Rate: 20, Burst: 40},
+		"slow": {Rate: 0.5, Burst: 1},
+	}, limits)
+
+	for _, invalid := range []string{"dev", "=5", "dev=fast", "dev=5:0", "dev=-1"} {
+		_, err := ParseRateLimits([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestSendMessage_RateLimitPausesTheApplication(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []time.Time
+	)
+	firstCall := make(chan struct{})
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		calls = append(calls, time.Now())
+		first := len(calls) == 1
+		mu.Unlock()
+
+		if first {
+			close(firstCall)
+			w.Header().Set("Retry-After", "1")
+			respond(w, http.StatusTooManyRequests, `{"code":"rate_limit","detail":"slow down"}`)
+			return
+		}
+		respond(w, http.StatusAccepted, `{"id":"msg_1","eventType":"user.created","payload":{},"timestamp":"2024-01-01T00:00:00Z"}`)
+	}, Config{Retry: RetryPolicies{OperationSendMessage: fastPolicy}})
+
+	var wg sync.WaitGroup
+	send := func(id string) {
+		defer wg.Done()
+		assert.NoError(t, client.SendMessage(context.Background(), "app_1", models.BaseEvent{ID: id, Type: "user.created"}))
+	}
+	wg.Add(1)
+	go send("evt_1")
+	<-firstCall
+	// Give the first call time to pause the bucket
+	time.Sleep(50 * time.Millisecond)
+	wg.Add(1)
+	go send("evt_2")
+	wg.Wait()
+
+	require.Len(t, calls, 3)
+	for _, call := range calls[1:] {
+		assert.GreaterOrEqual(t, call.Sub(calls[0]), 900*time.Millisecond, "calls must wait for Retry-After")
+	}
+}
+
+func TestLimiter_Reconfigure(t *testing.T) {
+	l := newLimiter(RateLimitConfig{
+		Global: RateLimit{Rate: 10, Burst: 10},
+		App:    RateLimit{Rate: 1, Burst: 5},
+	})
+	for i := 0; i < 4; i++ {
+		require.NoError(t, l.wait(context.Background(), "app_dev", "dev"))
+	}
+	until := time.Now().Add(time.Hour)
+	l.pause("app_prod", "prod", until)
+
+	l.reconfigure(RateLimitConfig{
+		Global:   RateLimit{Rate: 20, Burst: 20},
+		App:      RateLimit{Rate: 2, Burst: 5},
+		Projects: map[string]RateLimit{"prod": {Rate: 100, Burst: 50}},
+	})
+
+	dev := l.app("app_dev", "dev")
+	assert.Equal(t, float64(2), dev.rate)
+	assert.InDelta(t, 1, dev.tokens, 0.1, "the tokens spent before are not handed out again")
+	assert.InDelta(t, 6, l.global.tokens, 0.1)
+	assert.Equal(t, float64(20), l.global.burst)
+
+	prod := l.app("app_prod", "prod")
+	assert.Equal(t, float64(50), prod.burst)
+	assert.Equal(t, until, prod.last, "a pause from Retry-After outlives the new limits")
+
+	// Lifting the limit keeps the pause as well
+	l.reconfigure(RateLimitConfig{})
+	assert.Nil(t, l.global)
+	assert.Nil(t, l.app("app_dev", "dev"))
+	require.NotNil(t, l.app("app_prod", "prod"))
+	assert.Equal(t, until, l.app("app_prod", "prod").last)
+}
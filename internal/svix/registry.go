@@ -0,0 +1,459 @@
+package svix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/markonick/gigs-challenge/internal/health"
+	"github.com/markonick/gigs-challenge/internal/logger"
+	"github.com/markonick/gigs-challenge/internal/utils"
+	svixapi "github.com/svix/svix-webhooks/go"
+)
+
+// RegistryConfig lists the projects set up at startup and how failed setups are retried
+type RegistryConfig struct {
+	// Projects are set up in the background right after startup, the registry is
+	// ready once all of them are
+	Projects []string
+	// Allowlist limits the projects that are accepted, empty accepts every project
+	Allowlist []string
+	// RetryDelay is the wait after the first failed setup round, doubled after each further one
+	RetryDelay time.Duration
+	// MaxRetryDelay caps the wait between setup rounds
+	MaxRetryDelay time.Duration
+}
+
+// DefaultRegistryConfig sets up the dev project and retries from 1s up to every minute
+var DefaultRegistryConfig = RegistryConfig{
+	Projects:      []string{"dev"},
+	RetryDelay:    time.Second,
+	MaxRetryDelay: time.Minute,
+}
+
+const (
+	// maxWantedProjects bounds the projects waiting for setup, events of further new
+	// projects are turned away until some are set up or expire
+	maxWantedProjects = 1000
+	// wantedTTL is how long a project seen in an event keeps being set up without another event
+	wantedTTL = time.Hour
+	// maxPermanentFailures is how many setups in a row Svix may reject with a client error
+	// before the project is given up on
+	maxPermanentFailures = 5
+)
+
+// ProjectRegistry maps Gigs projects onto their Svix application. Run sets the
+// applications up in the background, retrying until Svix answers, so the service
+// does not wait for Svix to start. Projects are set up the first time they are seen
+// and cached afterwards, concurrent lookups of a new project share a single setup.
+type ProjectRegistry struct {
+	client Client
+	// wake tells Run that a project is waiting to be set up
+	wake chan struct{}
+
+	mu     sync.Mutex
+	config RegistryConfig
+	// allowed holds the allowlist, nil allows every project
+	allowed map[string]bool
+	apps    map[string]string
+	pending map[string]*registration
+	// wanted are the projects Run sets up, the configured ones and those seen since,
+	// by when they were last seen
+	wanted map[string]time.Time
+	// rejected counts the setups Svix rejected with a client error in a row, by project
+	rejected map[string]int
+	// givenUp holds until when a project that kept being rejected is not set up again
+	givenUp map[string]time.Time
+	now     func() time.Time
+}
+
+// registration is an application setup in progress, done is closed once it finished
+type registration struct {
+	done  chan struct{}
+	appID string
+	err   error
+}
+
+func NewProjectRegistry(client Client, config RegistryConfig) *ProjectRegistry {
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = DefaultRegistryConfig.RetryDelay
+	}
+	if config.MaxRetryDelay < config.RetryDelay {
+		config.MaxRetryDelay = config.RetryDelay
+	}
+
+	r := &ProjectRegistry{
+		client:   client,
+		config:   config,
+		wake:     make(chan struct{}, 1),
+		allowed:  allowlist(config.Allowlist),
+		apps:     make(map[string]string),
+		pending:  make(map[string]*registration),
+		wanted:   make(map[string]time.Time, len(config.Projects)),
+		rejected: make(map[string]int),
+		givenUp:  make(map[string]time.Time),
+		now:      time.Now,
+	}
+	for _, project := range config.Projects {
+		r.wanted[project] = r.now()
+	}
+	return r
+}
+
+// allowlist returns the set of allowed projects, nil when every project is allowed
+func allowlist(projects []string) map[string]bool {
+	if len(projects) == 0 {
+		return nil
+	}
+	allowed := make(map[string]bool, len(projects))
+	for _, project := range projects {
+		allowed[project] = true
+	}
+	return allowed
+}
+
+// SetProjects replaces the configured projects and the allowlist. New projects are set up
+// by Run right away. Applications already set up stay cached, events of projects that left
+// the allowlist are rejected from now on.
+func (r *ProjectRegistry) SetProjects(projects, allowed []string) {
+	r.mu.Lock()
+	r.config.Projects = projects
+	r.config.Allowlist = allowed
+	r.allowed = allowlist(allowed)
+	added := false
+	for _, project := range projects {
+		if _, ok := r.apps[project]; ok {
+			continue
+		}
+		if _, ok := r.wanted[project]; !ok {
+			added = true
+		}
+		// A configuration change is a fresh start for projects that were given up on
+		r.wanted[project] = r.now()
+		delete(r.rejected, project)
+		delete(r.givenUp, project)
+	}
+	r.mu.Unlock()
+
+	if added {
+		r.notify()
+	}
+}
+
+// Admit accepts events of projects whose application is set up. Projects left out of
+// the allowlist get an unknown project error. Any other project is queued for setup
+// and gets a ServiceUnavailableError, so the event is redelivered once it is ready.
+// Projects Svix kept rejecting are not queued again until the longest retry delay passed,
+// and no new project is queued while too many are waiting for setup.
+func (r *ProjectRegistry) Admit(project string) error {
+	if err := r.allow(project); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	if _, ready := r.apps[project]; ready {
+		r.mu.Unlock()
+		return nil
+	}
+	now := r.now()
+	_, queued := r.wanted[project]
+	if !queued && now.Before(r.givenUp[project]) {
+		r.mu.Unlock()
+		return &utils.ServiceUnavailableError{
+			Code:   utils.ProjectInitializingCode,
+			Detail: fmt.Sprintf("Svix rejected the application setup of project %s, trying again later", project),
+		}
+	}
+	if !queued && len(r.wanted) >= maxWantedProjects {
+		r.mu.Unlock()
+		return &utils.ServiceUnavailableError{
+			Code:   utils.ProjectInitializingCode,
+			Detail: fmt.Sprintf("Too many projects waiting for their Svix application, project %s is not set up yet", project),
+		}
+	}
+	r.wanted[project] = now
+	delete(r.givenUp, project)
+	r.mu.Unlock()
+
+	if !queued {
+		r.notify()
+	}
+	return &utils.ServiceUnavailableError{
+		Code:   utils.ProjectInitializingCode,
+		Detail: fmt.Sprintf("Svix application of project %s is not set up yet", project),
+	}
+}
+
+// allow returns an unknown project error when the project is not on the allowlist
+func (r *ProjectRegistry) allow(project string) error {
+	r.mu.Lock()
+	allowed := r.allowed == nil || r.allowed[project]
+	r.mu.Unlock()
+	if !allowed {
+		return &utils.NotFoundError{
+			Code:   utils.UnknownProjectCode,
+			Detail: fmt.Sprintf("project %s is not allowed", project),
+		}
+	}
+	return nil
+}
+
+// Ready reports whether the applications of all configured projects are set up
+func (r *ProjectRegistry) Ready() bool {
+	return len(r.Pending()) == 0
+}
+
+// Pending returns the configured projects whose application is not set up yet
+func (r *ProjectRegistry) Pending() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var pending []string
+	for _, project := range r.config.Projects {
+		if _, ok := r.apps[project]; !ok {
+			pending = append(pending, project)
+		}
+	}
+	return pending
+}
+
+// Lookup returns the cached application ID of the project without setting it up
+func (r *ProjectRegistry) Lookup(project string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	appID, ok := r.apps[project]
+	return appID, ok
+}
+
+// Applications returns a copy of the project to application ID mapping
+func (r *ProjectRegistry) Applications() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	apps := make(map[string]string, len(r.apps))
+	for project, appID := range r.apps {
+		apps[project] = appID
+	}
+	return apps
+}
+
+// AppID returns the application ID of the project, setting the application up
+// when the project is seen for the first time. Failed setups are not cached.
+func (r *ProjectRegistry) AppID(ctx context.Context, project string) (string, error) {
+	if err := r.allow(project); err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	if appID, ok := r.apps[project]; ok {
+		r.mu.Unlock()
+		return appID, nil
+	}
+	reg, inProgress := r.pending[project]
+	if !inProgress {
+		reg = &registration{done: make(chan struct{})}
+		r.pending[project] = reg
+	}
+	r.mu.Unlock()
+
+	if !inProgress {
+		reg.appID, reg.err = setupApplication(ctx, r.client, project)
+
+		r.mu.Lock()
+		if reg.err == nil {
+			r.apps[project] = reg.appID
+			delete(r.wanted, project)
+			delete(r.rejected, project)
+		}
+		delete(r.pending, project)
+		r.mu.Unlock()
+		close(reg.done)
+	}
+
+	select {
+	case <-reg.done:
+		return reg.appID, reg.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Run sets up the applications of the wanted projects until ctx is cancelled.
+// Failed rounds are retried with exponential backoff, a newly seen project starts
+// a round right away.
+func (r *ProjectRegistry) Run(ctx context.Context) {
+	delay := r.config.RetryDelay
+	for {
+		// A nil channel never fires, without failures only ctx or a new project ends the wait
+		var retry <-chan time.Time
+		var timer *time.Timer
+		if failed := r.reconcile(ctx); failed > 0 {
+			logger.Log.Warn().
+				Int("failed", failed).
+				Dur("retry_in", delay).
+				Msg("Failed to set up Svix applications, retrying")
+			timer = time.NewTimer(delay)
+			retry = timer.C
+			delay = min(2*delay, r.config.MaxRetryDelay)
+		} else {
+			delay = r.config.RetryDelay
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-r.wake:
+		case <-retry:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// reconcile sets up the wanted projects that have no application yet and returns how many failed.
+// Projects seen in events that expired are dropped, and so are projects Svix rejected with a
+// client error too many times in a row. Configured projects are never dropped, once rejected
+// too often they wait for the longest retry delay and count as failed until they are set up.
+func (r *ProjectRegistry) reconcile(ctx context.Context) int {
+	r.mu.Lock()
+	now := r.now()
+	configured := r.configuredLocked()
+	for project, until := range r.givenUp {
+		if !now.Before(until) {
+			delete(r.givenUp, project)
+		}
+	}
+	failed := 0
+	var missing []string
+	for project, seen := range r.wanted {
+		if _, ok := r.apps[project]; ok {
+			delete(r.wanted, project)
+			continue
+		}
+		if !configured[project] && now.Sub(seen) >= wantedTTL {
+			delete(r.wanted, project)
+			delete(r.rejected, project)
+			continue
+		}
+		if _, paused := r.givenUp[project]; paused {
+			failed++
+			continue
+		}
+		missing = append(missing, project)
+	}
+	r.mu.Unlock()
+	sort.Strings(missing)
+
+	for _, project := range missing {
+		if ctx.Err() != nil {
+			return failed
+		}
+		_, err := r.AppID(ctx, project)
+		if err == nil {
+			continue
+		}
+		failed++
+		if r.reject(project, err) {
+			logger.Log.Error().
+				Err(err).
+				Str("project", project).
+				Dur("retry_in", r.config.MaxRetryDelay).
+				Msg("Svix keeps rejecting the application setup, pausing the project")
+			continue
+		}
+		logger.Log.Warn().
+			Err(err).
+			Str("project", project).
+			Msg("Failed to set up Svix application")
+	}
+	return failed
+}
+
+// configuredLocked returns the set of configured projects
+func (r *ProjectRegistry) configuredLocked() map[string]bool {
+	configured := make(map[string]bool, len(r.config.Projects))
+	for _, project := range r.config.Projects {
+		configured[project] = true
+	}
+	return configured
+}
+
+// reject records a failed setup and reports whether the project was paused. A paused
+// configured project is retried after the longest retry delay, any other project is
+// dropped and only queued again by an event after that delay.
+func (r *ProjectRegistry) reject(project string, err error) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !isClientError(err) {
+		delete(r.rejected, project)
+		return false
+	}
+	r.rejected[project]++
+	if r.rejected[project] < maxPermanentFailures {
+		return false
+	}
+	delete(r.rejected, project)
+	if !r.configuredLocked()[project] {
+		delete(r.wanted, project)
+	}
+	r.givenUp[project] = r.now().Add(r.config.MaxRetryDelay)
+	return true
+}
+
+// isClientError reports whether Svix rejected the call with a 4xx status, which retrying
+// does not fix, a 429 only asks to slow down
+func isClientError(err error) bool {
+	var svixError *svixapi.Error
+	if !errors.As(err, &svixError) {
+		return false
+	}
+	status := svixError.Status()
+	return status >= http.StatusBadRequest && status < http.StatusInternalServerError && status != http.StatusTooManyRequests
+}
+
+func (r *ProjectRegistry) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// setupApplication gets or creates the application of the project and its endpoints,
+// the application uid is the project ID
+func setupApplication(ctx context.Context, client Client, projectID string) (string, error) {
+	appName := fmt.Sprintf("gigs-webhook-service-%s", projectID)
+	appID, err := client.CreateApplication(ctx, projectID, appName)
+	if err != nil {
+		return "", fmt.Errorf("failed to create application for project %s: %w", projectID, err)
+	}
+
+	if err := client.SetupApplicationEndpoints(ctx, appID); err != nil {
+		return "", fmt.Errorf("failed to setup endpoints for project %s: %w", projectID, err)
+	}
+
+	logger.Log.Info().
+		Str("project", projectID).
+		Str("app_id", appID).
+		Msg("Successfully set up Svix application and endpoints")
+	return appID, nil
+}
+
+// RegistryReport is the detail of the registry health check
+type RegistryReport struct {
+	Applications map[string]string `json:"applications"`
+	Pending      []string          `json:"pending,omitempty"`
+}
+
+// HealthCheck is down until the applications of the configured projects are set up
+func (r *ProjectRegistry) HealthCheck(_ context.Context) health.Result {
+	report := RegistryReport{Applications: r.Applications(), Pending: r.Pending()}
+	if len(report.Pending) > 0 {
+		return health.Down(fmt.Errorf("svix applications of %d projects are not set up yet", len(report.Pending)), report)
+	}
+	return health.Up(report)
+}
@@ -0,0 +1,243 @@
+package svix
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/svix/svixtest"
+	"github.com/markonick/gigs-challenge/internal/utils"
+)
+
+// newFakeClient returns a client talking to a fake Svix server
+func newFakeClient(t *testing.T, config Config) (Client, *svixtest.Server) {
+	t.Helper()
+	server := svixtest.NewServer()
+	t.Cleanup(server.Close)
+
+	config.ServerURL = server.URL
+	client, err := NewClient("testsk_token", config)
+	require.NoError(t, err)
+	return client, server
+}
+
+// runRegistry runs the registry in the background until the test ends
+func runRegistry(t *testing.T, registry *ProjectRegistry) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		registry.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestProjectRegistry_Run(t *testing.T) {
+	client, server := newFakeClient(t, Config{Retry: RetryPolicies{"default": fastPolicy}})
+	config := RegistryConfig{Projects: []string{"dev", "prod"}, RetryDelay: 10 * time.Millisecond}
+
+	registry := NewProjectRegistry(client, config)
+	assert.False(t, registry.Ready())
+	assert.Equal(t, []string{"dev", "prod"}, registry.Pending())
+	runRegistry(t, registry)
+	require.Eventually(t, registry.Ready, 2*time.Second, 10*time.Millisecond)
+
+	apps := registry.Applications()
+	require.Len(t, apps, 2)
+	assert.NotEqual(t, apps["dev"], apps["prod"])
+	assert.Len(t, server.EventTypes(), len(models.GetCommonEventTypes()))
+	assert.Len(t, server.Endpoints(apps["dev"]), len(models.GetCommonEventTypes()))
+
+	// A restart finds the applications, event types and endpoints again, across list pages
+	server.SetPageSize(3)
+	restarted := NewProjectRegistry(client, config)
+	runRegistry(t, restarted)
+	require.Eventually(t, restarted.Ready, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, apps, restarted.Applications())
+	assert.Len(t, server.Applications(), 2)
+	assert.Len(t, server.Endpoints(apps["dev"]), len(models.GetCommonEventTypes()))
+	assert.Equal(t, "dev", *server.Applications()[0].Uid.Get())
+}
+
+func TestProjectRegistry_RetriesTransientFailures(t *testing.T) {
+	client, server := newFakeClient(t, Config{Retry: RetryPolicies{"default": fastPolicy}})
+	server.Fail(svixtest.CreateApplication, svixtest.Fault{Status: http.StatusTooManyRequests})
+	server.Fail(svixtest.CreateEndpoint, svixtest.Fault{Status: http.StatusTooManyRequests})
+
+	registry := NewProjectRegistry(client, RegistryConfig{})
+	appID, err := registry.AppID(context.Background(), "dev")
+	require.NoError(t, err)
+	assert.Len(t, server.Applications(), 1)
+	assert.Len(t, server.Endpoints(appID), len(models.GetCommonEventTypes()))
+}
+
+func TestProjectRegistry_RetriesUntilSvixAnswers(t *testing.T) {
+	client, server := newFakeClient(t, Config{})
+	server.Fail(svixtest.GetApplication, svixtest.Fault{Status: http.StatusUnauthorized, Times: 3})
+
+	registry := NewProjectRegistry(client, RegistryConfig{Projects: []string{"dev"}, RetryDelay: 5 * time.Millisecond})
+	runRegistry(t, registry)
+	require.Eventually(t, registry.Ready, 2*time.Second, 5*time.Millisecond)
+	assert.Equal(t, 4, server.Requests(svixtest.GetApplication))
+}
+
+func TestProjectRegistry_Admit(t *testing.T) {
+	client, server := newFakeClient(t, Config{})
+	registry := NewProjectRegistry(client, RegistryConfig{Allowlist: []string{"dev", "prod"}})
+	runRegistry(t, registry)
+
+	// A project seen for the first time is answered with a retryable error and set up in the background
+	err := registry.Admit("prod")
+	var unavailableErr *utils.ServiceUnavailableError
+	require.ErrorAs(t, err, &unavailableErr)
+	assert.Equal(t, utils.ProjectInitializingCode, unavailableErr.Code)
+	require.Eventually(t, func() bool { return registry.Admit("prod") == nil }, 2*time.Second, 10*time.Millisecond)
+	assert.Len(t, server.Applications(), 1)
+
+	err = registry.Admit("acme")
+	var notFoundErr *utils.NotFoundError
+	require.ErrorAs(t, err, &notFoundErr)
+	assert.Equal(t, utils.UnknownProjectCode, notFoundErr.Code)
+}
+
+func TestProjectRegistry_SetsUpNewProjectsOnce(t *testing.T) {
+	client, server := newFakeClient(t, Config{})
+	registry := NewProjectRegistry(client, RegistryConfig{})
+
+	_, found := registry.Lookup("staging")
+	assert.False(t, found)
+
+	var wg sync.WaitGroup
+	appIDs := make([]string, 10)
+	for i := range appIDs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			appID, err := registry.AppID(context.Background(), "staging")
+			assert.NoError(t, err)
+			appIDs[i] = appID
+		}(i)
+	}
+	wg.Wait()
+
+	require.Len(t, server.Applications(), 1)
+	for _, appID := range appIDs {
+		assert.Equal(t, server.Applications()[0].Id, appID)
+	}
+	appID, found := registry.Lookup("staging")
+	assert.True(t, found)
+	assert.Equal(t, appIDs[0], appID)
+}
+
+func TestProjectRegistry_DoesNotCacheFailures(t *testing.T) {
+	client, server := newFakeClient(t, Config{})
+	server.Fail(svixtest.CreateApplication, svixtest.Fault{Status: http.StatusUnauthorized})
+	registry := NewProjectRegistry(client, RegistryConfig{})
+
+	_, err := registry.AppID(context.Background(), "dev")
+	require.Error(t, err)
+	_, found := registry.Lookup("dev")
+	assert.False(t, found)
+
+	appID, err := registry.AppID(context.Background(), "dev")
+	require.NoError(t, err)
+	assert.NotEmpty(t, appID)
+}
+
+func TestProjectRegistry_Allowlist(t *testing.T) {
+	client, server := newFakeClient(t, Config{})
+	registry := NewProjectRegistry(client, RegistryConfig{Allowlist: []string{"dev"}})
+
+	_, err := registry.AppID(context.Background(), "acme")
+	assert.Equal(t, utils.UnknownProjectCode, utils.ErrorClass(err))
+	assert.Empty(t, server.Applications())
+}
+
+func TestProjectRegistry_SetProjects(t *testing.T) {
+	client, _ := newFakeClient(t, Config{Retry: RetryPolicies{"default": fastPolicy}})
+	registry := NewProjectRegistry(client, RegistryConfig{Projects: []string{"dev"}, Allowlist: []string{"dev"}, RetryDelay: 10 * time.Millisecond})
+	runRegistry(t, registry)
+	require.Eventually(t, registry.Ready, 2*time.Second, 10*time.Millisecond)
+
+	registry.SetProjects([]string{"dev", "prod"}, []string{"prod"})
+
+	// The new project is set up right away and gates readiness until it is
+	require.Eventually(t, registry.Ready, 2*time.Second, 10*time.Millisecond)
+	_, ok := registry.Lookup("prod")
+	assert.True(t, ok)
+	assert.NoError(t, registry.Admit("prod"))
+	assert.Equal(t, utils.UnknownProjectCode, utils.ErrorClass(registry.Admit("dev")))
+
+	registry.SetProjects(nil, nil)
+	assert.NoError(t, registry.Admit("dev"))
+}
+
+func TestProjectRegistry_GivesUpOnRejectedProjects(t *testing.T) {
+	client, server := newFakeClient(t, Config{Retry: RetryPolicies{"default": fastPolicy}})
+	server.Fail(svixtest.CreateApplication, svixtest.Fault{Status: http.StatusUnprocessableEntity, Times: 100})
+	registry := NewProjectRegistry(client, RegistryConfig{RetryDelay: 5 * time.Millisecond, MaxRetryDelay: time.Hour})
+	runRegistry(t, registry)
+
+	assert.Error(t, registry.Admit("bad-project"))
+	require.Eventually(t, func() bool {
+		return server.Requests(svixtest.CreateApplication) == maxPermanentFailures
+	}, 2*time.Second, 5*time.Millisecond)
+
+	// Further events neither queue the project again nor reach Svix
+	var unavailableErr *utils.ServiceUnavailableError
+	require.ErrorAs(t, registry.Admit("bad-project"), &unavailableErr)
+	assert.Equal(t, utils.ProjectInitializingCode, unavailableErr.Code)
+	assert.Never(t, func() bool {
+		return server.Requests(svixtest.CreateApplication) > maxPermanentFailures
+	}, 100*time.Millisecond, 10*time.Millisecond)
+}
+
+func TestProjectRegistry_BoundsWantedProjects(t *testing.T) {
+	client, _ := newFakeClient(t, Config{})
+	registry := NewProjectRegistry(client, RegistryConfig{})
+	now := time.Now()
+	registry.now = func() time.Time { return now }
+
+	for i := 0; i < maxWantedProjects; i++ {
+		assert.Error(t, registry.Admit(fmt.Sprintf("project-%d", i)))
+	}
+	assert.Error(t, registry.Admit("one-too-many"))
+	assert.Len(t, registry.wanted, maxWantedProjects)
+	assert.NotContains(t, registry.wanted, "one-too-many")
+
+	// Projects no event asked for in a while are dropped
+	now = now.Add(wantedTTL)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // only the clean up runs, no setup
+	registry.reconcile(ctx)
+	assert.Empty(t, registry.wanted)
+
+	assert.Error(t, registry.Admit("one-too-many"))
+	assert.Contains(t, registry.wanted, "one-too-many")
+}
+
+func TestProjectRegistry_RetriesRejectedConfiguredProjects(t *testing.T) {
+	client, server := newFakeClient(t, Config{Retry: RetryPolicies{"default": fastPolicy}})
+	server.Fail(svixtest.CreateApplication, svixtest.Fault{Status: http.StatusUnprocessableEntity, Times: maxPermanentFailures + 2})
+	registry := NewProjectRegistry(client, RegistryConfig{
+		Projects:      []string{"dev"},
+		RetryDelay:    5 * time.Millisecond,
+		MaxRetryDelay: 50 * time.Millisecond,
+	})
+	runRegistry(t, registry)
+
+	// Paused after the rejections, then set up without an event or a reload
+	require.Eventually(t, registry.Ready, 2*time.Second, 5*time.Millisecond)
+	assert.Equal(t, maxPermanentFailures+3, server.Requests(svixtest.CreateApplication))
+}
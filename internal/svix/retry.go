@@ -1,23 +1,79 @@
 package svix
 
 import (
+	"context"
 	"errors"
+	"math/rand"
 	"net/http"
+	"strconv"
 	"time"
 
-	"github.com/avast/retry-go/v4"
 	"github.com/markonick/gigs-challenge/internal/logger"
+	"github.com/markonick/gigs-challenge/internal/metrics"
+	"github.com/markonick/gigs-challenge/internal/utils"
 	svixapi "github.com/svix/svix-webhooks/go"
 )
 
-type retryConfig struct {
-	attempts uint
-	delay    time.Duration
+// Operations with their own retry policy
+const (
+	OperationSendMessage       = "send_message"
+	OperationCreateEndpoint    = "create_endpoint"
+	OperationCreateApplication = "create_application"
+	OperationCreateEventType   = "create_event_type"
+)
+
+// RetryPolicy controls how a Svix operation is retried.
+// Delays grow exponentially from BaseDelay up to MaxDelay with full jitter, unless
+// Svix asked for a specific wait with Retry-After.
+type RetryPolicy struct {
+	// Attempts is the maximum number of calls, including the first one
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Budget caps the total time spent on the operation, zero means no cap
+	Budget time.Duration
+}
+
+// DefaultRetryPolicy is used for operations without a policy of their own
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:  5,
+	BaseDelay: time.Second,
+	MaxDelay:  30 * time.Second,
+	Budget:    45 * time.Second,
 }
 
-var defaultRetryConfig = retryConfig{
-	attempts: 5,
-	delay:    time.Second,
+// RetryPolicies holds the policy per operation
+type RetryPolicies map[string]RetryPolicy
+
+// For returns the policy of the operation, or the default one
+func (p RetryPolicies) For(operation string) RetryPolicy {
+	if policy, ok := p[operation]; ok {
+		return policy
+	}
+	if policy, ok := p["default"]; ok {
+		return policy
+	}
+	return DefaultRetryPolicy
+}
+
+// jitter returns a random duration in [0, n), replaced in tests
+var jitter = func(n time.Duration) time.Duration {
+	return time.Duration(rand.Int63n(int64(n)))
+}
+
+// backoff returns the full jitter delay before the given retry, counting from 1
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	ceiling := p.BaseDelay
+	for i := 1; i < retry && ceiling < p.MaxDelay; i++ {
+		ceiling *= 2
+	}
+	if p.MaxDelay > 0 && ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return jitter(ceiling)
 }
 
 // shouldRetry checks if a Svix error should be retried
@@ -37,23 +93,120 @@ func shouldRetry(err error) bool {
 	return false
 }
 
-// withRetry executes a Svix operation with retry logic
-func withRetry(operation string, fn func() error) error {
-	err := retry.Do(
-		fn,
-		retry.Attempts(defaultRetryConfig.attempts),
-		retry.Delay(defaultRetryConfig.delay),
-		retry.DelayType(retry.BackOffDelay),
-		retry.RetryIf(shouldRetry),
-		retry.OnRetry(func(n uint, err error) {
-			logger.Log.Warn().
-				Uint("attempt", n+1).
-				Err(err).
-				Str("operation", operation).
-				Msg("Retrying Svix operation")
-		}),
-		// Add this option to preserve original error
-		retry.LastErrorOnly(true),
-	)
-	return err
+// withRetry executes a Svix operation with retry logic. Every attempt gets its own
+// context so that the transport can report the Retry-After header of the response.
+// When the attempts or the budget run out on a retriable error the last one is
+// wrapped in a RetryExhaustedError, a cancelled ctx stops the wait with a CancelledError
+// that keeps the error of the attempt when it is the context error.
+func withRetry(ctx context.Context, operation string, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		hint := &retryHint{attempt: attempt}
+		err := fn(withRetryHint(ctx, hint))
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			// Keep a request timeout, the breaker counts those against Svix
+			if !errors.Is(err, ctx.Err()) {
+				err = ctx.Err()
+			}
+			return &utils.CancelledError{Operation: operation, Attempts: attempt, Err: err}
+		}
+		if !shouldRetry(err) {
+			return err
+		}
+
+		delay := policy.backoff(attempt)
+		if hint.retryAfter > 0 {
+			delay = hint.retryAfter
+		}
+
+		outOfBudget := policy.Budget > 0 && time.Since(start)+delay > policy.Budget
+		if attempt >= policy.Attempts || outOfBudget {
+			return &utils.RetryExhaustedError{Operation: operation, Attempts: attempt, Err: err}
+		}
+
+		metrics.SvixRetries.WithLabelValues(operation).Inc()
+		logger.Ctx(ctx).Warn().
+			Int("attempt", attempt+1).
+			Err(err).
+			Str("operation", operation).
+			Dur("delay", delay).
+			Bool("retry_after", hint.retryAfter > 0).
+			Msg("Retrying Svix operation")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return &utils.CancelledError{Operation: operation, Attempts: attempt, Err: ctx.Err()}
+		}
+	}
+}
+
+// retryHint tells an attempt its number and carries the Retry-After of its response back to withRetry
+type retryHint struct {
+	attempt    int
+	retryAfter time.Duration
+}
+
+type retryHintKey struct{}
+
+func withRetryHint(ctx context.Context, hint *retryHint) context.Context {
+	return context.WithValue(ctx, retryHintKey{}, hint)
+}
+
+// attemptFrom returns the number of the attempt running with ctx, zero outside of withRetry
+func attemptFrom(ctx context.Context) int {
+	if hint, ok := ctx.Value(retryHintKey{}).(*retryHint); ok {
+		return hint.attempt
+	}
+	return 0
+}
+
+// retryAfterFrom returns the Retry-After recorded for the attempt running with ctx
+func retryAfterFrom(ctx context.Context) time.Duration {
+	if hint, ok := ctx.Value(retryHintKey{}).(*retryHint); ok {
+		return hint.retryAfter
+	}
+	return 0
+}
+
+// retryAfterTransport records the Retry-After header of 429 and 503 responses
+// in the retry hint of the request context
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return resp, nil
+	}
+	if hint, ok := req.Context().Value(retryHintKey{}).(*retryHint); ok {
+		hint.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return resp, nil
+}
+
+// parseRetryAfter reads the delay in seconds or the HTTP date form of Retry-After
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
 }
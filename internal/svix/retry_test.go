@@ -0,0 +1,296 @@
+package svix
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/metrics"
+	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/utils"
+	svixapi "github.com/svix/svix-webhooks/go"
+)
+
+var fastPolicy = RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+// newTestClient returns a client talking to handler
+func newTestClient(t *testing.T, handler http.HandlerFunc, config Config) *clientImpl {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	config.ServerURL = server.URL
+	client, err := NewClient("testsk_token", config)
+	require.NoError(t, err)
+	return client.(*clientImpl)
+}
+
+func respond(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(body))
+}
+
+// svixError returns the error the Svix SDK produces for a response with the given status
+func svixError(t *testing.T, status int) error {
+	t.Helper()
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		respond(w, status, `{"code":"error","detail":"failure"}`)
+	}, Config{})
+
+	_, err := client.svix.Application.Get(context.Background(), "app_1")
+	var apiErr *svixapi.Error
+	require.ErrorAs(t, err, &apiErr)
+	return err
+}
+
+// sampleCount returns the number of observations of a histogram
+func sampleCount(t *testing.T, observer prometheus.Observer) uint64 {
+	t.Helper()
+	var metric dto.Metric
+	require.NoError(t, observer.(prometheus.Metric).Write(&metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestWithRetry(t *testing.T) {
+	unavailable := svixError(t, http.StatusServiceUnavailable)
+	badRequest := svixError(t, http.StatusBadRequest)
+
+	tests := []struct {
+		name         string
+		policy       RetryPolicy
+		failures     int
+		err          error
+		wantAttempts int
+		wantErr      func(t *testing.T, err error)
+	}{
+		{
+			name:         "succeeds after transient failures",
+			policy:       fastPolicy,
+			failures:     2,
+			err:          unavailable,
+			wantAttempts: 3,
+			wantErr:      func(t *testing.T, err error) { assert.NoError(t, err) },
+		},
+		{
+			name:         "gives up after the attempts",
+			policy:       fastPolicy,
+			failures:     10,
+			err:          unavailable,
+			wantAttempts: 3,
+			wantErr: func(t *testing.T, err error) {
+				var retryErr *utils.RetryExhaustedError
+				require.ErrorAs(t, err, &retryErr)
+				assert.Equal(t, 3, retryErr.Attempts)
+				assert.Equal(t, unavailable, retryErr.Err)
+			},
+		},
+		{
+			name:         "gives up when the budget is spent",
+			policy:       RetryPolicy{Attempts: 10, BaseDelay: time.Second, MaxDelay: time.Second, Budget: time.Millisecond},
+			failures:     10,
+			err:          unavailable,
+			wantAttempts: 1,
+			wantErr: func(t *testing.T, err error) {
+				var retryErr *utils.RetryExhaustedError
+				assert.ErrorAs(t, err, &retryErr)
+			},
+		},
+		{
+			name:         "does not retry permanent errors",
+			policy:       fastPolicy,
+			failures:     10,
+			err:          badRequest,
+			wantAttempts: 1,
+			wantErr:      func(t *testing.T, err error) { assert.Equal(t, badRequest, err) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := withRetry(context.Background(), OperationSendMessage, tt.policy, func(_ context.Context) error {
+				attempts++
+				if attempts <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+
+			assert.Equal(t, tt.wantAttempts, attempts)
+			tt.wantErr(t, err)
+		})
+	}
+}
+
+func TestWithRetry_StopsWhenContextIsCancelled(t *testing.T) {
+	unavailable := svixError(t, http.StatusServiceUnavailable)
+	policy := RetryPolicy{Attempts: 5, BaseDelay: time.Second, MaxDelay: time.Second}
+	original := jitter
+	t.Cleanup(func() { jitter = original })
+	jitter = func(n time.Duration) time.Duration { return n }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	start := time.Now()
+	err := withRetry(ctx, OperationSendMessage, policy, func(_ context.Context) error {
+		attempts++
+		time.AfterFunc(20*time.Millisecond, cancel)
+		return unavailable
+	})
+
+	assert.Less(t, time.Since(start), policy.BaseDelay, "must not sleep through the backoff")
+	assert.Equal(t, 1, attempts)
+	var cancelledErr *utils.CancelledError
+	require.ErrorAs(t, err, &cancelledErr)
+	assert.Equal(t, OperationSendMessage, cancelledErr.Operation)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, "cancelled", utils.ErrorClass(err))
+}
+
+func TestWithRetry_HonoursRetryAfter(t *testing.T) {
+	unavailable := svixError(t, http.StatusServiceUnavailable)
+	// Without Retry-After the backoff would be far longer than the test timeout
+	policy := RetryPolicy{Attempts: 2, BaseDelay: time.Hour, MaxDelay: time.Hour}
+
+	attempts := 0
+	start := time.Now()
+	err := withRetry(context.Background(), OperationSendMessage, policy, func(ctx context.Context) error {
+		attempts++
+		if attempts == 1 {
+			ctx.Value(retryHintKey{}).(*retryHint).retryAfter = 30 * time.Millisecond
+			return unavailable
+		}
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	original := jitter
+	t.Cleanup(func() { jitter = original })
+	// Return the ceiling itself so it can be asserted
+	jitter = func(n time.Duration) time.Duration { return n }
+
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for retry, want := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		3:  400 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		80: time.Second,
+	} {
+		assert.Equal(t, want, policy.backoff(retry), "retry %d", retry)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"3":                             3 * time.Second,
+		"-1":                            0,
+		"soon":                          0,
+		"Mon, 01 Jan 2024 12:00:10 GMT": 10 * time.Second,
+		"Mon, 01 Jan 2024 11:00:00 GMT": 0,
+	}
+	for value, want := range tests {
+		assert.Equal(t, want, parseRetryAfter(value, now), "Retry-After %q", value)
+	}
+}
+
+func TestRetryAfterTransport(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		respond(w, http.StatusTooManyRequests, `{"code":"rate_limit","detail":"slow down"}`)
+	}, Config{})
+
+	hint := &retryHint{}
+	_, err := client.svix.Application.Get(withRetryHint(context.Background(), hint), "app_1")
+	require.Error(t, err)
+	assert.Equal(t, 7*time.Second, hint.retryAfter)
+}
+
+func TestSendMessage_RetriesRateLimits(t *testing.T) {
+	event := models.BaseEvent{ID: "evt_1", Type: "user.created", Data: map[string]interface{}{"id": "1"}}
+	message := `{"id":"msg_1","eventType":"user.created","payload":{"id":"1"},"timestamp":"2024-01-01T00:00:00Z"}`
+
+	t.Run("rate limited requests are retried", func(t *testing.T) {
+		retries := testutil.ToFloat64(metrics.SvixRetries.WithLabelValues(OperationSendMessage))
+		limited := sampleCount(t, metrics.SvixRequestDuration.WithLabelValues("send_message", "429"))
+		var calls int32
+		client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.Header().Set("Retry-After", "0")
+				respond(w, http.StatusTooManyRequests, `{"code":"rate_limit","detail":"slow down"}`)
+				return
+			}
+			respond(w, http.StatusAccepted, message)
+		}, Config{Retry: RetryPolicies{OperationSendMessage: fastPolicy}})
+
+		require.NoError(t, client.SendMessage(context.Background(), "app_1", event))
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+		assert.Equal(t, retries+2, testutil.ToFloat64(metrics.SvixRetries.WithLabelValues(OperationSendMessage)))
+		assert.Equal(t, limited+2, sampleCount(t, metrics.SvixRequestDuration.WithLabelValues("send_message", "429")))
+	})
+
+	t.Run("errors are mapped once retries are exhausted", func(t *testing.T) {
+		client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+			respond(w, http.StatusTooManyRequests, `{"code":"rate_limit","detail":"slow down"}`)
+		}, Config{Retry: RetryPolicies{OperationSendMessage: fastPolicy}})
+
+		err := client.SendMessage(context.Background(), "app_1", event)
+		var retryErr *utils.RetryExhaustedError
+		require.ErrorAs(t, err, &retryErr)
+		assert.Equal(t, fastPolicy.Attempts, retryErr.Attempts)
+		var rateLimitErr *utils.RateLimitError
+		assert.ErrorAs(t, err, &rateLimitErr)
+	})
+
+	t.Run("conflicts are not retried", func(t *testing.T) {
+		var calls int32
+		client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			respond(w, http.StatusConflict, `{"code":"conflict","detail":"duplicate"}`)
+		}, Config{Retry: RetryPolicies{OperationSendMessage: fastPolicy}})
+
+		err := client.SendMessage(context.Background(), "app_1", event)
+		var conflictErr *utils.ConflictError
+		assert.ErrorAs(t, err, &conflictErr)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+}
+
+func TestClient_Reconfigure(t *testing.T) {
+	event := models.BaseEvent{ID: "evt_1", Type: "user.created", Data: map[string]interface{}{"id": "1"}}
+	var calls int32
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		respond(w, http.StatusTooManyRequests, `{"code":"rate_limit","detail":"slow down"}`)
+	}, Config{Retry: RetryPolicies{OperationSendMessage: fastPolicy}})
+
+	// The wrappers pass the new policies on to the client
+	wrapped := NewBreakerClient(NewStatsClient(client), BreakerConfig{})
+	wrapped.SetRetryPolicies(RetryPolicies{"default": {Attempts: 1}})
+	wrapped.SetRateLimits(RateLimitConfig{Global: RateLimit{Rate: 100, Burst: 7}})
+
+	var retryErr *utils.RetryExhaustedError
+	require.ErrorAs(t, client.SendMessage(context.Background(), "app_1", event), &retryErr)
+	assert.Equal(t, 1, retryErr.Attempts)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, float64(7), client.limiter.global.burst)
+}
@@ -0,0 +1,164 @@
+package svix
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/markonick/gigs-challenge/internal/health"
+	"github.com/markonick/gigs-challenge/internal/models"
+)
+
+// OperationPing is the reachability check behind the Svix health check
+const OperationPing = "ping"
+
+// OperationStats summarizes the calls of one operation, latencies include retries
+type OperationStats struct {
+	Calls         int64   `json:"calls"`
+	Failures      int64   `json:"failures"`
+	LastLatencyMs float64 `json:"last_latency_ms"`
+	AvgLatencyMs  float64 `json:"avg_latency_ms"`
+}
+
+// ProjectStats tracks the deliveries of one project
+type ProjectStats struct {
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastFailure *time.Time `json:"last_failure,omitempty"`
+}
+
+// StatsReport is the detail of the Svix health check
+type StatsReport struct {
+	Operations map[string]OperationStats `json:"operations"`
+	Projects   map[string]ProjectStats   `json:"projects"`
+}
+
+type operationStats struct {
+	calls, failures int64
+	last, total     time.Duration
+}
+
+// StatsClient records the latency of every call and the last delivery per project
+type StatsClient struct {
+	client Client
+	now    func() time.Time
+
+	mu         sync.Mutex
+	operations map[string]*operationStats
+	projects   map[string]ProjectStats
+}
+
+func NewStatsClient(client Client) *StatsClient {
+	return &StatsClient{
+		client:     client,
+		now:        time.Now,
+		operations: make(map[string]*operationStats),
+		projects:   make(map[string]ProjectStats),
+	}
+}
+
+func (c *StatsClient) record(operation string, start time.Time, err error) {
+	latency := c.now().Sub(start)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats, ok := c.operations[operation]
+	if !ok {
+		stats = &operationStats{}
+		c.operations[operation] = stats
+	}
+	stats.calls++
+	stats.last = latency
+	stats.total += latency
+	if err != nil {
+		stats.failures++
+	}
+}
+
+// SetRetryPolicies passes the retry policies on to the wrapped client
+func (c *StatsClient) SetRetryPolicies(retry RetryPolicies) {
+	if client, ok := c.client.(Reconfigurer); ok {
+		client.SetRetryPolicies(retry)
+	}
+}
+
+// SetRateLimits passes the rate limits on to the wrapped client
+func (c *StatsClient) SetRateLimits(rateLimit RateLimitConfig) {
+	if client, ok := c.client.(Reconfigurer); ok {
+		client.SetRateLimits(rateLimit)
+	}
+}
+
+func (c *StatsClient) Ping(ctx context.Context) error {
+	start := c.now()
+	err := c.client.Ping(ctx)
+	c.record(OperationPing, start, err)
+	return err
+}
+
+func (c *StatsClient) CreateApplication(ctx context.Context, uid, name string) (string, error) {
+	start := c.now()
+	appID, err := c.client.CreateApplication(ctx, uid, name)
+	c.record(OperationCreateApplication, start, err)
+	return appID, err
+}
+
+func (c *StatsClient) SetupApplicationEndpoints(ctx context.Context, appID string) error {
+	start := c.now()
+	err := c.client.SetupApplicationEndpoints(ctx, appID)
+	c.record(OperationCreateEndpoint, start, err)
+	return err
+}
+
+func (c *StatsClient) SendMessage(ctx context.Context, appID string, event models.BaseEvent) error {
+	start := c.now()
+	err := c.client.SendMessage(ctx, appID, event)
+	c.record(OperationSendMessage, start, err)
+
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.projects[event.Project]
+	if err == nil {
+		stats.LastSuccess = &now
+	} else {
+		stats.LastFailure = &now
+	}
+	c.projects[event.Project] = stats
+	return err
+}
+
+// Stats returns the latency per operation and the last deliveries per project
+func (c *StatsClient) Stats() StatsReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	report := StatsReport{
+		Operations: make(map[string]OperationStats, len(c.operations)),
+		Projects:   make(map[string]ProjectStats, len(c.projects)),
+	}
+	for operation, stats := range c.operations {
+		report.Operations[operation] = OperationStats{
+			Calls:         stats.calls,
+			Failures:      stats.failures,
+			LastLatencyMs: milliseconds(stats.last),
+			AvgLatencyMs:  milliseconds(stats.total / time.Duration(stats.calls)),
+		}
+	}
+	for project, stats := range c.projects {
+		report.Projects[project] = stats
+	}
+	return report
+}
+
+// HealthCheck pings Svix and reports the call statistics, it is down when Svix cannot be reached
+func (c *StatsClient) HealthCheck(ctx context.Context) health.Result {
+	err := c.Ping(ctx)
+	if err != nil {
+		return health.Down(fmt.Errorf("svix is not reachable: %w", err), c.Stats())
+	}
+	return health.Up(c.Stats())
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
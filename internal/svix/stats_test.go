@@ -0,0 +1,49 @@
+package svix
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/health"
+	"github.com/markonick/gigs-challenge/internal/models"
+)
+
+func TestStatsClient(t *testing.T) {
+	fake := &fakeClient{errs: map[string]error{"app_b": errors.New("unavailable")}}
+	client := NewStatsClient(fake)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	client.now = func() time.Time {
+		now = now.Add(10 * time.Millisecond)
+		return now
+	}
+
+	require.NoError(t, client.SendMessage(context.Background(), "app_a", models.BaseEvent{Project: "dev"}))
+	require.Error(t, client.SendMessage(context.Background(), "app_b", models.BaseEvent{Project: "prod"}))
+
+	stats := client.Stats()
+	assert.Equal(t, OperationStats{Calls: 2, Failures: 1, LastLatencyMs: 10, AvgLatencyMs: 10}, stats.Operations[OperationSendMessage])
+	require.NotNil(t, stats.Projects["dev"].LastSuccess)
+	assert.Nil(t, stats.Projects["dev"].LastFailure)
+	assert.Nil(t, stats.Projects["prod"].LastSuccess)
+	require.NotNil(t, stats.Projects["prod"].LastFailure)
+
+	result := client.HealthCheck(context.Background())
+	assert.Equal(t, health.StatusUp, result.Status)
+	assert.Equal(t, int64(1), client.Stats().Operations[OperationPing].Calls)
+}
+
+func TestStatsClient_HealthCheckFailsWhenSvixIsUnreachable(t *testing.T) {
+	client, server := newFakeClient(t, Config{})
+	stats := NewStatsClient(client)
+	assert.Equal(t, health.StatusUp, stats.HealthCheck(context.Background()).Status)
+
+	server.Close()
+	result := stats.HealthCheck(context.Background())
+	assert.Equal(t, health.StatusDown, result.Status)
+	assert.Contains(t, result.Error, "not reachable")
+}
@@ -0,0 +1,425 @@
+// Package svixtest provides an in-process fake of the subset of the Svix API the
+// service uses, so Svix clients can be exercised end to end without the network.
+package svixtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	svixapi "github.com/svix/svix-webhooks/go"
+)
+
+// Route names an operation of the fake server, faults are scripted per route
+type Route string
+
+const (
+	ListApplications  Route = "list_applications"
+	GetApplication    Route = "get_application"
+	CreateApplication Route = "create_application"
+	PatchApplication  Route = "patch_application"
+	CreateEventType   Route = "create_event_type"
+	ListEndpoints     Route = "list_endpoints"
+	CreateEndpoint    Route = "create_endpoint"
+	CreateMessage     Route = "create_message"
+)
+
+// Fault is an error response returned instead of handling the request.
+// Note that the Svix SDK itself retries transport errors and 5xx responses up
+// to three times per call, so a 5xx fault is consumed up to three times per attempt.
+type Fault struct {
+	Status int
+	// RetryAfter is sent as the Retry-After header in seconds when set
+	RetryAfter time.Duration
+	// Times the fault is returned before the route recovers, once when zero
+	Times int
+}
+
+// Server is a fake Svix API backed by memory. It is safe for concurrent use.
+type Server struct {
+	// URL of the server, to be used as the Svix client server URL
+	URL string
+
+	server *httptest.Server
+
+	mu         sync.Mutex
+	pageSize   int
+	apps       []svixapi.ApplicationOut
+	eventTypes map[string]svixapi.EventTypeOut
+	endpoints  map[string][]svixapi.EndpointOut
+	messages   map[string][]svixapi.MessageOut
+	faults     map[Route][]Fault
+	requests   map[Route]int
+	nextID     int
+}
+
+// NewServer starts a fake Svix server, callers should Close it when done
+func NewServer() *Server {
+	s := &Server{
+		eventTypes: make(map[string]svixapi.EventTypeOut),
+		endpoints:  make(map[string][]svixapi.EndpointOut),
+		messages:   make(map[string][]svixapi.MessageOut),
+		faults:     make(map[Route][]Fault),
+		requests:   make(map[Route]int),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Fail queues a fault for the route, queued faults are returned in order
+func (s *Server) Fail(route Route, fault Fault) {
+	if fault.Times <= 0 {
+		fault.Times = 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[route] = append(s.faults[route], fault)
+}
+
+// SetPageSize limits the number of items per list page, zero disables the limit
+func (s *Server) SetPageSize(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageSize = size
+}
+
+// AddApplication seeds an application as if it had been created earlier and returns its ID
+func (s *Server) AddApplication(name, uid string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addApplication(name, uid).Id
+}
+
+// Requests returns how many requests reached the route, faults included
+func (s *Server) Requests(route Route) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[route]
+}
+
+// Applications returns the applications, oldest first
+func (s *Server) Applications() []svixapi.ApplicationOut {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]svixapi.ApplicationOut(nil), s.apps...)
+}
+
+// EventTypes returns the names of the event types, sorted
+func (s *Server) EventTypes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.eventTypes))
+	for name := range s.eventTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Endpoints returns the endpoints of the application
+func (s *Server) Endpoints(appID string) []svixapi.EndpointOut {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]svixapi.EndpointOut(nil), s.endpoints[appID]...)
+}
+
+// Messages returns the messages accepted for the application, oldest first
+func (s *Server) Messages(appID string) []svixapi.MessageOut {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]svixapi.MessageOut(nil), s.messages[appID]...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	route, appRef, ok := match(r.Method, r.URL.Path)
+	if !ok {
+		respondError(w, http.StatusNotFound, "not_found", "Entity not found")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[route]++
+	if s.fault(w, route) {
+		return
+	}
+
+	var app *svixapi.ApplicationOut
+	if appRef != "" && route != GetApplication {
+		if app = s.findApplication(appRef); app == nil {
+			respondError(w, http.StatusNotFound, "not_found", "Application not found")
+			return
+		}
+	}
+
+	switch route {
+	case ListApplications:
+		items, iterator, done := page(s.apps, r, s.pageSize, func(a svixapi.ApplicationOut) string { return a.Id })
+		respond(w, http.StatusOK, svixapi.ListResponseApplicationOut{
+			Data: items, Iterator: *svixapi.NullableString(iterator), Done: done,
+		})
+	case GetApplication:
+		if app = s.findApplication(appRef); app == nil {
+			respondError(w, http.StatusNotFound, "not_found", "Application not found")
+			return
+		}
+		respond(w, http.StatusOK, app)
+	case CreateApplication:
+		s.createApplication(w, r)
+	case PatchApplication:
+		s.patchApplication(w, r, app)
+	case CreateEventType:
+		s.createEventType(w, r)
+	case ListEndpoints:
+		items, iterator, done := page(s.endpoints[app.Id], r, s.pageSize, func(e svixapi.EndpointOut) string { return e.Id })
+		respond(w, http.StatusOK, svixapi.ListResponseEndpointOut{
+			Data: items, Iterator: *svixapi.NullableString(iterator), Done: done,
+		})
+	case CreateEndpoint:
+		s.createEndpoint(w, r, app.Id)
+	case CreateMessage:
+		s.createMessage(w, r, app.Id)
+	}
+}
+
+// match resolves the route and the application ID or uid in the path
+func match(method, path string) (Route, string, bool) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/api/v1/"), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "app" && method == http.MethodGet:
+		return ListApplications, "", true
+	case len(parts) == 1 && parts[0] == "app" && method == http.MethodPost:
+		return CreateApplication, "", true
+	case len(parts) == 1 && parts[0] == "event-type" && method == http.MethodPost:
+		return CreateEventType, "", true
+	case len(parts) == 2 && parts[0] == "app" && method == http.MethodGet:
+		return GetApplication, parts[1], true
+	case len(parts) == 2 && parts[0] == "app" && method == http.MethodPatch:
+		return PatchApplication, parts[1], true
+	case len(parts) == 3 && parts[0] == "app" && parts[2] == "endpoint" && method == http.MethodGet:
+		return ListEndpoints, parts[1], true
+	case len(parts) == 3 && parts[0] == "app" && parts[2] == "endpoint" && method == http.MethodPost:
+		return CreateEndpoint, parts[1], true
+	case len(parts) == 3 && parts[0] == "app" && parts[2] == "msg" && method == http.MethodPost:
+		return CreateMessage, parts[1], true
+	default:
+		return "", "", false
+	}
+}
+
+// fault answers with the next queued fault of the route, if any
+func (s *Server) fault(w http.ResponseWriter, route Route) bool {
+	queue := s.faults[route]
+	if len(queue) == 0 {
+		return false
+	}
+	fault := queue[0]
+	if fault.Times--; fault.Times == 0 {
+		s.faults[route] = queue[1:]
+	} else {
+		queue[0] = fault
+	}
+
+	if fault.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(fault.RetryAfter.Round(time.Second)/time.Second)))
+	}
+	respondError(w, fault.Status, "fault", fmt.Sprintf("Scripted %d response", fault.Status))
+	return true
+}
+
+func (s *Server) createApplication(w http.ResponseWriter, r *http.Request) {
+	var in svixapi.ApplicationIn
+	if !decode(w, r, &in) {
+		return
+	}
+	if uid := in.GetUid(); uid != "" {
+		if existing := s.findApplication(uid); existing != nil {
+			if r.URL.Query().Get("get_if_exists") == "true" {
+				respond(w, http.StatusOK, existing)
+				return
+			}
+			respondError(w, http.StatusConflict, "conflict", "An application with this uid already exists")
+			return
+		}
+	}
+	app := s.addApplication(in.Name, in.GetUid())
+	if in.RateLimit.IsSet() {
+		app.RateLimit = in.RateLimit
+	}
+	respond(w, http.StatusCreated, app)
+}
+
+func (s *Server) patchApplication(w http.ResponseWriter, r *http.Request, app *svixapi.ApplicationOut) {
+	var patch svixapi.ApplicationPatch
+	if !decode(w, r, &patch) {
+		return
+	}
+	if uid := patch.Uid.Get(); uid != nil {
+		if existing := s.findApplication(*uid); existing != nil && existing.Id != app.Id {
+			respondError(w, http.StatusConflict, "conflict", "An application with this uid already exists")
+			return
+		}
+		app.Uid = patch.Uid
+	}
+	if patch.Name != nil {
+		app.Name = *patch.Name
+	}
+	app.UpdatedAt = time.Now().UTC()
+	respond(w, http.StatusOK, app)
+}
+
+func (s *Server) createEventType(w http.ResponseWriter, r *http.Request) {
+	var in svixapi.EventTypeIn
+	if !decode(w, r, &in) {
+		return
+	}
+	if _, exists := s.eventTypes[in.Name]; exists {
+		respondError(w, http.StatusConflict, "event_type_exists", "An event type with this name already exists")
+		return
+	}
+	now := time.Now().UTC()
+	eventType := svixapi.EventTypeOut{Name: in.Name, Description: in.Description, CreatedAt: now, UpdatedAt: now}
+	s.eventTypes[in.Name] = eventType
+	respond(w, http.StatusCreated, eventType)
+}
+
+func (s *Server) createEndpoint(w http.ResponseWriter, r *http.Request, appID string) {
+	var in svixapi.EndpointIn
+	if !decode(w, r, &in) {
+		return
+	}
+	now := time.Now().UTC()
+	version := in.GetVersion()
+	if version == 0 {
+		version = 1
+	}
+	endpoint := svixapi.EndpointOut{
+		Id:          s.newID("ep"),
+		Url:         in.Url,
+		Description: in.GetDescription(),
+		FilterTypes: in.FilterTypes,
+		Metadata:    map[string]string{},
+		Version:     version,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	s.endpoints[appID] = append(s.endpoints[appID], endpoint)
+	respond(w, http.StatusCreated, endpoint)
+}
+
+func (s *Server) createMessage(w http.ResponseWriter, r *http.Request, appID string) {
+	var in svixapi.MessageIn
+	if !decode(w, r, &in) {
+		return
+	}
+	if eventID := in.GetEventId(); eventID != "" {
+		for _, message := range s.messages[appID] {
+			if message.EventId.Get() != nil && *message.EventId.Get() == eventID {
+				respondError(w, http.StatusConflict, "conflict", "A message with this eventId already exists")
+				return
+			}
+		}
+	}
+	message := svixapi.MessageOut{
+		Id:        s.newID("msg"),
+		EventId:   in.EventId,
+		EventType: in.EventType,
+		Payload:   in.Payload,
+		Timestamp: time.Now().UTC(),
+	}
+	if message.Payload == nil {
+		message.Payload = map[string]interface{}{}
+	}
+	s.messages[appID] = append(s.messages[appID], message)
+	respond(w, http.StatusAccepted, message)
+}
+
+func (s *Server) addApplication(name, uid string) *svixapi.ApplicationOut {
+	now := time.Now().UTC()
+	app := svixapi.ApplicationOut{
+		Id:        s.newID("app"),
+		Name:      name,
+		Metadata:  map[string]string{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if uid != "" {
+		app.Uid = *svixapi.NullableString(&uid)
+	}
+	s.apps = append(s.apps, app)
+	return &s.apps[len(s.apps)-1]
+}
+
+// findApplication looks an application up by ID or uid
+func (s *Server) findApplication(ref string) *svixapi.ApplicationOut {
+	for i := range s.apps {
+		if s.apps[i].Id == ref || (s.apps[i].Uid.Get() != nil && *s.apps[i].Uid.Get() == ref) {
+			return &s.apps[i]
+		}
+	}
+	return nil
+}
+
+func (s *Server) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s_%06d", prefix, s.nextID)
+}
+
+// page returns the items after the iterator, at most limit or the page size of them
+func page[T any](items []T, r *http.Request, pageSize int, id func(T) string) ([]T, *string, bool) {
+	start := 0
+	if iterator := r.URL.Query().Get("iterator"); iterator != "" {
+		for i, item := range items {
+			if id(item) == iterator {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	size := len(items) - start
+	if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && limit > 0 && limit < size {
+		size = limit
+	}
+	if pageSize > 0 && pageSize < size {
+		size = pageSize
+	}
+
+	data := append([]T{}, items[start:start+size]...)
+	done := start+size == len(items)
+	if len(data) == 0 {
+		return data, nil, done
+	}
+	iterator := id(data[len(data)-1])
+	return data, &iterator, done
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		respondError(w, http.StatusUnprocessableEntity, "validation", err.Error())
+		return false
+	}
+	return true
+}
+
+func respond(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func respondError(w http.ResponseWriter, status int, code, detail string) {
+	respond(w, status, map[string]string{"code": code, "detail": detail})
+}
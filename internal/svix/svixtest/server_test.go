@@ -0,0 +1,126 @@
+package svixtest
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	svixapi "github.com/svix/svix-webhooks/go"
+)
+
+func newSDK(t *testing.T, server *Server) *svixapi.Svix {
+	t.Helper()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	return svixapi.New("testsk_token", &svixapi.SvixOptions{ServerUrl: serverURL})
+}
+
+func TestServer_Applications(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client := newSDK(t, server)
+	ctx := context.Background()
+
+	uid := "dev"
+	app, err := client.Application.Create(ctx, &svixapi.ApplicationIn{Name: "app-dev", Uid: *svixapi.NullableString(&uid)})
+	require.NoError(t, err)
+
+	got, err := client.Application.Get(ctx, "dev")
+	require.NoError(t, err)
+	assert.Equal(t, app.Id, got.Id)
+
+	_, err = client.Application.Create(ctx, &svixapi.ApplicationIn{Name: "app-dev", Uid: *svixapi.NullableString(&uid)})
+	var apiErr *svixapi.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusConflict, apiErr.Status())
+
+	existing, err := client.Application.GetOrCreate(ctx, &svixapi.ApplicationIn{Name: "app-dev", Uid: *svixapi.NullableString(&uid)})
+	require.NoError(t, err)
+	assert.Equal(t, app.Id, existing.Id)
+
+	_, err = client.Application.Get(ctx, "missing")
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.Status())
+}
+
+func TestServer_Pagination(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.SetPageSize(2)
+	for _, name := range []string{"a", "b", "c"} {
+		server.AddApplication(name, "")
+	}
+	client := newSDK(t, server)
+
+	var names []string
+	var iterator *string
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 3)
+		list, err := client.Application.List(context.Background(), &svixapi.ApplicationListOptions{Iterator: iterator})
+		require.NoError(t, err)
+		for _, app := range list.Data {
+			names = append(names, app.Name)
+		}
+		if list.Done {
+			break
+		}
+		iterator = list.Iterator.Get()
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+}
+
+func TestServer_Messages(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	appID := server.AddApplication("app", "")
+	client := newSDK(t, server)
+	ctx := context.Background()
+
+	eventID := "evt_1"
+	message := &svixapi.MessageIn{EventId: *svixapi.NullableString(&eventID), EventType: "user.created", Payload: map[string]interface{}{"id": "1"}}
+	_, err := client.Message.Create(ctx, appID, message)
+	require.NoError(t, err)
+
+	_, err = client.Message.Create(ctx, appID, message)
+	var apiErr *svixapi.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusConflict, apiErr.Status())
+
+	_, err = client.Message.Create(ctx, "app_unknown", message)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.Status())
+
+	require.Len(t, server.Messages(appID), 1)
+	assert.Equal(t, "1", server.Messages(appID)[0].Payload["id"])
+}
+
+func TestServer_Faults(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	appID := server.AddApplication("app", "")
+	client := newSDK(t, server)
+
+	server.Fail(CreateMessage, Fault{Status: http.StatusTooManyRequests, RetryAfter: 2 * time.Second})
+	server.Fail(CreateMessage, Fault{Status: http.StatusRequestEntityTooLarge})
+
+	resp, err := http.Post(server.URL+"/api/v1/app/"+appID+"/msg", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+
+	message := &svixapi.MessageIn{EventType: "user.created", Payload: map[string]interface{}{}}
+	_, err = client.Message.Create(context.Background(), appID, message)
+	var apiErr *svixapi.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, apiErr.Status())
+
+	_, err = client.Message.Create(context.Background(), appID, message)
+	require.NoError(t, err)
+	assert.Equal(t, 3, server.Requests(CreateMessage))
+}
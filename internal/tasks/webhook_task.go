@@ -2,26 +2,31 @@ package tasks
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/markonick/gigs-challenge/internal/logger"
 	"github.com/markonick/gigs-challenge/internal/models"
 	"github.com/markonick/gigs-challenge/internal/svix"
+	"github.com/markonick/gigs-challenge/internal/utils"
 )
 
+// ProjectApps resolves the Svix application of a project, see svix.ProjectRegistry
+type ProjectApps interface {
+	AppID(ctx context.Context, project string) (string, error)
+}
+
 // WebhookTask implements worker.Task interface
 type WebhookTask struct {
-	event         models.BaseEvent
-	svixClient    svix.Client
-	projectAppIDs map[string]string
+	event       models.BaseEvent
+	svixClient  svix.Client
+	projectApps ProjectApps
 }
 
 // NewWebhookTask creates a new webhook task that implements worker.Task
-func NewWebhookTask(event models.BaseEvent, svixClient svix.Client, projectAppIDs map[string]string) *WebhookTask {
+func NewWebhookTask(event models.BaseEvent, svixClient svix.Client, projectApps ProjectApps) *WebhookTask {
 	return &WebhookTask{
-		event:         event,
-		svixClient:    svixClient,
-		projectAppIDs: projectAppIDs,
+		event:       event,
+		svixClient:  svixClient,
+		projectApps: projectApps,
 	}
 }
 
@@ -29,22 +34,31 @@ func NewWebhookTask(event models.BaseEvent, svixClient svix.Client, projectAppID
 func (t *WebhookTask) Execute(ctx context.Context) error {
 	projectID := t.event.Project
 	if projectID == "" {
-		return fmt.Errorf("project not found in event data")
+		return utils.NewValidationError("project", "project not found in event data")
 	}
 
-	appID, ok := t.projectAppIDs[projectID]
-	if !ok {
-		return fmt.Errorf("no app ID found for project: %s", projectID)
+	appID, err := t.projectApps.AppID(ctx, projectID)
+	if err != nil {
+		return err
 	}
 
-	logger.Log.Info().
-		Str("type", t.event.Type).
-		Str("eventID", t.event.ID).
-		Msg("Processing webhook event")
+	log := logger.Ctx(ctx).Info()
+	if t.event.PubSub != nil {
+		log = log.
+			Str("message_id", t.event.PubSub.MessageID).
+			Str("subscription", t.event.PubSub.Subscription).
+			Time("publish_time", t.event.PubSub.PublishTime)
+	}
+	log.Msg("Processing webhook event")
 
 	return t.svixClient.SendMessage(ctx, appID, t.event)
 }
 
+// Event returns the event this task delivers
+func (t *WebhookTask) Event() models.BaseEvent {
+	return t.event
+}
+
 // ID implements worker.Task interface
 func (t *WebhookTask) ID() string {
 	return t.event.ID
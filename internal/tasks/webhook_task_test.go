@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/mock"
 
 	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/utils"
 )
 
 type MockSvixClient struct {
@@ -19,8 +20,13 @@ func (m *MockSvixClient) SendMessage(ctx context.Context, appID string, event mo
 	return args.Error(0)
 }
 
-func (m *MockSvixClient) CreateApplication(ctx context.Context, name string) (string, error) {
-	args := m.Called(ctx, name)
+func (m *MockSvixClient) Ping(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockSvixClient) CreateApplication(ctx context.Context, uid, name string) (string, error) {
+	args := m.Called(ctx, uid, name)
 	return args.String(0), args.Error(1)
 }
 
@@ -29,6 +35,17 @@ func (m *MockSvixClient) SetupApplicationEndpoints(ctx context.Context, appID st
 	return args.Error(0)
 }
 
+// staticApps resolves projects from a fixed mapping
+type staticApps map[string]string
+
+func (s staticApps) AppID(_ context.Context, project string) (string, error) {
+	appID, ok := s[project]
+	if !ok {
+		return "", &utils.NotFoundError{Code: utils.UnknownProjectCode, Detail: "unknown project " + project}
+	}
+	return appID, nil
+}
+
 func TestWebhookTask_Execute(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -82,7 +99,7 @@ func TestWebhookTask_Execute(t *testing.T) {
 			mockClient := new(MockSvixClient)
 			tt.setupMock(mockClient)
 
-			task := NewWebhookTask(tt.event, mockClient, tt.projectApps)
+			task := NewWebhookTask(tt.event, mockClient, staticApps(tt.projectApps))
 			err := task.Execute(context.Background())
 
 			if tt.wantErr {
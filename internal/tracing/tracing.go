@@ -0,0 +1,132 @@
+// Package tracing sets OpenTelemetry up and starts the spans that follow an event
+// from Pub/Sub through the worker pool to Svix.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/markonick/gigs-challenge/internal/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/markonick/gigs-challenge"
+
+// Span exporters
+const (
+	// ExporterNone records no spans, trace context is still propagated into the logs
+	ExporterNone = "none"
+	// ExporterStdout writes the spans as JSON, for local runs and tests
+	ExporterStdout = "stdout"
+	// ExporterOTLP sends the spans over OTLP/HTTP, configured by the standard
+	// OTEL_EXPORTER_OTLP_* variables
+	ExporterOTLP = "otlp"
+)
+
+// Config selects the span exporter and the sampling
+type Config struct {
+	Exporter    string
+	ServiceName string
+	// SampleRatio is the share of new traces that are recorded, traces started
+	// by the publisher follow the decision of their parent
+	SampleRatio float64
+	// Writer receives the spans of the stdout exporter, os.Stdout when nil
+	Writer io.Writer
+}
+
+// DefaultConfig records nothing
+var DefaultConfig = Config{
+	Exporter:    ExporterNone,
+	ServiceName: "hookbro",
+	SampleRatio: 1,
+}
+
+// Setup installs the W3C trace context propagator and the global tracer provider.
+// The returned function flushes the pending spans and stops the exporter.
+func Setup(ctx context.Context, config Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		writer := config.Writer
+		if writer == nil {
+			writer = os.Stdout
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(writer))
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", config.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s span exporter: %w", config.Exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(config.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span as a child of the span in ctx
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End records err on the span, when there is one, and ends the span
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// FromHeader returns ctx with the trace context of the HTTP request headers
+func FromHeader(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// FromAttributes returns ctx with the trace context the publisher put in the
+// Pub/Sub message attributes, ctx is returned as is when there is none
+func FromAttributes(ctx context.Context, attributes map[string]string) context.Context {
+	if len(attributes) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(attributes))
+}
+
+// EventAttributes describe a Gigs event on a span
+func EventAttributes(event models.BaseEvent) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		attribute.String("event.id", event.ID),
+		attribute.String("event.type", event.Type),
+		attribute.String("event.project", event.Project),
+	}
+	if event.PubSub != nil {
+		attributes = append(attributes, semconv.MessagingMessageID(event.PubSub.MessageID))
+	}
+	return attributes
+}
@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestSetup(t *testing.T) {
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+
+	t.Run("stdout exporter writes the spans", func(t *testing.T) {
+		var out bytes.Buffer
+		shutdown, err := Setup(context.Background(), Config{Exporter: ExporterStdout, ServiceName: "hookbro", SampleRatio: 1, Writer: &out})
+		require.NoError(t, err)
+
+		_, span := Start(context.Background(), "task.execute")
+		End(span, nil)
+		require.NoError(t, shutdown(context.Background()))
+		assert.Contains(t, out.String(), `"Name":"task.execute"`)
+	})
+
+	t.Run("no exporter", func(t *testing.T) {
+		shutdown, err := Setup(context.Background(), DefaultConfig)
+		require.NoError(t, err)
+		assert.NoError(t, shutdown(context.Background()))
+	})
+
+	t.Run("unknown exporter", func(t *testing.T) {
+		_, err := Setup(context.Background(), Config{Exporter: "jaeger"})
+		assert.ErrorContains(t, err, "jaeger")
+	})
+}
+
+func TestExtract(t *testing.T) {
+	_, err := Setup(context.Background(), DefaultConfig)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		ctx       func() context.Context
+		wantTrace string
+	}{
+		{
+			name: "pub/sub attributes",
+			ctx: func() context.Context {
+				return FromAttributes(context.Background(), map[string]string{"traceparent": traceparent})
+			},
+			wantTrace: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name: "http headers",
+			ctx: func() context.Context {
+				header := http.Header{}
+				header.Set("traceparent", traceparent)
+				return FromHeader(context.Background(), header)
+			},
+			wantTrace: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name: "attributes without trace context",
+			ctx: func() context.Context {
+				return FromAttributes(context.Background(), map[string]string{"origin": "gigs"})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spanContext := trace.SpanContextFromContext(tt.ctx())
+			if tt.wantTrace == "" {
+				assert.False(t, spanContext.IsValid())
+				return
+			}
+			assert.True(t, spanContext.IsRemote())
+			assert.Equal(t, tt.wantTrace, spanContext.TraceID().String())
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -62,20 +65,53 @@ type (
 		Detail string `json:"detail"`
 	}
 
+	ServiceUnavailableError struct {
+		Code   string `json:"code"`
+		Detail string `json:"detail"`
+	}
+
 	InternalError struct {
 		Message string `json:"message"`
 	}
+
+	// RetryExhaustedError wraps the last error of an operation that kept failing after all retries
+	RetryExhaustedError struct {
+		Operation string
+		Attempts  int
+		Err       error
+	}
+
+	// CancelledError is returned when an operation stopped because its context was
+	// cancelled or timed out. Err is the context error.
+	CancelledError struct {
+		Operation string
+		Attempts  int
+		Err       error
+	}
 )
 
 // Error interface implementations
-func (e *ValidationError) Error() string      { return e.Detail }
-func (e *AuthError) Error() string            { return e.Detail }
-func (e *ForbiddenError) Error() string       { return e.Detail }
-func (e *NotFoundError) Error() string        { return e.Detail }
-func (e *ConflictError) Error() string        { return e.Detail }
-func (e *PayloadTooLargeError) Error() string { return e.Detail }
-func (e *RateLimitError) Error() string       { return e.Detail }
-func (e *InternalError) Error() string        { return e.Message }
+func (e *ValidationError) Error() string         { return e.Detail }
+func (e *AuthError) Error() string               { return e.Detail }
+func (e *ForbiddenError) Error() string          { return e.Detail }
+func (e *NotFoundError) Error() string           { return e.Detail }
+func (e *ConflictError) Error() string           { return e.Detail }
+func (e *PayloadTooLargeError) Error() string    { return e.Detail }
+func (e *RateLimitError) Error() string          { return e.Detail }
+func (e *ServiceUnavailableError) Error() string { return e.Detail }
+func (e *InternalError) Error() string           { return e.Message }
+
+func (e *RetryExhaustedError) Error() string {
+	return fmt.Sprintf("%s failed after %d attempts: %v", e.Operation, e.Attempts, e.Err)
+}
+
+func (e *RetryExhaustedError) Unwrap() error { return e.Err }
+
+func (e *CancelledError) Error() string {
+	return fmt.Sprintf("%s cancelled after %d attempts: %v", e.Operation, e.Attempts, e.Err)
+}
+
+func (e *CancelledError) Unwrap() error { return e.Err }
 
 // RespondWithError handles different error types and sends appropriate HTTP responses
 func RespondWithError(c *gin.Context, err error) {
@@ -108,6 +144,10 @@ func RespondWithError(c *gin.Context, err error) {
 		logger.Log.Warn().Err(err).Msg("Rate limit exceeded")
 		c.JSON(http.StatusTooManyRequests, gin.H{"error": e})
 
+	case *ServiceUnavailableError:
+		logger.Log.Warn().Err(err).Msg("Service unavailable")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": e})
+
 	default:
 		logger.Log.Error().Err(err).Msg("Internal server error")
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -158,6 +198,13 @@ func NewRateLimitError(message string) *RateLimitError {
 	}
 }
 
+func NewServiceUnavailableError(message string) *ServiceUnavailableError {
+	return &ServiceUnavailableError{
+		Code:   "service_unavailable",
+		Detail: message,
+	}
+}
+
 func NewInternalError(message string) *InternalError {
 	return &InternalError{
 		Message: message,
@@ -170,3 +217,63 @@ func NewValidationError(code, message string) *ValidationError {
 		Detail: message,
 	}
 }
+
+// UnknownProjectCode marks the NotFoundError returned for events of a project without a Svix application
+const UnknownProjectCode = "unknown_project"
+
+// ProjectInitializingCode marks the ServiceUnavailableError returned for events of a project
+// whose Svix application is not set up yet
+const ProjectInitializingCode = "project_initializing"
+
+// CircuitOpenCode marks the ServiceUnavailableError returned while a Svix circuit breaker is open
+const CircuitOpenCode = "circuit_open"
+
+// ErrorClass returns a short, stable name for the kind of failure, used to group failed deliveries
+func ErrorClass(err error) string {
+	var (
+		retryErr       *RetryExhaustedError
+		validationErr  *ValidationError
+		authErr        *AuthError
+		forbiddenErr   *ForbiddenError
+		notFoundErr    *NotFoundError
+		conflictErr    *ConflictError
+		tooLargeErr    *PayloadTooLargeError
+		rateLimitErr   *RateLimitError
+		unavailableErr *ServiceUnavailableError
+		internalErr    *InternalError
+	)
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.As(err, &retryErr):
+		return "retries_exhausted"
+	case errors.As(err, &notFoundErr) && notFoundErr.Code == UnknownProjectCode:
+		return UnknownProjectCode
+	case errors.As(err, &validationErr):
+		return "validation_failed"
+	case errors.As(err, &tooLargeErr):
+		return "payload_too_large"
+	case errors.As(err, &authErr):
+		return "auth"
+	case errors.As(err, &forbiddenErr):
+		return "forbidden"
+	case errors.As(err, &notFoundErr):
+		return "not_found"
+	case errors.As(err, &conflictErr):
+		return "conflict"
+	case errors.As(err, &rateLimitErr):
+		return "rate_limited"
+	case errors.As(err, &unavailableErr) && unavailableErr.Code == CircuitOpenCode:
+		return CircuitOpenCode
+	case errors.As(err, &unavailableErr):
+		return "unavailable"
+	case errors.As(err, &internalErr):
+		return "internal"
+	default:
+		return "unknown"
+	}
+}
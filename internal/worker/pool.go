@@ -2,8 +2,18 @@ package worker
 
 import (
 	"context"
+	"errors"
+	"sync"
+	"time"
 
-	"github.com/gammazero/workerpool"
+	"github.com/markonick/gigs-challenge/internal/health"
+	"github.com/markonick/gigs-challenge/internal/logger"
+	"github.com/markonick/gigs-challenge/internal/metrics"
+	"github.com/markonick/gigs-challenge/internal/models"
+	"github.com/markonick/gigs-challenge/internal/tracing"
+	"github.com/markonick/gigs-challenge/internal/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Task represents a unit of work to be processed by the worker pool.
@@ -12,31 +22,343 @@ type Task interface {
 	ID() string
 }
 
-// Pool that manages concurrent task processing
+// Result is reported to the result hooks once a task has finished
+type Result struct {
+	Task     Task
+	Err      error
+	Duration time.Duration
+	// Interrupted is set when the task failed because the pool was shut down
+	// before it could finish, the task was not given a fair chance to deliver
+	Interrupted bool
+}
+
+// ResultHook is called for every finished task, successful or not
+type ResultHook func(Result)
+
+// Config describes the size of the pool and of its waiting queue
+type Config struct {
+	// MaxWorkers can be changed while the pool runs, see Resize
+	MaxWorkers    int
+	QueueCapacity int
+	// TaskTimeout bounds a single task execution, zero means no limit
+	TaskTimeout time.Duration
+}
+
+// Pool that manages concurrent task processing.
+// Tasks are executed asynchronously, at most MaxWorkers at a time, while up to
+// QueueCapacity further tasks wait. Once the queue is full new tasks are rejected.
+// Queued tasks start in the order they were accepted.
 type Pool struct {
-	wp *workerpool.WorkerPool
+	queueCapacity int
+	timeout       time.Duration
+
+	// ctx is handed to every task and cancelled when Shutdown runs out of time
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.RWMutex
+	workers  int
+	capacity int
+	// queue holds the accepted tasks no worker has taken yet
+	queue []func()
+	// running counts the worker goroutines, they exit once the queue is empty
+	running int
+	pending int
+	active  int
+	closed  bool
+	hooks   []ResultHook
+	// tasks counts the accepted tasks that have not finished
+	tasks sync.WaitGroup
+}
+
+// Stats is a snapshot of the pool load
+type Stats struct {
+	Workers int `json:"workers"`
+	// Active tasks are running, Queued ones wait for a worker
+	Active   int `json:"active"`
+	Queued   int `json:"queued"`
+	Capacity int `json:"capacity"`
+	// Utilization is the share of busy workers, between 0 and 1
+	Utilization float64 `json:"utilization"`
+	Accepting   bool    `json:"accepting"`
 }
 
-func NewPool(maxWorkers int) *Pool {
+func NewPool(config Config) *Pool {
+	if config.MaxWorkers < 1 {
+		config.MaxWorkers = 1
+	}
+	if config.QueueCapacity < 0 {
+		config.QueueCapacity = 0
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Pool{
-		wp: workerpool.New(maxWorkers),
+		workers:       config.MaxWorkers,
+		capacity:      config.MaxWorkers + config.QueueCapacity,
+		queueCapacity: config.QueueCapacity,
+		timeout:       config.TaskTimeout,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Resize changes the number of workers, the queue keeps its capacity. Growing starts
+// workers for the queued tasks right away, when shrinking the surplus workers stop
+// once their current task has finished.
+func (p *Pool) Resize(workers int) {
+	if workers < 1 {
+		workers = 1
 	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.workers = workers
+	p.capacity = workers + p.queueCapacity
+	p.spawn()
 }
 
-func (p *Pool) ProcessTask(task Task) error {
-	// Create a new background context for the task
-	ctx := context.Background()
-	errChan := make(chan error, 1)
+// submit queues the task function, p.mu must be held
+func (p *Pool) submit(fn func()) {
+	p.tasks.Add(1)
+	p.queue = append(p.queue, fn)
+	p.spawn()
+}
+
+// spawn starts workers until every accepted task has one or the pool is at its size, p.mu must be held
+func (p *Pool) spawn() {
+	for p.running < p.workers && p.running < p.pending {
+		p.running++
+		go p.work()
+	}
+}
+
+// work runs queued tasks until the queue is empty or the pool was shrunk below the running workers
+func (p *Pool) work() {
+	for {
+		p.mu.Lock()
+		if len(p.queue) == 0 || p.running > p.workers {
+			p.running--
+			p.mu.Unlock()
+			return
+		}
+		fn := p.queue[0]
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		p.mu.Unlock()
+
+		fn()
+		p.tasks.Done()
+	}
+}
+
+// OnResult registers a hook that receives the result of every task
+func (p *Pool) OnResult(hook ResultHook) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hooks = append(p.hooks, hook)
+}
+
+// ProcessTask queues the task and returns immediately.
+// It fails with a ServiceUnavailableError when the queue is full or the pool is closed.
+// The task runs with the values of ctx but not its cancellation, an accepted task
+// outlives the request that queued it. It is cancelled by the task timeout or shutdown.
+func (p *Pool) ProcessTask(ctx context.Context, task Task) (err error) {
+	ctx, span := tracing.Start(ctx, "task.enqueue", trace.WithAttributes(taskAttributes(task)...))
+	defer func() { tracing.End(span, err) }()
+
+	// Holding the lock keeps Close from stopping the pool in between
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return utils.NewServiceUnavailableError("Worker pool is shutting down")
+	}
+	if p.pending >= p.capacity {
+		return utils.NewServiceUnavailableError("Worker queue is full")
+	}
+	p.pending++
+	p.updateGauges()
+
+	p.submit(func() {
+		start := time.Now()
+
+		taskCtx, cancel := p.taskContext(ctx)
+		defer cancel()
+		taskCtx, span := tracing.Start(taskCtx, "task.execute", trace.WithAttributes(taskAttributes(task)...))
+
+		p.mu.Lock()
+		p.active++
+		p.updateGauges()
+		p.mu.Unlock()
+
+		// Tasks still queued when the shutdown deadline passes are not started at all
+		err := p.ctx.Err()
+		if err == nil {
+			err = task.Execute(taskCtx)
+		}
+		interrupted := err != nil && p.ctx.Err() != nil
+		span.SetAttributes(attribute.Bool("task.interrupted", interrupted))
+		tracing.End(span, err)
+
+		p.mu.Lock()
+		p.pending--
+		p.active--
+		p.updateGauges()
+		hooks := p.hooks
+		p.mu.Unlock()
+
+		switch {
+		case interrupted:
+			logger.Ctx(taskCtx).Warn().
+				Err(err).
+				Str("task_id", task.ID()).
+				Msg("Task interrupted by shutdown")
+		case err != nil:
+			logger.Ctx(taskCtx).Error().
+				Err(err).
+				Str("task_id", task.ID()).
+				Msg("Task execution failed")
+		}
 
-	p.wp.Submit(func() {
-		err := task.Execute(ctx)
-		errChan <- err // Send the error (or nil)
-		close(errChan) // Always close the channel
+		result := Result{Task: task, Err: err, Duration: time.Since(start), Interrupted: interrupted}
+		recordResult(result)
+		for _, hook := range hooks {
+			hook(result)
+		}
 	})
 
-	return <-errChan // Wait for result
+	return nil
 }
 
+// eventTask is implemented by tasks that deliver a Gigs event, their metrics
+// are labelled with its project and type
+type eventTask interface {
+	Event() models.BaseEvent
+}
+
+// updateGauges publishes the queue depth and the active workers, p.mu must be held
+func (p *Pool) updateGauges() {
+	metrics.QueueDepth.Set(float64(p.pending - p.active))
+	metrics.ActiveWorkers.Set(float64(p.active))
+}
+
+// taskAttributes describe the task on its spans
+func taskAttributes(task Task) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{attribute.String("task.id", task.ID())}
+	if task, ok := task.(eventTask); ok {
+		attributes = append(attributes, tracing.EventAttributes(task.Event())...)
+	}
+	return attributes
+}
+
+// recordResult counts the finished task and observes its duration
+func recordResult(result Result) {
+	outcome := "succeeded"
+	if result.Err != nil {
+		outcome = "failed"
+	}
+
+	var project, eventType string
+	if task, ok := result.Task.(eventTask); ok {
+		event := task.Event()
+		project, eventType = event.Project, event.Type
+	}
+
+	metrics.Tasks.WithLabelValues(outcome, utils.ErrorClass(result.Err), project, eventType).Inc()
+	metrics.TaskDuration.WithLabelValues(outcome).Observe(result.Duration.Seconds())
+}
+
+// taskContext detaches ctx from its cancellation and ties it to the pool
+// lifetime and the task timeout instead
+func (p *Pool) taskContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	taskCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(p.ctx, cancel)
+	if p.timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		taskCtx, cancelTimeout = context.WithTimeout(taskCtx, p.timeout)
+		return taskCtx, func() {
+			cancelTimeout()
+			stop()
+			cancel()
+		}
+	}
+	return taskCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// Pending returns the number of queued and running tasks
+func (p *Pool) Pending() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.pending
+}
+
+// Stats returns the current load of the pool
+func (p *Pool) Stats() Stats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return Stats{
+		Workers:     p.workers,
+		Active:      p.active,
+		Queued:      p.pending - p.active,
+		Capacity:    p.capacity,
+		Utilization: float64(p.active) / float64(p.workers),
+		Accepting:   !p.closed && p.pending < p.capacity,
+	}
+}
+
+// Closed reports whether the pool has stopped accepting tasks for good
+func (p *Pool) Closed() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.closed
+}
+
+// HealthCheck is down while the pool is shutting down or its queue is full
+func (p *Pool) HealthCheck(_ context.Context) health.Result {
+	stats := p.Stats()
+	if !stats.Accepting {
+		return health.Down(errors.New("worker pool is not accepting tasks"), stats)
+	}
+	return health.Up(stats)
+}
+
+// Close stops accepting tasks and waits for the queued ones to finish
 func (p *Pool) Close() {
-	p.wp.StopWait()
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	p.tasks.Wait()
+	p.cancel()
+}
+
+// Shutdown stops accepting tasks and drains the queue until ctx is done.
+// At the deadline the running tasks are cancelled through their context and the
+// queued ones are skipped, all of them are reported to the hooks as interrupted.
+// It returns ctx.Err() when the pool could not be drained in time.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		p.tasks.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+	}
+
+	logger.Log.Warn().
+		Int("pending", p.Pending()).
+		Msg("Shutdown deadline reached, cancelling remaining tasks")
+	p.cancel()
+	<-drained
+	return ctx.Err()
 }
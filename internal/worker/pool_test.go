@@ -0,0 +1,301 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markonick/gigs-challenge/internal/health"
+	"github.com/markonick/gigs-challenge/internal/metrics"
+	"github.com/markonick/gigs-challenge/internal/utils"
+)
+
+type blockingTask struct {
+	id      string
+	err     error
+	release chan struct{}
+}
+
+func (b *blockingTask) Execute(_ context.Context) error {
+	if b.release != nil {
+		<-b.release
+	}
+	return b.err
+}
+
+func (b *blockingTask) ID() string {
+	return b.id
+}
+
+func TestPool_ProcessTaskIsAsynchronous(t *testing.T) {
+	pool := NewPool(Config{MaxWorkers: 1, QueueCapacity: 1})
+	defer pool.Close()
+
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- pool.ProcessTask(context.Background(), &blockingTask{id: "task-1", release: release})
+	}()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("ProcessTask waited for the task to finish")
+	}
+	close(release)
+}
+
+func TestPool_RejectsWhenQueueIsFull(t *testing.T) {
+	pool := NewPool(Config{MaxWorkers: 1, QueueCapacity: 2})
+	release := make(chan struct{})
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, pool.ProcessTask(context.Background(), &blockingTask{id: "task", release: release}))
+	}
+	assert.Equal(t, 3, pool.Pending())
+
+	err := pool.ProcessTask(context.Background(), &blockingTask{id: "overflow"})
+	var unavailable *utils.ServiceUnavailableError
+	assert.ErrorAs(t, err, &unavailable)
+
+	close(release)
+	pool.Close()
+	assert.Equal(t, 0, pool.Pending())
+
+	err = pool.ProcessTask(context.Background(), &blockingTask{id: "after-close"})
+	assert.ErrorAs(t, err, &unavailable)
+}
+
+func TestPool_ReportsResults(t *testing.T) {
+	pool := NewPool(Config{MaxWorkers: 2, QueueCapacity: 10})
+
+	var (
+		mu      sync.Mutex
+		results = map[string]error{}
+	)
+	pool.OnResult(func(r Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[r.Task.ID()] = r.Err
+	})
+
+	failure := errors.New("svix is down")
+	require.NoError(t, pool.ProcessTask(context.Background(), &blockingTask{id: "ok"}))
+	require.NoError(t, pool.ProcessTask(context.Background(), &blockingTask{id: "failed", err: failure}))
+	pool.Close()
+
+	assert.Equal(t, map[string]error{"ok": nil, "failed": failure}, results)
+}
+
+// contextTask runs until its context is cancelled, unless released first
+type contextTask struct {
+	id      string
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *contextTask) Execute(ctx context.Context) error {
+	close(c.started)
+	select {
+	case <-c.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *contextTask) ID() string {
+	return c.id
+}
+
+func TestPool_Shutdown(t *testing.T) {
+	t.Run("drains queued tasks", func(t *testing.T) {
+		pool := NewPool(Config{MaxWorkers: 1, QueueCapacity: 5})
+		var (
+			mu      sync.Mutex
+			results []Result
+		)
+		pool.OnResult(func(r Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			results = append(results, r)
+		})
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, pool.ProcessTask(context.Background(), &blockingTask{id: "task"}))
+		}
+
+		require.NoError(t, pool.Shutdown(context.Background()))
+		require.Len(t, results, 3)
+		for _, r := range results {
+			assert.NoError(t, r.Err)
+			assert.False(t, r.Interrupted)
+		}
+	})
+
+	t.Run("cancels tasks still running at the deadline", func(t *testing.T) {
+		pool := NewPool(Config{MaxWorkers: 1, QueueCapacity: 5})
+		var (
+			mu          sync.Mutex
+			interrupted []string
+		)
+		pool.OnResult(func(r Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			if r.Interrupted {
+				interrupted = append(interrupted, r.Task.ID())
+			}
+		})
+
+		running := &contextTask{id: "running", started: make(chan struct{}), release: make(chan struct{})}
+		queued := &contextTask{id: "queued", started: make(chan struct{}), release: make(chan struct{})}
+		require.NoError(t, pool.ProcessTask(context.Background(), running))
+		require.NoError(t, pool.ProcessTask(context.Background(), queued))
+		<-running.started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := pool.Shutdown(ctx)
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ElementsMatch(t, []string{"running", "queued"}, interrupted)
+		select {
+		case <-queued.started:
+			t.Fatal("queued task started after the deadline")
+		default:
+		}
+
+		var unavailable *utils.ServiceUnavailableError
+		assert.ErrorAs(t, pool.ProcessTask(context.Background(), &blockingTask{id: "late"}), &unavailable)
+	})
+}
+
+type ctxKey struct{}
+
+// valueTask records the value and error its context carries once it is done
+type valueTask struct {
+	value interface{}
+	err   error
+	done  chan struct{}
+}
+
+func (v *valueTask) Execute(ctx context.Context) error {
+	defer close(v.done)
+	v.value = ctx.Value(ctxKey{})
+	select {
+	case <-ctx.Done():
+		v.err = ctx.Err()
+	case <-time.After(100 * time.Millisecond):
+	}
+	return v.err
+}
+
+func (v *valueTask) ID() string {
+	return "value"
+}
+
+func TestPool_TaskContext(t *testing.T) {
+	t.Run("keeps request values but not its cancellation", func(t *testing.T) {
+		pool := NewPool(Config{MaxWorkers: 1})
+		defer pool.Close()
+
+		ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "req_1"))
+		task := &valueTask{done: make(chan struct{})}
+		require.NoError(t, pool.ProcessTask(ctx, task))
+		cancel()
+
+		<-task.done
+		assert.Equal(t, "req_1", task.value)
+		assert.NoError(t, task.err)
+	})
+
+	t.Run("applies the task timeout", func(t *testing.T) {
+		pool := NewPool(Config{MaxWorkers: 1, TaskTimeout: 20 * time.Millisecond})
+		var result Result
+		pool.OnResult(func(r Result) { result = r })
+
+		task := &valueTask{done: make(chan struct{})}
+		require.NoError(t, pool.ProcessTask(context.Background(), task))
+		pool.Close()
+
+		assert.ErrorIs(t, result.Err, context.DeadlineExceeded)
+		assert.False(t, result.Interrupted, "a timeout is a delivery failure, not a shutdown")
+	})
+}
+
+func TestPool_Metrics(t *testing.T) {
+	pool := NewPool(Config{MaxWorkers: 1, QueueCapacity: 1})
+	defer pool.Close()
+
+	failed := metrics.Tasks.WithLabelValues("failed", "rate_limited", "", "")
+	before := testutil.ToFloat64(failed)
+
+	release := make(chan struct{})
+	require.NoError(t, pool.ProcessTask(context.Background(), &blockingTask{release: release, err: utils.NewRateLimitError("slow down")}))
+	require.NoError(t, pool.ProcessTask(context.Background(), &blockingTask{release: release}))
+	require.Eventually(t, func() bool { return testutil.ToFloat64(metrics.ActiveWorkers) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.QueueDepth))
+
+	close(release)
+	require.Eventually(t, func() bool { return testutil.ToFloat64(failed) == before+1 }, time.Second, 5*time.Millisecond)
+	require.Eventually(t, func() bool { return pool.Pending() == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.ActiveWorkers))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.QueueDepth))
+}
+
+func TestPool_Stats(t *testing.T) {
+	pool := NewPool(Config{MaxWorkers: 2, QueueCapacity: 1})
+	release := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, pool.ProcessTask(context.Background(), &blockingTask{release: release}))
+	}
+
+	require.Eventually(t, func() bool { return pool.Stats().Active == 2 }, time.Second, 5*time.Millisecond)
+	stats := pool.Stats()
+	assert.Equal(t, Stats{Workers: 2, Active: 2, Queued: 1, Capacity: 3, Utilization: 1, Accepting: false}, stats)
+	assert.Equal(t, health.StatusDown, pool.HealthCheck(context.Background()).Status)
+
+	close(release)
+	require.Eventually(t, func() bool { return pool.Stats().Active == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, health.StatusUp, pool.HealthCheck(context.Background()).Status)
+
+	pool.Close()
+	assert.False(t, pool.Stats().Accepting)
+}
+
+func TestPool_Resize(t *testing.T) {
+	pool := NewPool(Config{MaxWorkers: 1, QueueCapacity: 4})
+	defer pool.Close()
+
+	first := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, pool.ProcessTask(context.Background(), &blockingTask{release: first}))
+	}
+	require.Eventually(t, func() bool { return pool.Stats().Active == 1 }, time.Second, 5*time.Millisecond)
+
+	// Growing starts the queued tasks right away
+	pool.Resize(3)
+	require.Eventually(t, func() bool { return pool.Stats().Active == 3 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 7, pool.Stats().Capacity)
+
+	// Shrinking lets the running tasks finish, then runs one task at a time
+	pool.Resize(1)
+	second := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		require.NoError(t, pool.ProcessTask(context.Background(), &blockingTask{release: second}))
+	}
+	close(first)
+	require.Eventually(t, func() bool { return pool.Pending() == 2 }, time.Second, 5*time.Millisecond)
+	assert.Never(t, func() bool { return pool.Stats().Active > 1 }, 50*time.Millisecond, 5*time.Millisecond)
+	assert.Equal(t, Stats{Workers: 1, Active: 1, Queued: 1, Capacity: 5, Utilization: 1, Accepting: true}, pool.Stats())
+
+	close(second)
+	require.Eventually(t, func() bool { return pool.Pending() == 0 }, time.Second, 5*time.Millisecond)
+}